@@ -0,0 +1,204 @@
+package sbarena
+
+import (
+	"math/bits"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// A source of raw memory that data structures, such as generic
+	// containers, can allocate their nodes from. [*Arena] implements it, so
+	// anything that accepts an Allocator can be backed by an arena.
+	Allocator interface {
+		// Returns a pointer to `size` bytes whose address is a multiple of
+		// `align`, which must be a power of two.
+		AllocRaw(size, align uintptr) (unsafe.Pointer, error)
+	}
+
+	// Provides the memory for an arenas buckets, see [NewArenaWithAllocator].
+	// This makes it possible to back an arena with memory that does not live
+	// on the go heap, such as memory mapped with mmap or huge pages, which is
+	// not scanned by the garbage collector.
+	BucketAllocator interface {
+		// Returns a region of at least `size` bytes, or nil if the memory
+		// could not be allocated. The region must stay valid until it is
+		// passed to Free.
+		Alloc(size uintptr) []byte
+		// Releases a region that was returned by Alloc. The slice is the same
+		// slice that Alloc returned.
+		Free(b []byte)
+	}
+
+	// The default [BucketAllocator], which allocates buckets on the go heap
+	// the same way as arenas that are created with [NewArena]. Freeing a
+	// bucket does nothing, the garbage collector reclaims it once it is no
+	// longer referenced.
+	HeapBucketAllocator struct{}
+
+	// Adapts a [BucketAllocator] to the allocator interface used internally.
+	customAllocator struct {
+		lease *customLease
+	}
+
+	// The buckets that have been allocated by a [BucketAllocator] and not yet
+	// freed, keyed by the address of their first byte. They are freed once
+	// the arena that holds them has been garbage collected.
+	customLease struct {
+		mu      sync.Mutex
+		alloc   BucketAllocator
+		buckets map[*byte][]byte
+	}
+)
+
+// Allocates `size` bytes in the arena whose address is a multiple of `align`,
+// the same way as [Alloc] allocates a value whose size and alignment are `size`
+// and `align`. This implements [Allocator]. `align` must be a power of two,
+// otherwise an [InvalidAlignmentErr] will be returned, and `size` must be
+// less than the bucket size the allocator was initialized with, otherwise a
+// [ValueToLargeErr] will be returned.
+//
+// The returned pointer does not keep the arenas memory alive. The memory must
+// not be used once the arena is rewound or cleared, or once the arena itself is
+// no longer referenced. The garbage collector scans the memory for pointers,
+// treating every pointer aligned word as one, so the memory must not hold
+// integers that look like pointers. Use [AllocBytes] for raw data instead.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func (a *Arena) AllocRaw(size, align uintptr) (unsafe.Pointer, error) {
+	if bits.OnesCount(uint(align)) != 1 {
+		return nil, sberr.Wrap(InvalidAlignmentErr, "Alignment: %d", align)
+	}
+	return allocRaw(a, size, align, scanKind)
+}
+
+// Allocates `size` bytes aligned to `align`, which must be a power of two, in
+// a bucket of the given kind. This is the shared implementation of [Alloc] and [Arena.AllocRaw] and must
+// be called directly from them so that the allocation is recorded against
+// their caller.
+func allocRaw(
+	a *Arena,
+	size, align uintptr,
+	kind bucketKind,
+) (unsafe.Pointer, error) {
+	if size > maxAllocSize(a) {
+		return nil, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+	if size == 0 {
+		return unsafe.Pointer(&zeroSizeBase), nil
+	}
+	if ptr := bumpAlloc(a, size, align, kind); ptr != nil {
+		return ptr, nil
+	}
+
+	lockAlloc(a)
+	defer unlock(a)
+	ptr, err := allocLocked(a, size, align, kind)
+	if err != nil {
+		return nil, err
+	}
+	recordAllocSkip(a, size, 1)
+	return ptr, nil
+}
+
+// Allocates a bucket of `size` bytes on the go heap.
+func (HeapBucketAllocator) Alloc(size uintptr) []byte {
+	return newBucket(size, plainKind)
+}
+
+// Does nothing, buckets on the go heap are reclaimed by the garbage collector.
+func (HeapBucketAllocator) Free(b []byte) {}
+
+// Creates a new [Arena] allocator, initializing it to use `bucketSizeBytes`
+// bucket size and to take the memory for its buckets from `alloc`. [Clear],
+// [Shrink] and the other functions that release buckets pass them to
+// `alloc.Free`. Any buckets that are still held when the arena is garbage
+// collected are freed as well, which happens on a separate goroutine.
+//
+// Memory from any allocator other than [HeapBucketAllocator] is assumed to not
+// live on the go heap. It is not scanned by the garbage collector, so values
+// stored in it must not hold the only reference to go heap memory, and weak
+// pointers can not reference it, so functions that return weak pointers, such
+// as [Alloc], will return a [NonHeapMemoryErr]. A nil `alloc` is the same as
+// [HeapBucketAllocator].
+//
+// If `bucketSizeBytes` is <=0 then [DefaultBlockSize] is used.
+func NewArenaWithAllocator(
+	bucketSizeBytes uintptr,
+	alloc BucketAllocator,
+) (rv Arena) {
+	switch alloc.(type) {
+	case nil, HeapBucketAllocator, *HeapBucketAllocator:
+		rv = NewArena(bucketSizeBytes)
+		return
+	}
+	if bucketSizeBytes <= 0 {
+		bucketSizeBytes = DefaultBlockSize
+	}
+
+	g := &customAllocator{
+		lease: &customLease{alloc: alloc, buckets: map[*byte][]byte{}},
+	}
+	runtime.AddCleanup(g, (*customLease).release, g.lease)
+
+	rv.arenaState = arenaState{
+		buckets:    []bucket{},
+		bucketSize: bucketSizeBytes,
+		allocator:  g,
+		parked:     lanePos{bucket: -1},
+	}
+	if b := g.alloc(bucketSizeBytes, plainKind); b != nil {
+		appendBucket(&rv, b, plainKind)
+		rv.bytesLeft = bucketSizeBytes
+		rv.freshBuckets = 1
+	}
+	publishStats(&rv)
+	return
+}
+
+func (g *customAllocator) alloc(size uintptr, kind bucketKind) bucket {
+	b := g.lease.alloc.Alloc(size)
+	if uintptr(len(b)) < size {
+		if b != nil {
+			g.lease.alloc.Free(b)
+		}
+		return nil
+	}
+	g.lease.mu.Lock()
+	g.lease.buckets[unsafe.SliceData(b)] = b
+	g.lease.mu.Unlock()
+	return b[:size:size]
+}
+
+func (g *customAllocator) free(b bucket, kind bucketKind) {
+	g.lease.mu.Lock()
+	orig, ok := g.lease.buckets[unsafe.SliceData(b)]
+	delete(g.lease.buckets, unsafe.SliceData(b))
+	g.lease.mu.Unlock()
+	if ok {
+		g.lease.alloc.Free(orig)
+	}
+}
+
+func (g *customAllocator) onHeap() bool {
+	return false
+}
+
+// Frees all of the buckets that are still held. This is run once the arena
+// that held them has been garbage collected.
+func (l *customLease) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, b := range l.buckets {
+		l.alloc.Free(b)
+		delete(l.buckets, k)
+	}
+}
@@ -0,0 +1,155 @@
+package sbarena
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+// A [BucketAllocator] that records which buckets are allocated and freed.
+type recordingAllocator struct {
+	mu     sync.Mutex
+	allocs int
+	frees  int
+	live   map[*byte]struct{}
+	freed  chan struct{}
+}
+
+func newRecordingAllocator() *recordingAllocator {
+	return &recordingAllocator{
+		live:  map[*byte]struct{}{},
+		freed: make(chan struct{}, 16),
+	}
+}
+
+func (r *recordingAllocator) Alloc(size uintptr) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Over allocate to check that the arena only uses what it asked for.
+	b := make([]byte, size+8)
+	r.allocs++
+	r.live[unsafe.SliceData(b)] = struct{}{}
+	return b
+}
+
+func (r *recordingAllocator) Free(b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.live[unsafe.SliceData(b)]; !ok {
+		panic("freed a bucket that was not allocated or was already freed")
+	}
+	delete(r.live, unsafe.SliceData(b))
+	r.frees++
+	r.freed <- struct{}{}
+}
+
+func (r *recordingAllocator) counts() (int, int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.allocs, r.frees, len(r.live)
+}
+
+func TestNewArenaWithAllocator(t *testing.T) {
+	r := newRecordingAllocator()
+	func() {
+		a := NewArenaWithAllocator(64, r)
+		allocs, frees, live := r.counts()
+		sbtest.Eq(t, 1, allocs)
+		sbtest.Eq(t, 0, frees)
+		sbtest.Eq(t, 1, live)
+		sbtest.Eq(t, uintptr(64), TotalMemBytes(&a))
+
+		for range 3 {
+			b, err := AllocBytes(&a, 64)
+			sbtest.Nil(t, err)
+			sbtest.Eq(t, 64, cap(b))
+		}
+		allocs, frees, _ = r.counts()
+		sbtest.Eq(t, 3, allocs)
+		sbtest.Eq(t, 0, frees)
+
+		_, err := Alloc[testStruct](&a)
+		sbtest.ContainsError(t, NonHeapMemoryErr, err)
+
+		Reset(&a)
+		Shrink(&a)
+		allocs, frees, live = r.counts()
+		sbtest.Eq(t, 3, allocs)
+		sbtest.Eq(t, 2, frees)
+		sbtest.Eq(t, 1, live)
+
+		Clear(&a)
+		allocs, frees, live = r.counts()
+		sbtest.Eq(t, 3, allocs)
+		sbtest.Eq(t, 3, frees)
+		sbtest.Eq(t, 0, live)
+
+		_, err = AllocBytes(&a, 8)
+		sbtest.Nil(t, err)
+		allocs, _, live = r.counts()
+		sbtest.Eq(t, 4, allocs)
+		sbtest.Eq(t, 1, live)
+	}()
+
+	// The bucket that was still held is freed once the arena is collected.
+	for range 3 {
+		<-r.freed
+	}
+	sbtest.True(t, gcUntil(r.freed, time.Second))
+	allocs, frees, live := r.counts()
+	sbtest.Eq(t, 4, allocs)
+	sbtest.Eq(t, 4, frees)
+	sbtest.Eq(t, 0, live)
+}
+
+func TestNewArenaWithHeapAllocator(t *testing.T) {
+	for _, alloc := range []BucketAllocator{
+		nil, HeapBucketAllocator{}, &HeapBucketAllocator{},
+	} {
+		a := NewArenaWithAllocator(0, alloc)
+		sbtest.Eq(t, DefaultBlockSize, TotalMemBytes(&a))
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		p.Value().A = 1
+		sbtest.Eq(t, 1, p.Value().A)
+	}
+}
+
+func TestAllocRaw(t *testing.T) {
+	a := NewArena(0)
+	var alloc Allocator = &a
+	inBucket := func(p unsafe.Pointer, size uintptr) bool {
+		lock(&a)
+		defer unlock(&a)
+		for _, b := range a.buckets {
+			start := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+			if uintptr(p) >= start && uintptr(p)+size <= start+uintptr(len(b)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, tc := range []struct{ size, align uintptr }{
+		{1, 1}, {3, 1}, {8, 64}, {24, 8}, {16, 32}, {5, 2}, {100, 16}, {1, 64},
+	} {
+		p, err := alloc.AllocRaw(tc.size, tc.align)
+		sbtest.Nil(t, err)
+		sbtest.Eq(t, uintptr(0), uintptr(p)%tc.align)
+		sbtest.True(t, inBucket(p, tc.size))
+	}
+
+	p, err := alloc.AllocRaw(0, 8)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Pointer(&zeroSizeBase), p)
+
+	_, err = alloc.AllocRaw(8, 0)
+	sbtest.ContainsError(t, InvalidAlignmentErr, err)
+	_, err = alloc.AllocRaw(8, 3)
+	sbtest.ContainsError(t, InvalidAlignmentErr, err)
+	_, err = alloc.AllocRaw(DefaultBlockSize+1, 8)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
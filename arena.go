@@ -2,8 +2,12 @@
 package sbarena
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
 	"sync/atomic"
+	"time"
 	"unsafe"
 	"weak"
 
@@ -30,23 +34,176 @@ type (
 	// can be specified when calling [NewArena].
 	//
 	// An Arena must *not* be copied by value, this will invalidate the
-	// atomics protecting allocation operations.
+	// atomics protecting allocation operations. Besides the go vet check, an
+	// arena remembers its own address the first time it is used and any
+	// operation that takes its lock, as well as [Alloc], panics when it is
+	// used through a copy.
 	//
 	// Go is a GC'ed language, so you cannot control exactly when the GC will
 	// free the arena but when it does all of the objects that it stores will
 	// be freed along with it. The GC cleaning up the Arena struct is equivalent
 	// to freeing all of the memory.
 	//
+	// Values whose types hold pointers are placed in buckets that are scanned
+	// by the GC, so values stored in the arena may hold the only reference to
+	// other go heap memory, such as the backing array of a string. Values
+	// without pointers, along with raw memory such as the bytes returned by
+	// [AllocBytes], are placed in separate buckets that are not scanned, so
+	// that arbitrary data is never mistaken for a pointer. Memory that is
+	// rewound with [Reset] or [Truncate] keeps anything it references alive
+	// until it is overwritten or the bucket is released.
+	//
 	// An Arena is thread safe for allocations and frees, though once the arena
 	// is freed all pointers to the data it contained will be invalidated and
 	// set to nil.
+	//
+	// Functions that only report statistics, such as [NumBuckets],
+	// [TotalMemBytes], [NumAllocations] and [WastedBytes], never take the
+	// lock that allocations use so monitoring an arena does not stall
+	// allocations. Each of these values is updated
+	// atomically so it is always internally consistent, but when an arena is
+	// being used concurrently the value may be slightly stale and separate
+	// calls may observe the arena at slightly different points in time.
 	Arena struct {
-		_          noCopy
-		buckets    []bucket
+		_         noCopy
+		writing   atomic.Bool
+		spin      atomic.Int32
+		bump      [numKinds]atomic.Pointer[bumpCursor]
+		chunks    atomic.Pointer[chunkCache]
+		stats     arenaStats
+		lifecycle arenaLifecycle
+		// The address of the arena, set the first time its lock is taken.
+		// It is used to detect copies, see [checkCopy].
+		self *Arena
+		arenaState
+	}
+
+	// Copies of the arenas counters that can be read without taking the lock.
+	// They are updated by [publishStats] whenever the counters they mirror
+	// change.
+	arenaStats struct {
+		numBuckets  atomic.Int64
+		peakBuckets atomic.Int64
+		curBucket   atomic.Int64
+		bytesLeft   atomic.Uintptr
+		bucketSize  atomic.Uintptr
+		totalBytes  atomic.Uintptr
+		// The size of the current bucket, which only differs from bucketSize
+		// for arenas that use [ExponentialGrowth].
+		curBucketSize atomic.Uintptr
+		// The counters of the same name in arenaState, as of the last time
+		// the lock was released. Allocations that were made without the lock
+		// since then are added by the readers, see [pendingCounts].
+		allocs        atomic.Uint64
+		wastedBytes   atomic.Uintptr
+		freshBuckets  atomic.Uint64
+		reusedBuckets atomic.Uint64
+	}
+
+	// All of the state of an [Arena] that describes its contents. This is
+	// kept separate from the fields that protect the arena so that the
+	// contents of two arenas can be exchanged by [Swap] without copying the
+	// atomics.
+	arenaState struct {
+		buckets []bucket
+		// The combined length of the buckets up to and including the bucket
+		// at the same index in buckets, see [appendBucket].
+		bucketEnds []uintptr
 		curBucket  int
 		bytesLeft  uintptr
+		// The size of the current bucket. Every bucket has this size unless
+		// the arena uses [ExponentialGrowth], see [bucketSizeAt].
 		bucketSize uintptr
-		writing    atomic.Bool
+		// The kind of memory of each bucket, see [bucketKind].
+		kinds []bucketKind
+		// The kind of the values that are allocated from the current bucket.
+		// The position that values of the other kind are allocated from is
+		// parked until they are allocated again, see [useKind].
+		kind   bucketKind
+		parked lanePos
+		// The growth policy along with the size of the first bucket and the
+		// largest bucket size for [ExponentialGrowth].
+		growth         GrowthPolicy
+		baseBucketSize uintptr
+		maxBucketSize  uintptr
+		// The allocator used to create new buckets. A nil allocator means
+		// buckets are allocated on the go heap.
+		allocator bucketAllocator
+		// The cumulative number of buckets that were newly allocated and the
+		// cumulative number of times an existing bucket was reused.
+		freshBuckets  uint64
+		reusedBuckets uint64
+		// The cumulative number of bytes that were skipped over without being
+		// handed out, either as alignment padding or as the unused end of a
+		// bucket that was too small for the next value.
+		wastedBytes uintptr
+		// The number of times the arena has been reset or cleared.
+		generation uint64
+		// The largest number of buckets the arena has held at once since it
+		// was created or last cleared.
+		peakBuckets int
+		// The largest number of bytes the arena has had in use at once since
+		// it was created or last cleared, as of the last time the arena was
+		// rewound. See [HighWaterMark].
+		highWater uintptr
+		// The number of individual values allocated since the arena was last
+		// reset or cleared, see [NumAllocations].
+		allocs uint64
+		// Memory in buckets of the current kind that was returned to the arena
+		// with [Free]. Nil until the first call to [Free].
+		free          *freeLists
+		coalesceFrees bool
+		// The number of bytes in each bucket that are handed out to
+		// allocations, excluding alignment padding, unused space and freed
+		// memory. Buckets past the end of this slice hold no payload.
+		payload []uintptr
+		// The generation stamp of each bucket, see [bucketGen]. Buckets past
+		// the end of this slice have not been stamped yet.
+		gens    []uint64
+		lastGen uint64
+		debug   *debugState
+		// The longest time allocating a new bucket may take, see
+		// [SetGrowDeadline]. The bucket of each kind that is still being
+		// allocated after the deadline was missed, if any, is received from
+		// pendingBuckets.
+		growDeadline   time.Duration
+		pendingBuckets [numKinds]chan bucket
+		// The memory that backs strings allocated with
+		// [AllocStringImmutable]. Nil until the first such allocation.
+		readOnly *readOnlyRegions
+		// True if the arena must never allocate more than one bucket, see
+		// [NewFixedArena].
+		fixed bool
+		// True if the arena was not created with a constructor and was
+		// initialized with the default bucket size on first use.
+		zeroValue bool
+		// The cursor that was last opened for lock free allocation, which is
+		// reopened rather than replaced while the current bucket is unchanged.
+		cursor *bumpCursor
+		// Dedicated buckets that each hold a single value that was too large
+		// for a regular bucket, see [AllocLarge], their kinds and their total
+		// size.
+		large      []bucket
+		largeKinds []bucketKind
+		largeBytes uintptr
+		// The most memory the arena may hold, see [SetMaxBytes]. Zero means
+		// there is no limit.
+		maxBytes uintptr
+	}
+
+	// Provides the memory that backs an arenas buckets. All methods are only
+	// ever called while the arenas lock is held.
+	bucketAllocator interface {
+		// Returns a new bucket of exactly the requested size and kind, or nil
+		// if the memory could not be allocated. Allocators whose memory does
+		// not live on the go heap are only ever asked for [plainKind].
+		alloc(size uintptr, kind bucketKind) bucket
+		// Releases a bucket that was previously returned by alloc along with
+		// the kind it was allocated with.
+		free(b bucket, kind bucketKind)
+		// Returns true if the buckets returned by alloc live on the go heap.
+		// Weak pointers cannot reference memory that is not on the go heap.
+		onHeap() bool
 	}
 )
 
@@ -54,103 +211,1385 @@ const (
 	// 64 Kib. The default bucket size used when a bucket size <=0 is supplied
 	// to [NewArena].
 	DefaultBlockSize uintptr = 65536
+	// The alignment of the first byte of every bucket that is allocated on the
+	// go heap.
+	CacheLineSize uintptr = 64
 )
 
 var (
 	ValueToLargeErr = errors.New(
 		"The supplied value was to large to place in the arena",
 	)
+	BucketAllocationErr = errors.New(
+		"The memory for a new bucket could not be allocated",
+	)
+	NonHeapMemoryErr = errors.New(
+		"A weak pointer cannot reference arena memory that is not on the go heap",
+	)
+	GrowDeadlineErr = errors.New(
+		"The arena could not allocate a new bucket before the grow deadline",
+	)
+	OutOfSpaceErr = errors.New(
+		"The fixed size arena does not have enough space left",
+	)
+	OutOfMemoryErr = errors.New(
+		"Growing the arena would exceed the maximum number of bytes it may hold",
+	)
+	InvalidLengthErr   = errors.New("The supplied length must not be negative")
+	InvalidCapacityErr = errors.New(
+		"The supplied capacity must not be less than the length",
+	)
+	InvalidAlignmentErr = errors.New(
+		"The supplied alignment must be a positive power of two",
+	)
+	MismatchedLengthsErr = errors.New(
+		"The supplied slices must have the same length",
+	)
+	CopiedArenaErr = errors.New(
+		"The arena was copied by value after it was first used",
+	)
 )
 
 // Lock is a no-op used by -copylocks checker from `go vet`.
 func (*noCopy) Lock()   {}
 func (*noCopy) Unlock() {}
 
-func newBucket(size uintptr) bucket {
-	return make(bucket, size, size)
+// Allocates a bucket of `kind` on the go heap whose first byte is aligned to
+// [CacheLineSize] bytes, so that the start of a bucket never shares a cache
+// line with unrelated memory.
+func newBucket(size uintptr, kind bucketKind) bucket {
+	b, off := newBucketAt(size, kind)
+	return b[off : off+size : off+size]
+}
+
+// Behaves the same as [newBucket], except that the whole memory that was
+// allocated is returned along with the offset of the bucket into it. The first
+// byte of the returned memory is the start of the allocation.
+func newBucketAt(size uintptr, kind bucketKind) (bucket, uintptr) {
+	b := makeBucket(size, kind)
+	if uintptr(unsafe.Pointer(unsafe.SliceData(b)))%CacheLineSize == 0 {
+		return b, 0
+	}
+	b = makeBucket(size+CacheLineSize-1, kind)
+	addr := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+	return b, alignUp(addr, CacheLineSize) - addr
+}
+
+// Allocates `size` bytes of `kind` on the go heap. Memory of [scanKind] is
+// allocated as pointer words and then viewed as bytes, so that the garbage
+// collector scans it and sees the pointers that are stored in it, such as the
+// backing array of a string field. Without this it could free the memory they
+// reference while the arena still holds them.
+func makeBucket(size uintptr, kind bucketKind) bucket {
+	if kind == plainKind {
+		return make(bucket, size)
+	}
+	words := make(
+		[]unsafe.Pointer,
+		(size+unsafe.Sizeof(unsafe.Pointer(nil))-1)/
+			unsafe.Sizeof(unsafe.Pointer(nil)),
+	)
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(words))), size)
+}
+
+// Creates the next bucket of `kind` using the arenas allocator, sized according
+// to the arenas growth policy. If a grow deadline was set
+// with [SetGrowDeadline] and the bucket is not allocated in time a
+// [GrowDeadlineErr] is returned, and the bucket is picked up by the next call
+// for the same kind once it is ready. The caller must hold the arenas lock.
+func allocBucket(a *Arena, kind bucketKind) (bucket, error) {
+	size := bucketSizeAt(a, len(a.buckets))
+	if err := checkMaxBytes(a, size); err != nil {
+		return nil, err
+	}
+	var b bucket
+	if a.growDeadline <= 0 && a.pendingBuckets[kind] == nil {
+		b = newAllocatorBucket(a.allocator, size, kind)
+	} else {
+		if a.pendingBuckets[kind] == nil {
+			c := make(chan bucket, 1)
+			go func(alloc bucketAllocator, size uintptr) {
+				c <- newAllocatorBucket(alloc, size, kind)
+			}(a.allocator, size)
+			a.pendingBuckets[kind] = c
+		}
+		timer := time.NewTimer(a.growDeadline)
+		defer timer.Stop()
+		select {
+		case b = <-a.pendingBuckets[kind]:
+			a.pendingBuckets[kind] = nil
+		case <-timer.C:
+			return nil, sberr.Wrap(
+				GrowDeadlineErr,
+				"Bucket size: %d Deadline: %s", size, a.growDeadline,
+			)
+		}
+	}
+	if b == nil {
+		return nil, sberr.Wrap(
+			BucketAllocationErr, "Bucket size: %d", size,
+		)
+	}
+	a.freshBuckets++
+	return b, nil
+}
+
+// Returns an [OutOfMemoryErr] if growing the arena by `size` bytes would push
+// its total memory over the cap set with [SetMaxBytes]. The caller must hold
+// the arenas lock.
+func checkMaxBytes(a *Arena, size uintptr) error {
+	if a.maxBytes > 0 && totalBytes(a)+size > a.maxBytes {
+		return sberr.Wrap(
+			OutOfMemoryErr,
+			"Total bytes: %d Requested: %d Max bytes: %d",
+			totalBytes(a), size, a.maxBytes,
+		)
+	}
+	return nil
+}
+
+// Creates a new bucket of `kind` with the supplied allocator, where a nil
+// allocator means the bucket is allocated on the go heap.
+func newAllocatorBucket(
+	alloc bucketAllocator,
+	size uintptr,
+	kind bucketKind,
+) bucket {
+	if alloc == nil {
+		return newBucket(size, kind)
+	}
+	return alloc.alloc(size, kind)
+}
+
+// Releases every bucket starting at index `from` using the arenas allocator,
+// along with any bucket that is still being allocated after missing its grow
+// deadline. The caller must hold the arenas lock.
+func freeBuckets(a *Arena, from int) {
+	for kind, c := range a.pendingBuckets {
+		if c == nil {
+			continue
+		}
+		// Wait so the allocator is never used by two goroutines at once.
+		if b := <-c; b != nil && a.allocator != nil {
+			a.allocator.free(b, bucketKind(kind))
+		}
+		a.pendingBuckets[kind] = nil
+	}
+	if a.allocator == nil {
+		return
+	}
+	for i := from; i < len(a.buckets); i++ {
+		a.allocator.free(a.buckets[i], a.kinds[i])
+	}
+}
+
+// Sets the longest time the arena may spend allocating a new bucket when an
+// allocation requires it to grow. If the bucket is not ready in time the
+// allocation returns a [GrowDeadlineErr] rather than waiting. The allocation
+// of the bucket continues in the background and the bucket is used by the
+// next allocation that has to grow. This bounds the latency of allocations
+// when buckets are very large and slow to allocate. It does not bound the time
+// spent waiting to acquire the arenas lock.
+//
+// A deadline <=0 disables the deadline, which is the default.
+func SetGrowDeadline(a *Arena, d time.Duration) {
+	lock(a)
+	defer unlock(a)
+	a.growDeadline = d
+}
+
+// Sets the most memory the arena may hold, as reported by [TotalMemBytes].
+// Once growing the arena by another bucket would exceed `max`, allocations that
+// need a new bucket return an [OutOfMemoryErr] rather than growing it. The cap
+// is only checked when the arena grows, so an arena that already holds more
+// than `max` bytes keeps its memory and allocations that fit in it still
+// succeed.
+//
+// A max of 0 means the arena may grow without limit, which is the default.
+func SetMaxBytes(a *Arena, max uintptr) {
+	lock(a)
+	defer unlock(a)
+	a.maxBytes = max
+}
+
+// Returns an error if weak pointers cannot be made to the arenas memory.
+func checkOnHeap(a *Arena) error {
+	if a.allocator != nil && !a.allocator.onHeap() {
+		return NonHeapMemoryErr
+	}
+	return nil
+}
+
+// Publishes the arenas counters so they can be read without taking the lock.
+// Any counters that are derived from the arenas state, such as the peak number
+// of buckets, are also updated. This is done every time the lock is released,
+// see [unlock], so the published counters never lag behind the arenas state
+// once the lock is free. The caller must hold the arenas lock.
+func publishStats(a *Arena) {
+	a.peakBuckets = max(a.peakBuckets, len(a.buckets))
+	a.stats.numBuckets.Store(int64(len(a.buckets)))
+	a.stats.peakBuckets.Store(int64(a.peakBuckets))
+	a.stats.curBucket.Store(int64(a.curBucket))
+	a.stats.bytesLeft.Store(a.bytesLeft)
+	a.stats.bucketSize.Store(initialBucketSize(a))
+	a.stats.totalBytes.Store(totalBytes(a))
+	a.stats.curBucketSize.Store(a.bucketSize)
+	a.stats.allocs.Store(a.allocs)
+	a.stats.wastedBytes.Store(a.wastedBytes)
+	a.stats.freshBuckets.Store(a.freshBuckets)
+	a.stats.reusedBuckets.Store(a.reusedBuckets)
+}
+
+// Acquires the arenas write lock, spinning until it becomes available. Between
+// failed attempts the goroutine waits according to the arenas [SpinStrategy],
+// which by default yields the processor so that a goroutine waiting on the
+// lock does not starve the goroutine that holds it when there are more
+// goroutines than cores.
+func lock(a *Arena) {
+	for i := 0; !tryLock(a); i++ {
+		spinWait(a, i)
+	}
+}
+
+// Acquires the arenas write lock like [lock], giving up and returning the
+// contexts error if `ctx` is done before the lock could be acquired.
+func lockCtx(ctx context.Context, a *Arena) error {
+	for i := 0; !tryLock(a); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		spinWait(a, i)
+	}
+	return nil
+}
+
+// Makes a single attempt at acquiring the arenas write lock, returning true if
+// it was acquired.
+func tryLock(a *Arena) bool {
+	if !tryLockAlloc(a) {
+		return false
+	}
+	sealChunks(a)
+	return true
+}
+
+// Acquires the arenas write lock like [lock], except that the chunks that
+// goroutines allocate from are left open, see [chunk]. This may only be used
+// by allocations, which never touch the memory the chunks were carved from.
+func lockAlloc(a *Arena) {
+	for i := 0; !tryLockAlloc(a); i++ {
+		spinWait(a, i)
+	}
+}
+
+// Makes a single attempt at acquiring the arenas write lock like [lockAlloc],
+// returning true if it was acquired.
+func tryLockAlloc(a *Arena) bool {
+	if !a.writing.CompareAndSwap(false, true) {
+		return false
+	}
+	checkCopy(a)
+	sealBump(a)
+	if a.bucketSize == 0 {
+		initZeroValue(a)
+	}
+	if a.debug != nil {
+		a.debug.lockedAt = time.Now()
+	}
+	return true
+}
+
+// Panics with a [CopiedArenaErr] if `a` is a copy of an arena that was already
+// used, otherwise records the arenas address if it was not used yet. Go vet
+// catches most copies, but not those made through interfaces or reflection,
+// and using a copy would corrupt both arenas since they share buckets and the
+// lock free cursor. The caller must hold the arenas lock, which is released
+// before panicking.
+func checkCopy(a *Arena) {
+	if a.self == a {
+		return
+	}
+	if a.self == nil {
+		a.self = a
+		return
+	}
+	a.writing.Store(false)
+	panic(CopiedArenaErr)
+}
+
+// Releases the arenas write lock.
+func unlock(a *Arena) {
+	if a.debug != nil {
+		a.debug.lockHeld += time.Since(a.debug.lockedAt)
+	}
+	openBump(a)
+	publishStats(a)
+	a.writing.Store(false)
+}
+
+// Initializes a zero value arena, which was not created with any of the
+// constructors, to use buckets of [DefaultBlockSize] bytes. The caller must
+// hold the arenas lock.
+func initZeroValue(a *Arena) {
+	a.bucketSize = DefaultBlockSize
+	a.bytesLeft = DefaultBlockSize
+	a.parked = lanePos{bucket: -1}
+	a.kind = scanKind
+	a.zeroValue = true
+	publishStats(a)
+}
+
+// Returns the size of the largest value that can be placed in the current
+// bucket of the arena. This is called without holding the arenas lock, so the
+// value may be stale and the allocation must check the size again once the
+// lock is held. A zero value arena that has not been initialized yet will use
+// [DefaultBlockSize] once it is.
+func maxAllocSize(a *Arena) uintptr {
+	if size := a.stats.curBucketSize.Load(); size != 0 {
+		return size
+	}
+	return DefaultBlockSize
+}
+
+// Rounds `off` up to the next multiple of `align`. `align` must be a power of
+// two.
+func alignUp(off uintptr, align uintptr) uintptr {
+	return (off + align - 1) &^ (align - 1)
 }
 
 // Creates a new [Arena] allocator, initializing it to use `bucketSizeBytes`
 // bucket size.
-func NewArena(bucketSizeBytes uintptr) Arena {
+func NewArena(bucketSizeBytes uintptr) (rv Arena) {
 	if bucketSizeBytes <= 0 {
 		bucketSizeBytes = DefaultBlockSize
 	}
 
-	return Arena{
-		buckets:    []bucket{newBucket(uintptr(bucketSizeBytes))},
-		curBucket:  0,
-		bytesLeft:  uintptr(bucketSizeBytes),
-		bucketSize: uintptr(bucketSizeBytes),
+	rv.arenaState = arenaState{
+		curBucket:    0,
+		bytesLeft:    uintptr(bucketSizeBytes),
+		bucketSize:   uintptr(bucketSizeBytes),
+		kind:         scanKind,
+		parked:       lanePos{bucket: -1},
+		freshBuckets: 1,
+	}
+	appendBucket(
+		&rv, newBucket(uintptr(bucketSizeBytes), scanKind), scanKind,
+	)
+	publishStats(&rv)
+	return
+}
+
+// Creates a new [Arena] allocator, initializing it to use `bucketSizeBytes`
+// bucket size and allocating `numBuckets` buckets up front. Allocations fill the
+// preallocated buckets in order before any new bucket is allocated, so the
+// first `numBuckets` buckets worth of allocations never pay the cost of growing
+// the arena. [NumBuckets] reflects the preallocated buckets immediately while
+// [UsedBytes] stays zero until values are allocated.
+//
+// At least one bucket is always allocated. If `bucketSizeBytes` is <=0 then
+// [DefaultBlockSize] is used.
+func NewArenaWithCapacity(
+	bucketSizeBytes uintptr,
+	numBuckets uintptr,
+) (rv Arena) {
+	rv = NewArena(bucketSizeBytes)
+	for i := uintptr(1); i < numBuckets; i++ {
+		appendBucket(&rv, newBucket(rv.bucketSize, scanKind), scanKind)
+		rv.freshBuckets++
+	}
+	publishStats(&rv)
+	return
+}
+
+// Creates a new [Arena] allocator that allocates `totalBytes` bytes up front and
+// never grows past that. Once the memory is used up allocations return an
+// [OutOfSpaceErr] rather than allocating more memory, giving a hard bound on
+// the memory the arena uses. [Reset] makes the memory available again.
+//
+// All values share the single bucket, so unlike the buckets of other arenas it
+// can not be split by whether the values hold pointers. The bucket is scanned
+// by the garbage collector, which treats every pointer aligned word in it as a
+// pointer, so raw memory such as that returned by [AllocBytes] must not hold
+// integers that look like pointers.
+//
+// If `totalBytes` is <=0 then [DefaultBlockSize] is used.
+func NewFixedArena(totalBytes uintptr) (rv Arena) {
+	rv = NewArena(totalBytes)
+	rv.fixed = true
+	return
+}
+
+// Creates a new [Arena] allocator whose bucket size is the smallest multiple of
+// the aligned size of T that is at least `minBucketBytes`. When T is the
+// dominant type that is allocated this guarantees that no bytes are wasted at
+// the end of a bucket because a value did not fit in the remaining space.
+//
+// If `minBucketBytes` is <=0 then [DefaultBlockSize] is used as the minimum.
+func NewArenaNoWaste[T any](minBucketBytes uintptr) Arena {
+	if minBucketBytes <= 0 {
+		minBucketBytes = DefaultBlockSize
 	}
+	size := alignedSize[T]()
+	if size == 0 {
+		return NewArena(minBucketBytes)
+	}
+	return NewArena((minBucketBytes + size - 1) / size * size)
 }
 
-// Returns the bucket size for the given arena.
+// Returns a [ValueToLargeErr] if a value of type T can not be placed in an
+// arena with buckets of `bucketSize` bytes. This can be called from `init` or
+// from tests to guarantee that allocating a T will never fail with a
+// [ValueToLargeErr] at runtime for a given bucket size.
+func AssertFits[T any](bucketSize uintptr) error {
+	if size := alignedSize[T](); size > bucketSize {
+		return sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, bucketSize,
+		)
+	}
+	return nil
+}
+
+// Returns the size of T rounded up to its alignment, which is the number of
+// bytes that consecutive values of T occupy in an arena.
+func alignedSize[T any]() uintptr {
+	var tmp T
+	return alignUp(unsafe.Sizeof(tmp), unsafe.Alignof(tmp))
+}
+
+// Returns true if the arena was created with one of the constructors, such as
+// [NewArena]. A zero value arena can still be used, it is initialized to use
+// buckets of [DefaultBlockSize] bytes the first time it is used, but this
+// function will continue to return false for it.
+func IsInitialized(a *Arena) bool {
+	lock(a)
+	defer unlock(a)
+	return !a.zeroValue
+}
+
+// Returns a list of human readable warnings about how the arena is configured
+// that may point to a mistake, such as a zero value arena that silently fell
+// back to the default bucket size because a constructor was not called. The
+// returned list is empty if there is nothing to warn about. This is intended to
+// be logged or checked in tests so that misconfigurations surface early.
+func Warnings(a *Arena) []string {
+	lock(a)
+	defer unlock(a)
+
+	var rv []string
+	if a.zeroValue {
+		rv = append(rv, fmt.Sprintf(
+			"The arena was not created with a constructor and is using the "+
+				"default bucket size of %d bytes",
+			a.bucketSize,
+		))
+	}
+	return rv
+}
+
+// Returns the bucket size for the given arena. For arenas that use
+// [ExponentialGrowth] this is the size of the first bucket.
 func BucketSizeBytes(a *Arena) uintptr {
-	return a.bucketSize
+	return a.stats.bucketSize.Load()
 }
 
 // Gets the number of buckets that the arena has currently allocated.
 func NumBuckets(a *Arena) int {
-	return len(a.buckets)
+	return int(a.stats.numBuckets.Load())
+}
+
+// Gets the largest number of buckets the arena has held at once. This is only
+// reset by [Clear] and its variants, so it reflects the most memory the arena
+// has needed since it was created or last cleared.
+func PeakBuckets(a *Arena) int {
+	return int(a.stats.peakBuckets.Load())
+}
+
+// Gets the number of values that have been allocated since the arena was
+// created or last reset. Every value allocated with [Alloc] and the other
+// functions that allocate individual values, such as [TryAlloc],
+// [AllocStrong], [AllocMany] and [TypedArena.New], is counted. Slices, strings
+// and byte regions are not, nor are zero sized values, which take up no space.
+// Comparing the count against [UsedBytes] gives the average size of the
+// allocated values.
+//
+// The count is set back to zero by [Reset] and [Clear] and their variants, as
+// the memory of the counted values is reused afterwards. [Compact] sets it to
+// the number of values that were kept.
+func NumAllocations(a *Arena) uint64 {
+	allocs, _ := pendingCounts(a)
+	return a.stats.allocs.Load() + allocs
 }
 
 // Returns the total number of bytes the arena has allocated across all
 // buckets.
 func TotalMemBytes(a *Arena) uintptr {
-	return a.bucketSize * uintptr(len(a.buckets))
+	return a.stats.totalBytes.Load()
+}
+
+// Returns the number of bytes the arena has consumed across all buckets. Every
+// bucket before the current bucket is counted in full, including any space at
+// its end that was too small for the value that followed it, along with the
+// used part of the current bucket. Buckets after the current bucket, such as
+// those that are waiting to be reused after a call to [Reset], are not
+// counted. Memory that was returned with [Free] is still counted as used.
+//
+// UsedBytes and [FreeBytes] always add up to [TotalMemBytes] as long as the
+// arena is not being grown concurrently.
+func UsedBytes(a *Arena) uintptr {
+	lock(a)
+	defer unlock(a)
+	return usedBytes(a)
+}
+
+// Returns the number of bytes the arena holds that have not been consumed yet,
+// which is the rest of the current bucket along with every bucket after it. See
+// [UsedBytes] for what is considered consumed.
+func FreeBytes(a *Arena) uintptr {
+	lock(a)
+	defer unlock(a)
+	return totalBytes(a) - usedBytes(a)
+}
+
+// Returns the index of the current bucket and the offset into it where the
+// next allocation will start, before any padding that is needed to align the
+// next value. This is intended for debugging, such as tracking down memory
+// corruption by comparing the position of the arena before and after a
+// suspicious allocation.
+func CurrentOffset(a *Arena) (bucket int, offset uintptr) {
+	lock(a)
+	defer unlock(a)
+	return a.curBucket, a.bucketSize - a.bytesLeft
+}
+
+// Returns the largest number of bytes the arena has had in use at once, as
+// reported by [UsedBytes], since it was created or last cleared. Unlike
+// [UsedBytes] this does not go down when the arena is rewound by [Reset],
+// [Restore] or [Truncate], so it shows how much memory the arena needs at its
+// peak. [Clear] and its variants, as well as [Recycle], reset it to zero.
+func HighWaterMark(a *Arena) uintptr {
+	lock(a)
+	defer unlock(a)
+	return max(a.highWater, usedBytes(a))
+}
+
+// Records the current number of used bytes in the high water mark. This must
+// be called before anything that lowers the number of used bytes, so that
+// allocations never have to update the high water mark themselves. The caller
+// must hold the arenas lock.
+func updateHighWater(a *Arena) {
+	a.highWater = max(a.highWater, usedBytes(a))
+}
+
+// Returns the number of bytes the arena has consumed, see [UsedBytes]. The
+// caller must hold the arenas lock.
+func usedBytes(a *Arena) uintptr {
+	f := frontier(a)
+	if len(a.buckets) == 0 || f < 0 {
+		return a.largeBytes
+	}
+	rv := bucketsBytes(a, f) + bucketUsed(a, f) + a.largeBytes
+	// The other kind allocates from an earlier bucket, whose rest is unused.
+	if o := min(a.curBucket, a.parked.bucket); o >= 0 {
+		rv -= uintptr(len(a.buckets[o])) - bucketUsed(a, o)
+	}
+	return rv
+}
+
+// Returns the ratio of bucket reuses to the total number of buckets the arena
+// has put into use since it was constructed. A bucket is reused when [Reset]
+// causes the arena to start writing to it again rather than allocating a new
+// one.
+//
+// A ratio close to 1 means the arena has reached a steady state where [Reset]
+// recycles its memory and it rarely needs to grow. A ratio close to 0 means the
+// arena keeps allocating new buckets.
+func ReuseRatio(a *Arena) float64 {
+	reused := a.stats.reusedBuckets.Load()
+	total := a.stats.freshBuckets.Load() + reused
+	if total == 0 {
+		return 0
+	}
+	return float64(reused) / float64(total)
+}
+
+// Returns the number of bytes the arena has skipped over without handing them
+// out since it was constructed. Bytes are wasted as padding that is needed to
+// align a value and as the unused end of a bucket when the next value does not
+// fit in it and has to be placed in the following bucket. The end of a bucket
+// that was reused after a call to [Reset] is counted again each time it is
+// skipped.
+//
+// Comparing this to [TotalMemBytes] shows how well the bucket size suits the
+// sizes of the allocated values.
+func WastedBytes(a *Arena) uintptr {
+	_, wasted := pendingCounts(a)
+	return a.stats.wastedBytes.Load() + wasted
+}
+
+// Returns how many more values of type T can be allocated before the arena has
+// to grow. Both the space left in the current bucket and the space in any
+// buckets that were previously allocated but are not in use yet (e.g. after a
+// call to [Reset]) are counted, taking the alignment of T into account.
+//
+// Zero sized types never consume any space, so [math.MaxInt] is returned for
+// them. If T is larger than the bucket size 0 is returned.
+func Capacity[T any](a *Arena) int {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	align := unsafe.Alignof(tmp)
+
+	lock(a)
+	defer unlock(a)
+	return capacity(a, size, align, kindOf[T]())
 }
 
+// Returns how many more values of the supplied size, alignment and kind can be
+// allocated before the arena has to grow. The caller must hold the arenas
+// lock.
+func capacity(a *Arena, size uintptr, align uintptr, kind bucketKind) int {
+	defer withKind(a, kind)()
+	if size > a.bucketSize || len(a.buckets) == 0 {
+		return 0
+	}
+	if size == 0 {
+		return math.MaxInt
+	}
+
+	rv := 0
+	next, takeOver := nextBucket(a)
+	if a.curBucket >= 0 {
+		if off := alignUp(a.bucketSize-a.bytesLeft, align); off <= a.bucketSize {
+			rv += int((a.bucketSize - off) / size)
+		}
+	}
+	if takeOver {
+		rv += int(bucketSizeAt(a, next) / size)
+		next++
+	}
+	for i := next; i < len(a.buckets); i++ {
+		rv += int(bucketSizeAt(a, i) / size)
+	}
+	return rv
+}
+
+// Ensures the arena has enough buckets to hold `count` more values of type T
+// without growing, allocating any additional buckets that are needed up front.
+// The space left in the current bucket and in any unused buckets is taken into
+// account, along with the alignment of T and the space at the end of each
+// bucket that is too small to hold another T. Afterwards [Capacity] for T
+// returns at least `count`.
+//
+// A [ValueToLargeErr] is returned if T does not fit in a bucket and an
+// [OutOfSpaceErr] is returned for fixed arenas that do not have enough space.
+// Any buckets that were allocated before an error occurred are kept.
+func ReserveFor[T any](a *Arena, count int) error {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	align := unsafe.Alignof(tmp)
+	if size > maxAllocSize(a) {
+		return sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	defer unlock(a)
+	defer publishStats(a)
+
+	kind := kindOf[T]()
+	if !hasKinds(a) {
+		kind = a.kind
+	}
+	have := capacity(a, size, align, kind)
+	if size == 0 || count <= have {
+		return nil
+	}
+	for have < count {
+		if a.fixed && len(a.buckets) > 0 {
+			return sberr.Wrap(
+				OutOfSpaceErr,
+				"Requested count: %d Capacity: %d", count, have,
+			)
+		}
+		b, err := allocBucket(a, kind)
+		if err != nil {
+			return err
+		}
+		appendBucket(a, b, kind)
+		have += int(uintptr(len(b)) / size)
+	}
+	return nil
+}
+
+// The address that is returned for every allocation of a zero sized value.
+// Zero sized values never take up any space in a bucket, so they all share it.
+// It is word sized so that it satisfies the alignment of any type.
+var zeroSizeBase uintptr
+
 // Allocates enough space in the arena to hold a value of type T. The size of T
 // must be less than the bucket size the allocator was initialized with,
-// otherwise a [ValueToLargeErr] will be returned.
+// otherwise a [ValueToLargeErr] will be returned. The returned memory is
+// always aligned to the alignment of T, with any padding that is needed to
+// reach that alignment taken from the current bucket.
+//
+// Memory that was returned to the arena with [Free] is reused before any new
+// memory is taken from the current bucket.
+//
+// Zero sized values never take up any space and all share a single address
+// that does not belong to any bucket.
+//
+// Values that fit in the rest of the current bucket are allocated without
+// taking the arenas lock by atomically advancing a cursor into the bucket, so
+// concurrent calls to Alloc do not serialize. Once goroutines contend on the
+// cursor, small values are instead allocated from chunks of a few KiB that
+// are handed out to each P, so that goroutines running in parallel do not
+// share the cursor either. The lock is only taken when a new bucket or chunk
+// is needed, when freed memory is available for reuse, or when the arena is
+// in debug mode.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+//
+// Alloc is the same as calling [Arena.AllocRaw] with the size and alignment of
+// T, except that a weak pointer is returned rather than an unsafe pointer.
 func Alloc[T any](a *Arena) (weak.Pointer[T], error) {
+	var tmp T
+	ptr, err := allocRaw(
+		a, unsafe.Sizeof(tmp), unsafe.Alignof(tmp), kindOf[T](),
+	)
+	if err != nil {
+		return weak.Make[T](nil), err
+	}
+	return weak.Make((*T)(ptr)), nil
+}
+
+// Behaves the same as [Alloc] except that it never waits for the arenas lock.
+// If the value cannot be allocated without taking the lock and the lock is
+// held by another goroutine, false is returned immediately along with a nil
+// weak pointer and a nil error. This allows callers under heavy contention to
+// fall back to a different arena or to the go heap instead of blocking.
+//
+// When true is returned the result is identical to calling [Alloc], including
+// any error that is returned.
+func TryAlloc[T any](a *Arena) (weak.Pointer[T], bool, error) {
 	var tmp T
 	size := unsafe.Sizeof(tmp)
-	if size > a.bucketSize {
+	align := unsafe.Alignof(tmp)
+	if size > maxAllocSize(a) {
+		return weak.Make[T](nil), true, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+	if size == 0 {
+		return weak.Make((*T)(unsafe.Pointer(&zeroSizeBase))), true, nil
+	}
+	kind := kindOf[T]()
+	if ptr := bumpAlloc(a, size, align, kind); ptr != nil {
+		return weak.Make((*T)(ptr)), true, nil
+	}
+
+	if !tryLockAlloc(a) {
+		return weak.Make[T](nil), false, nil
+	}
+	ptr, err := allocLocked(a, size, align, kind)
+	if err != nil {
+		unlock(a)
+		return weak.Make[T](nil), true, err
+	}
+	recordAlloc(a, size)
+	unlock(a)
+
+	return weak.Make((*T)(ptr)), true, nil
+}
+
+// Allocates a value of type T just like [Alloc], except that waiting for the
+// arenas lock is abandoned once `ctx` is done, in which case the contexts error
+// is returned. The context is only consulted while waiting for the lock, an
+// allocation that does not have to wait always succeeds.
+func AllocCtx[T any](ctx context.Context, a *Arena) (weak.Pointer[T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	align := unsafe.Alignof(tmp)
+	if size > maxAllocSize(a) {
 		return weak.Make[T](nil), sberr.Wrap(
 			ValueToLargeErr,
 			"Requested size: %d Got Size: %d",
-			size, a.bucketSize,
+			size, maxAllocSize(a),
 		)
 	}
+	if size == 0 {
+		return weak.Make((*T)(unsafe.Pointer(&zeroSizeBase))), nil
+	}
+	kind := kindOf[T]()
+	if ptr := bumpAlloc(a, size, align, kind); ptr != nil {
+		return weak.Make((*T)(ptr)), nil
+	}
 
-	for !a.writing.CompareAndSwap(false, true) {
+	if err := lockCtx(ctx, a); err != nil {
+		return weak.Make[T](nil), err
 	}
+	ptr, err := allocLocked(a, size, align, kind)
+	if err != nil {
+		unlock(a)
+		return weak.Make[T](nil), err
+	}
+	recordAlloc(a, size)
+	unlock(a)
 
-	if len(a.buckets) == 0 {
-		a.buckets = append(a.buckets, newBucket(a.bucketSize))
-		a.bytesLeft = a.bucketSize
-		a.curBucket = 0
-	} else if a.bytesLeft < size {
-		if a.curBucket == len(a.buckets)-1 {
-			a.buckets = append(a.buckets, newBucket(a.bucketSize))
+	return weak.Make((*T)(ptr)), nil
+}
+
+// Allocates `n` values of type T, taking the arenas lock only once for the
+// whole batch rather than once per value. The values are placed one after the
+// other, moving on to the next bucket whenever the current one is full, so
+// each value is contiguous but the batch as a whole may span several buckets.
+// Memory that was returned with [Free] is not reused.
+//
+// The size of T must be less than the bucket size, otherwise a
+// [ValueToLargeErr] will be returned. A negative `n` will return an
+// [InvalidLengthErr]. If the arena can not hold all `n` values, such as when a
+// new bucket can not be allocated, the error is returned and the arena is left
+// as it was before the call.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocMany[T any](a *Arena, n int) ([]weak.Pointer[T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	align := unsafe.Alignof(tmp)
+	if n < 0 {
+		return nil, sberr.Wrap(InvalidLengthErr, "Length: %d", n)
+	}
+	if size > maxAllocSize(a) {
+		return nil, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+	rv := make([]weak.Pointer[T], n)
+	if size == 0 {
+		for i := range rv {
+			rv[i] = weak.Make((*T)(unsafe.Pointer(&zeroSizeBase)))
 		}
-		a.curBucket++
-		a.bytesLeft = a.bucketSize
+		return rv, nil
 	}
 
-	ptr := unsafe.Pointer(&a.buckets[a.curBucket][a.bucketSize-a.bytesLeft])
-	a.bytesLeft -= size
-	a.writing.Store(false)
+	lock(a)
+	defer unlock(a)
+	if err := checkOnHeap(a); err != nil {
+		return nil, err
+	}
+	m := mark(a)
+	kind := kindOf[T]()
+	for i := range rv {
+		bucketIdx, off, err := reserve(a, size, align, kind)
+		if err != nil {
+			restore(a, m)
+			publishStats(a)
+			return nil, err
+		}
+		rv[i] = weak.Make((*T)(unsafe.Pointer(&a.buckets[bucketIdx][off])))
+	}
+	a.allocs += uint64(n)
+	recordAlloc(a, uintptr(n)*size)
+	publishStats(a)
+	return rv, nil
+}
+
+// Allocates `size` bytes aligned to `align` in a bucket of `kind` for [Alloc]
+// and [TryAlloc], reusing free memory before taking memory from the current
+// bucket. The caller must hold the arenas lock and must have already checked
+// that `size` is not larger than the bucket size.
+func allocLocked(
+	a *Arena,
+	size uintptr,
+	align uintptr,
+	kind bucketKind,
+) (unsafe.Pointer, error) {
+	if err := checkOnHeap(a); err != nil {
+		return nil, err
+	}
+	useKind(a, kind)
+	// Small values are placed at their natural alignment, which only covers
+	// the requested alignment when it is not larger than the size.
+	if align <= size {
+		if ptr := allocSmall(a, size); ptr != nil {
+			a.allocs++
+			publishStats(a)
+			return ptr, nil
+		}
+	}
+	if ptr := popFree(a, size, align); ptr != nil {
+		a.allocs++
+		return ptr, nil
+	}
+	bucketIdx, off, err := reserve(a, size, align, kind)
+	if err != nil {
+		return nil, err
+	}
+	a.allocs++
+	publishStats(a)
+	return unsafe.Pointer(&a.buckets[bucketIdx][off]), nil
+}
+
+// Allocates enough space in the arena to hold a value of type T and sets `*out`
+// to a strong pointer to it, matching the out parameter style some generated
+// code uses. The size of T must be less than the bucket size the allocator was
+// initialized with, otherwise a [ValueToLargeErr] will be returned and `*out`
+// is left unchanged.
+//
+// Memory that was returned to the arena with [Free] is reused before any new
+// memory is taken from the current bucket. Unlike [Alloc] this can be used with
+// arenas whose memory does not live on the go heap because no weak pointer is
+// created. The strong pointer keeps the arenas memory alive, so it will not be
+// set to nil by [Clear].
+func AllocInto[T any](a *Arena, out **T) error {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	align := unsafe.Alignof(tmp)
+	if size > maxAllocSize(a) {
+		return sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+	if size == 0 {
+		*out = (*T)(unsafe.Pointer(&zeroSizeBase))
+		return nil
+	}
+
+	lock(a)
+	kind := kindOf[T]()
+	useKind(a, kind)
+	if ptr := popFree(a, size, align); ptr != nil {
+		a.allocs++
+		recordAlloc(a, size)
+		unlock(a)
+		*out = (*T)(ptr)
+		return nil
+	}
+	bucketIdx, off, err := reserve(a, size, align, kind)
+	if err != nil {
+		unlock(a)
+		return err
+	}
+	ptr := unsafe.Pointer(&a.buckets[bucketIdx][off])
+	a.allocs++
+	recordAlloc(a, size)
+	publishStats(a)
+	unlock(a)
+
+	*out = (*T)(ptr)
+	return nil
+}
+
+// Allocates enough space in the arena to hold a value of type T and returns a
+// strong pointer to it. This avoids having to call Value and check for nil on
+// every access when the caller knows the arena outlives the reference. The size
+// of T must be less than the bucket size the allocator was initialized with,
+// otherwise a [ValueToLargeErr] will be returned.
+//
+// The returned pointer must not be used after [Clear] is called. For arenas on
+// the go heap the pointer keeps the memory alive, but the memory no longer
+// belongs to the arena, and for arenas whose memory does not live on the go
+// heap the memory is released. The same as with [Alloc], the value may be
+// overwritten by later allocations after the arena is rewound with [Reset].
+//
+// Memory that was returned to the arena with [Free] is reused before any new
+// memory is taken from the current bucket.
+func AllocStrong[T any](a *Arena) (*T, error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	align := unsafe.Alignof(tmp)
+	if size > maxAllocSize(a) {
+		return nil, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+	if size == 0 {
+		return (*T)(unsafe.Pointer(&zeroSizeBase)), nil
+	}
+	kind := kindOf[T]()
+	if ptr := bumpAlloc(a, size, align, kind); ptr != nil {
+		return (*T)(ptr), nil
+	}
+
+	lock(a)
+	useKind(a, kind)
+	if ptr := popFree(a, size, align); ptr != nil {
+		a.allocs++
+		recordAlloc(a, size)
+		unlock(a)
+		return (*T)(ptr), nil
+	}
+	bucketIdx, off, err := reserve(a, size, align, kind)
+	if err != nil {
+		unlock(a)
+		return nil, err
+	}
+	ptr := unsafe.Pointer(&a.buckets[bucketIdx][off])
+	a.allocs++
+	recordAlloc(a, size)
+	publishStats(a)
+	unlock(a)
+
+	return (*T)(ptr), nil
+}
+
+// Allocates a zeroed value of type T in the arena and returns a strong pointer
+// to it, mirroring the builtin `new`. The pointer keeps the arenas memory alive
+// for as long as it is reachable. Any error returned by [AllocInto] is
+// returned.
+func New[T any](a *Arena) (*T, error) {
+	var rv *T
+	if err := AllocInto(a, &rv); err != nil {
+		return nil, err
+	}
+	var zero T
+	*rv = zero
+	return rv, nil
+}
+
+// Allocates enough space in the arena to hold a value of type T and copies `v`
+// into it, so the value is never visible in the arena uninitialized. The copy
+// is shallow, any memory that `v` references is not copied into the arena. Any
+// error returned by [Alloc] is returned.
+func AllocCopy[T any](a *Arena, v T) (weak.Pointer[T], error) {
+	rv, err := Alloc[T](a)
+	if err != nil {
+		return rv, err
+	}
+	*rv.Value() = v
+	return rv, nil
+}
+
+// Allocates enough space in the arena to hold a value of type T, guaranteeing
+// that the value lies entirely within a single bucket. If the rest of the
+// current bucket is too small to hold the value the remaining bytes are left
+// unused and the value is placed at the start of the next bucket, it is never
+// split across buckets. This makes it suitable for buffers that must not cross
+// a bucket boundary, such as those handed to hardware. The size of T must be
+// less than the bucket size the allocator was initialized with, otherwise a
+// [ValueToLargeErr] will be returned.
+//
+// Unlike [Alloc] memory returned with [Free] is never reused, the value is
+// always taken from the current bucket.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocContiguous[T any](a *Arena) (weak.Pointer[T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if size > maxAllocSize(a) {
+		return weak.Make[T](nil), sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+	if size == 0 {
+		return weak.Make((*T)(unsafe.Pointer(&zeroSizeBase))), nil
+	}
+
+	lock(a)
+	if err := checkOnHeap(a); err != nil {
+		unlock(a)
+		return weak.Make[T](nil), err
+	}
+	bucketIdx, off, err := reserve(a, size, unsafe.Alignof(tmp), kindOf[T]())
+	if err != nil {
+		unlock(a)
+		return weak.Make[T](nil), err
+	}
+	ptr := unsafe.Pointer(&a.buckets[bucketIdx][off])
+	a.allocs++
+	recordAlloc(a, size)
+	publishStats(a)
+	unlock(a)
 
 	return weak.Make((*T)(ptr)), nil
 }
 
+// Returns a slice over all of the bytes that remain in the current bucket and
+// marks them as used, so the next allocation will move to the next bucket. The
+// length of the returned slice is however many bytes were left, making this
+// useful as a scratch buffer that is sized opportunistically. Nil is returned
+// if the current bucket has no space left or the arena has no buckets.
+//
+// The bytes are taken from the current bucket of the values without pointers,
+// see [Arena]. Nil is also returned if there is no such bucket, as is the case
+// when only values with pointers were allocated since the arena was rewound.
+func AllocRemaining(a *Arena) []byte {
+	lock(a)
+	defer unlock(a)
+
+	useKind(a, plainKind)
+	if a.bytesLeft == 0 || len(a.buckets) == 0 {
+		return nil
+	}
+	off := a.bucketSize - a.bytesLeft
+	recordAlloc(a, a.bytesLeft)
+	addPayload(a, a.curBucket, a.bytesLeft)
+	a.bytesLeft = 0
+	publishStats(a)
+	return a.buckets[a.curBucket][off:a.bucketSize:a.bucketSize]
+}
+
+// The largest size that is bump allocated by [allocSmall].
+const maxSmallSize = 32
+
+// Bump allocates a value whose size is a small power of two directly from the
+// current bucket, skipping the generic size and alignment computations done by
+// [reserve]. Small power of two sizes are by far the most common, so this
+// reduces the per allocation overhead for most workloads. Nil is returned if
+// the fast path does not apply, in which case the generic path must be used:
+// the size is not a small power of two, there is free memory that should be
+// reused first, the arena is in debug mode, or the value does not fit at its
+// natural alignment in the current bucket. The caller must hold the arenas
+// lock.
+func allocSmall(a *Arena, size uintptr) unsafe.Pointer {
+	if size == 0 || size > maxSmallSize || size&(size-1) != 0 ||
+		a.bytesLeft < size || len(a.buckets) == 0 || a.debug != nil ||
+		(a.free != nil && a.free.len > 0) {
+		return nil
+	}
+	off := a.bucketSize - a.bytesLeft
+	if off&(size-1) != 0 {
+		return nil
+	}
+	a.bytesLeft -= size
+	addPayload(a, a.curBucket, size)
+	return unsafe.Pointer(&a.buckets[a.curBucket][off])
+}
+
+// Reserves `size` contiguous bytes in a single bucket of `kind`, growing the
+// arena if needed. The address of the first reserved byte will be a multiple of
+// `align`, which must be a power of two. Returns the index of the bucket and
+// the offset into that bucket where the reserved space starts. The caller must
+// hold the arenas lock and must have already checked that `size` is not larger
+// than the bucket size.
+func reserve(
+	a *Arena,
+	size uintptr,
+	align uintptr,
+	kind bucketKind,
+) (int, uintptr, error) {
+	useKind(a, kind)
+	if len(a.buckets) == 0 {
+		b, err := allocBucket(a, a.kind)
+		if err != nil {
+			return 0, 0, err
+		}
+		appendBucket(a, b, a.kind)
+		a.parked = lanePos{bucket: -1, free: a.parked.free}
+		setCurBucket(a, 0)
+	}
+
+	// An allocation that exactly consumes the rest of a bucket leaves
+	// bytesLeft at zero, in which case any following allocation with a non
+	// zero size moves to the next bucket before an offset is computed. The
+	// same applies when the current kind does not have a bucket yet.
+	// The checks are written so that `size+pad` is never computed, as it can
+	// overflow for pathological sizes and then appear to fit.
+	var pad uintptr
+	if a.curBucket >= 0 {
+		pad = padding(a, align)
+	}
+	if a.curBucket < 0 || size > a.bytesLeft || a.bytesLeft-size < pad {
+		next, takeOver := nextBucket(a)
+		if next == len(a.buckets) && a.fixed {
+			return 0, 0, sberr.Wrap(
+				OutOfSpaceErr,
+				"Requested size: %d Bytes left: %d", size, a.bytesLeft,
+			)
+		}
+		// Moving on would waste the rest of the current bucket, and might
+		// allocate a new one, for a value that can never fit.
+		if !fitsEmptyBucket(a, next, size, align) {
+			return 0, 0, sberr.Wrap(
+				ValueToLargeErr,
+				"Requested size: %d Alignment: %d Got Size: %d",
+				size, align, bucketSizeAt(a, next),
+			)
+		}
+		if err := claimBucket(a, next, takeOver); err != nil {
+			return 0, 0, err
+		}
+
+		pad = padding(a, align)
+		if size > a.bytesLeft || a.bytesLeft-size < pad {
+			publishStats(a)
+			return 0, 0, sberr.Wrap(
+				ValueToLargeErr,
+				"Requested size: %d Alignment: %d Got Size: %d",
+				size, align, a.bucketSize,
+			)
+		}
+	}
+
+	off := a.bucketSize - a.bytesLeft + pad
+	a.bytesLeft -= size + pad
+	a.wastedBytes += pad
+	addPayload(a, a.curBucket, size)
+	return a.curBucket, off, nil
+}
+
+// Returns the number of bytes that need to be skipped in the current bucket so
+// that the next allocation starts at an address that is a multiple of `align`.
+// The caller must hold the arenas lock.
+func padding(a *Arena, align uintptr) uintptr {
+	addr := uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[a.curBucket]))) +
+		a.bucketSize - a.bytesLeft
+	return alignUp(addr, align) - addr
+}
+
+// Returns true if `size` bytes aligned to `align` fit in the bucket at index
+// `i` while it is empty. Buckets that have not been allocated yet are assumed
+// to start at a multiple of [CacheLineSize], as buckets on the go heap do. The
+// caller must hold the arenas lock.
+func fitsEmptyBucket(a *Arena, i int, size uintptr, align uintptr) bool {
+	bucketSize := bucketSizeAt(a, i)
+	var pad uintptr
+	if i < len(a.buckets) {
+		bucketSize = uintptr(len(a.buckets[i]))
+		addr := uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[i])))
+		pad = alignUp(addr, align) - addr
+	} else if align > CacheLineSize {
+		pad = align - CacheLineSize
+	}
+	return size <= bucketSize && bucketSize-size >= pad
+}
+
+// Gives back the last `bytes` bytes of the used region of the current bucket so
+// that the next allocation reuses them, undoing the most recent allocations.
+// This is intended for speculative allocations that are immediately abandoned.
+// `bytes` must match the size of the allocations being undone, truncating
+// part of an allocation will cause later allocations to overlap it. It is
+// limited to the used region of the current bucket, allocations in earlier
+// buckets can not be truncated.
+//
+// All pointers into the truncated region can still be used, though they are no
+// longer guaranteed to point to valid values. Any memory in the truncated
+// region that was returned with [Free] is discarded.
+//
+// Values with and without pointers are placed in different buckets, see
+// [Arena], and the current bucket is the one the most recent allocation was
+// made from.
+func Truncate(a *Arena, bytes uintptr) {
+	lock(a)
+	defer unlock(a)
+	truncate(a, bytes)
+}
+
+// Gives back the last `bytes` bytes of the used region of the current bucket,
+// see [Truncate]. The caller must hold the arenas lock.
+func truncate(a *Arena, bytes uintptr) {
+	if len(a.buckets) == 0 || a.curBucket < 0 {
+		return
+	}
+	updateHighWater(a)
+	bytes = min(bytes, a.bucketSize-a.bytesLeft)
+	a.bytesLeft += bytes
+	freed := discardFreeAfter(
+		a, a.curBucket,
+		uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[a.curBucket])))+
+			a.bucketSize-a.bytesLeft,
+	)
+	// Freed memory is not payload, so it was already subtracted.
+	subPayload(a, a.curBucket, bytes-min(freed, bytes))
+	publishStats(a)
+}
+
+// Undoes the most recent allocation, which must have been a value of type T,
+// so that the next allocation reuses its memory. This is the same as calling
+// [Truncate] with the size of T, and the same restrictions apply: only the
+// immediately preceding allocation can be undone and it must have been taken
+// from the end of the current bucket rather than from memory returned with
+// [Free]. If that allocation started a new bucket the arena rewinds to the
+// start of that bucket, it never moves back into an earlier bucket. Any
+// padding that was needed to align the value is not reclaimed.
+func FreeLast[T any](a *Arena) {
+	var tmp T
+	lock(a)
+	defer unlock(a)
+	useKind(a, kindOf[T]())
+	truncate(a, unsafe.Sizeof(tmp))
+}
+
 // Resets the internal state of the arena so that it starts to reuse memory,
 // overwriting the memory it previously used.
 //
 // No new memory will be allocated and as such all other pointers that reference
 // this arenas memory can still be used, though they are no longer guaranteed to
-// point to valid values.
+// point to valid values. The exception are values allocated in dedicated
+// buckets by [AllocLarge], which are released.
 func Reset(a *Arena) {
-	for !a.writing.CompareAndSwap(false, true) {
+	lock(a)
+	reset(a)
+	unlock(a)
+}
+
+// Zeroes all of the memory the arena has used and then resets it, see [Reset].
+// Values that are allocated after this call start out zeroed even if they are
+// not fully initialized by the caller, and the values that previously lived in
+// the arena cannot be read back through stale pointers. This trades the cost of
+// clearing the used memory for not leaking old values, which matters for
+// security sensitive data.
+//
+// Only memory up to the arenas current position is zeroed. Buckets after the
+// current bucket are left untouched, so memory that was released by an earlier
+// call to [Reset] or [Restore] and not used since then keeps its old contents.
+func ResetZeroed(a *Arena) {
+	lock(a)
+	for i := 0; i < len(a.buckets) && i <= frontier(a); i++ {
+		zeroBucket(a.kinds[i], a.buckets[i][:bucketUsed(a, i)])
 	}
+	reset(a)
+	unlock(a)
+}
 
-	a.bytesLeft = a.bucketSize
-	a.curBucket = 0
+// Resets the arena, see [Reset]. The caller must hold the arenas lock.
+func reset(a *Arena) {
+	updateHighWater(a)
+	if len(a.buckets) > 0 {
+		a.reusedBuckets++
+		useKind(a, a.kinds[0])
+	}
+	a.generation++
+	a.allocs = 0
+	setCurBucket(a, 0)
+	a.free = nil
+	a.parked = lanePos{bucket: -1}
+	a.gens = a.gens[:0]
+	a.payload = a.payload[:0]
+	releaseLarge(a)
+	publishStats(a)
+}
 
-	a.writing.Store(false)
+// Zeroes `b`, which must start at a pointer aligned address in a bucket of
+// `kind`. Buckets of [scanKind] are scanned by the GC, so the pointer aligned
+// part of `b` is cleared as pointer words to let the GC observe the pointers
+// that are overwritten.
+func zeroBucket(kind bucketKind, b []byte) {
+	if kind == plainKind {
+		clear(b)
+		return
+	}
+	words := uintptr(len(b)) / unsafe.Sizeof(unsafe.Pointer(nil))
+	clear(unsafe.Slice(
+		(*unsafe.Pointer)(unsafe.Pointer(unsafe.SliceData(b))), words,
+	))
+	clear(b[words*unsafe.Sizeof(unsafe.Pointer(nil)):])
 }
 
 // Frees all of the memory that the arena allocated. Calling this function will
@@ -159,13 +1598,276 @@ func Reset(a *Arena) {
 // The arena can still be used after this operation, it will allocate more
 // memory as needed. If this arena is used to allocate more memory the old
 // memory will not be reused.
+//
+// Clear may be called while other goroutines are allocating from the arena.
+// Every allocation either completes before the arena is cleared, in which case
+// its value lives in the old memory, or starts after it, in which case its
+// value lives in new memory. No allocation writes into memory that was already
+// released. Once Clear returns the arena no longer references the old memory,
+// so every weak pointer that was returned before the call will resolve to nil
+// after the next garbage collection as long as nothing else keeps a strong
+// pointer to the value.
+//
+// For arenas whose memory does not live on the go heap, such as those created
+// with [NewGuardedArena], the memory is released immediately and accessing it
+// through any previously obtained pointer will fault.
+//
+// If the arena is in debug mode the released memory is overwritten with
+// [PoisonByte] first, see [EnableDebug].
 func Clear(a *Arena) {
-	for !a.writing.CompareAndSwap(false, true) {
+	lock(a)
+
+	clearBuckets(a)
+	publishStats(a)
+
+	unlock(a)
+}
+
+// Frees all of the memory that the arena allocated, the same as [Clear], and
+// then allocates a single fresh bucket. This means the first allocation after
+// clearing does not have to pay the cost of growing the arena. The fresh
+// bucket is new memory, so all pointers that referenced the old memory will
+// still be set to nil.
+//
+// If the fresh bucket cannot be allocated the arena is left without any
+// buckets, the same as after calling [Clear].
+func ClearKeepingOne(a *Arena) {
+	lock(a)
+
+	clearBuckets(a)
+	if b, err := allocBucket(a, a.kind); err == nil {
+		appendBucket(a, b, a.kind)
+	}
+	publishStats(a)
+
+	unlock(a)
+}
+
+// Releases every bucket after the current bucket so that its memory can be
+// reclaimed, which is mainly useful after a call to [Reset] once a burst of
+// allocations has grown the arena far beyond what it normally needs. The
+// current bucket and every bucket before it are left untouched, so all values
+// that were allocated since the arena was last reset remain valid. Any free
+// memory and handles that reference the released buckets are discarded.
+func Shrink(a *Arena) {
+	lock(a)
+	defer unlock(a)
+
+	keep := frontier(a) + 1
+	if keep >= len(a.buckets) {
+		return
+	}
+	// Memory is only freed once it was handed out, so none of the free
+	// memory lies in the released buckets.
+	freeBuckets(a, keep)
+	clear(a.buckets[keep:])
+	a.buckets = a.buckets[:keep]
+	a.bucketEnds = a.bucketEnds[:keep]
+	a.kinds = a.kinds[:keep]
+	if keep < len(a.gens) {
+		a.gens = a.gens[:keep]
+	}
+	if keep < len(a.payload) {
+		a.payload = a.payload[:keep]
+	}
+	publishStats(a)
+}
+
+// Returns the arena to the state a constructor would have created it in: all
+// memory is freed the same as with [Clear], a single fresh bucket is allocated
+// and all counters and statistics, such as [PeakBuckets], [ReuseRatio] and the
+// allocation profile, are reset. Configuration, such as the bucket size, the
+// allocator used for buckets, any options that were set and debug mode, is
+// kept. This is intended for isolating tests from each other and for reusing
+// arenas from a pool.
+//
+// If the fresh bucket cannot be allocated the arena is left without any
+// buckets, the same as after calling [Clear].
+func ResetToNew(a *Arena) {
+	lock(a)
+
+	clearBuckets(a)
+	a.generation = 0
+	a.freshBuckets = 0
+	a.reusedBuckets = 0
+	a.wastedBytes = 0
+	if b, err := allocBucket(a, a.kind); err == nil {
+		appendBucket(a, b, a.kind)
+	}
+	if a.debug != nil {
+		clear(a.debug.allocSites)
+		a.debug.lockHeld = 0
+	}
+	publishStats(a)
+
+	unlock(a)
+}
+
+// Empties the arena so that it can be handed to a new owner, such as by
+// returning it to a [sync.Pool], while keeping all of its buckets so that the
+// next owner starts with warm memory and does not have to grow the arena.
+//
+// This differs from the other ways of emptying an arena as follows:
+//   - [Reset] only rewinds the arena so the same owner can reuse its memory.
+//     Read only memory and statistics such as [WastedBytes] are kept.
+//   - Recycle rewinds the arena the same as [Reset], and also releases read
+//     only memory and resets the statistics that describe how the arena was
+//     used, such as [WastedBytes], [PeakBuckets], [HighWaterMark] and the
+//     allocation profile, so the next owner does not observe anything about
+//     the previous one.
+//   - [ResetToNew] and [Clear] release the buckets, so the memory is returned
+//     to the GC rather than reused.
+//
+// Configuration, such as the bucket size, any options that were set and debug
+// mode, is kept. As with [Reset], pointers into the arena must not be used
+// once it has been recycled and handles into it become stale.
+func Recycle(a *Arena) {
+	lock(a)
+
+	reset(a)
+	releaseReadOnly(a)
+	a.wastedBytes = 0
+	a.peakBuckets = len(a.buckets)
+	a.highWater = 0
+	if a.debug != nil {
+		clear(a.debug.allocSites)
+		a.debug.lockHeld = 0
 	}
+	publishStats(a)
+
+	unlock(a)
+}
 
+// Releases all of the arenas buckets and read only memory and resets its
+// position. The caller must hold the arenas lock.
+func clearBuckets(a *Arena) {
+	poisonBuckets(a)
+	freeBuckets(a, 0)
+	releaseReadOnly(a)
+	releaseLarge(a)
 	a.buckets = []bucket{}
-	a.bytesLeft = a.bucketSize
-	a.curBucket = 0
+	a.bucketEnds = nil
+	a.kinds = nil
+	setCurBucket(a, 0)
+	a.free = nil
+	a.parked = lanePos{bucket: -1}
+	a.gens = nil
+	a.payload = nil
+	a.peakBuckets = 0
+	a.highWater = 0
+	a.generation++
+	a.allocs = 0
+}
 
-	a.writing.Store(false)
+// Exchanges the contents of the two arenas. Both arenas are locked for the
+// duration of the swap, so any goroutine accessing either arena through a
+// pointer will observe either the old or the swapped contents, never a mix of
+// the two. This makes it possible to build up new state in one arena while
+// readers use another and then publish the new state all at once.
+//
+// All pointers that were returned by either arena will continue to reference
+// the same memory, they simply now belong to the other arena. Any
+// configuration, such as the bucket size, is swapped along with the contents.
+func Swap(a *Arena, b *Arena) {
+	if a == b {
+		return
+	}
+	// Always acquire the locks in the same order to prevent deadlocks when
+	// two goroutines swap the same arenas in opposite orders.
+	first, second := a, b
+	if uintptr(unsafe.Pointer(b)) < uintptr(unsafe.Pointer(a)) {
+		first, second = b, a
+	}
+	lock(first)
+	lock(second)
+
+	a.arenaState, b.arenaState = b.arenaState, a.arenaState
+	publishStats(a)
+	publishStats(b)
+
+	unlock(second)
+	unlock(first)
+}
+
+// Copies the used region of every bucket of `src`, up to and including the used
+// part of its current bucket, into `dst` and returns the number of bytes that
+// were copied. Each region is copied as a single contiguous block, growing
+// `dst` as needed, so the values in it keep their positions relative to each
+// other. This is a building block for compacting a small arena into a larger
+// one, as `src` is left unchanged and can be reset or cleared afterwards.
+//
+// The arena does not track individual allocations, so any padding, unused
+// bucket tails and memory returned with [Free] within the used regions is
+// copied as well. Values placed in dedicated buckets by [AllocLarge] are not
+// copied. Each region starts at a pointer aligned address in `dst`, so values
+// that were allocated with a larger alignment, such as with [AllocAligned],
+// may lose that alignment. Pointers between values in `src` are not updated
+// and still reference the memory of `src`.
+//
+// Every region must fit in a single bucket of `dst`, otherwise a
+// [ValueToLargeErr] is returned along with the number of bytes copied before
+// the region that did not fit. Copying an arena into itself does nothing.
+func CopyBuckets(dst *Arena, src *Arena) (uintptr, error) {
+	if dst == src {
+		return 0, nil
+	}
+	// Always acquire the locks in the same order to prevent deadlocks, see
+	// [Swap].
+	first, second := dst, src
+	if uintptr(unsafe.Pointer(src)) < uintptr(unsafe.Pointer(dst)) {
+		first, second = src, dst
+	}
+	lock(first)
+	lock(second)
+	defer unlock(first)
+	defer unlock(second)
+	defer publishStats(dst)
+
+	var rv uintptr
+	for i := 0; i <= frontier(src) && i < len(src.buckets); i++ {
+		region := src.buckets[i][:bucketUsed(src, i)]
+		if len(region) == 0 {
+			continue
+		}
+		kind := src.kinds[i]
+		bucketIdx, off, err := reserve(
+			dst, uintptr(len(region)), unsafe.Alignof(unsafe.Pointer(nil)),
+			kind,
+		)
+		if err != nil {
+			return rv, err
+		}
+		// Memory is only copied as pointers if both buckets are scanned.
+		if dst.kinds[bucketIdx] != kind {
+			kind = plainKind
+		}
+		copyBucket(kind, dst.buckets[bucketIdx][off:], region)
+		recordAlloc(dst, uintptr(len(region)))
+		rv += uintptr(len(region))
+	}
+	return rv, nil
+}
+
+// Copies `from` to the start of `to`. Both must start at pointer aligned
+// addresses in buckets of `kind`. For buckets of [scanKind] the pointer aligned
+// part is copied as pointer words so that the GC observes the pointers that are
+// written, see [zeroBucket].
+func copyBucket(kind bucketKind, to []byte, from []byte) {
+	if kind == plainKind {
+		copy(to, from)
+		return
+	}
+	words := uintptr(len(from)) / unsafe.Sizeof(unsafe.Pointer(nil))
+	copy(
+		unsafe.Slice(
+			(*unsafe.Pointer)(unsafe.Pointer(unsafe.SliceData(to))), words,
+		),
+		unsafe.Slice(
+			(*unsafe.Pointer)(unsafe.Pointer(unsafe.SliceData(from))), words,
+		),
+	)
+	copy(
+		to[words*unsafe.Sizeof(unsafe.Pointer(nil)):],
+		from[words*unsafe.Sizeof(unsafe.Pointer(nil)):],
+	)
 }
@@ -1,8 +1,14 @@
 package sbarena
 
 import (
+	"context"
+	"math"
+	"reflect"
 	"runtime"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"unsafe"
@@ -78,6 +84,121 @@ func TestAllocMultipleBucketsUnevenWrap(t *testing.T) {
 	}
 }
 
+func TestWastedBytes(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size*3 - 1)
+	sbtest.Eq(t, uintptr(0), WastedBytes(&a))
+
+	for range 6 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	// Only two values fit in each bucket, so the end of the first two buckets
+	// was skipped. The end of the last bucket is still usable.
+	sbtest.Eq(t, 3, NumBuckets(&a))
+	sbtest.Eq(t, (size-1)*2, WastedBytes(&a))
+
+	// Values without pointers are placed in their own bucket, so the padding
+	// is only counted between values of the same kind.
+	Reset(&a)
+	_, err := Alloc[byte](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[uint64](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, (size-1)*2+unsafe.Alignof(uint64(0))-1, WastedBytes(&a))
+}
+
+func TestHighWaterMark(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	sbtest.Eq(t, uintptr(0), HighWaterMark(&a))
+
+	for range 5 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, size*5, HighWaterMark(&a))
+
+	Reset(&a)
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+	sbtest.Eq(t, size*5, HighWaterMark(&a))
+	for range 3 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, size*5, HighWaterMark(&a))
+
+	// Going past the old peak raises the mark, even if the arena is rewound
+	// afterwards.
+	m := Mark(&a)
+	for range 4 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	Restore(&a, m)
+	sbtest.Eq(t, size*3, UsedBytes(&a))
+	sbtest.Eq(t, size*7, HighWaterMark(&a))
+
+	Clear(&a)
+	sbtest.Eq(t, uintptr(0), HighWaterMark(&a))
+}
+
+func TestCurrentOffset(t *testing.T) {
+	size := unsafe.Sizeof(uint64(0))
+	a := NewArena(size * 2)
+	bucket, off := CurrentOffset(&a)
+	sbtest.Eq(t, 0, bucket)
+	sbtest.Eq(t, uintptr(0), off)
+
+	_, err := Alloc[byte](&a)
+	sbtest.Nil(t, err)
+	bucket, off = CurrentOffset(&a)
+	sbtest.Eq(t, 0, bucket)
+	sbtest.Eq(t, uintptr(1), off)
+
+	// Padded up to the alignment of uint64.
+	_, err = Alloc[uint64](&a)
+	sbtest.Nil(t, err)
+	bucket, off = CurrentOffset(&a)
+	sbtest.Eq(t, 0, bucket)
+	sbtest.Eq(t, unsafe.Alignof(uint64(0))+size, off)
+
+	_, err = Alloc[uint64](&a)
+	sbtest.Nil(t, err)
+	bucket, off = CurrentOffset(&a)
+	sbtest.Eq(t, 1, bucket)
+	sbtest.Eq(t, size, off)
+}
+
+func TestAllocAlignment(t *testing.T) {
+	a := NewArena(0)
+
+	vals := [6]weak.Pointer[testStruct2]{}
+	for i := range vals {
+		b, err := Alloc[byte](&a)
+		sbtest.Nil(t, err)
+		*b.Value() = byte(i)
+
+		iterV, err := Alloc[testStruct2](&a)
+		sbtest.Nil(t, err)
+		sbtest.Eq(
+			t, uintptr(0),
+			uintptr(unsafe.Pointer(iterV.Value()))%unsafe.Alignof(testStruct2{}),
+		)
+		*iterV.Value() = testStruct2{
+			testStruct: testStruct{A: i, B: float64(i)},
+			D:          complex(float32(i), float32(i)),
+		}
+		vals[i] = iterV
+	}
+	for i := range vals {
+		sbtest.Eq(t, *vals[i].Value(), testStruct2{
+			testStruct: testStruct{A: i, B: float64(i)},
+			D:          complex(float32(i), float32(i)),
+		})
+	}
+}
+
 func TestAllocMultipleBucketsValueToLarge(t *testing.T) {
 	a := NewArena(unsafe.Sizeof(testStruct{}))
 	one, err := Alloc[testStruct2](&a)
@@ -125,6 +246,31 @@ func TestReset(t *testing.T) {
 	}
 }
 
+func TestResetZeroed(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 3)
+	for range 5 {
+		iterV, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		*iterV.Value() = testStruct{A: -1, B: math.Inf(1), C: "sentinel"}
+	}
+	tail, err := Alloc[[3]byte](&a)
+	sbtest.Nil(t, err)
+	*tail.Value() = [3]byte{0xff, 0xff, 0xff}
+	// The bytes hold no pointers, so they are placed in a bucket of their own.
+	sbtest.Eq(t, 3, NumBuckets(&a))
+
+	ResetZeroed(&a)
+	for range 5 {
+		iterV, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		sbtest.Eq(t, testStruct{}, *iterV.Value())
+	}
+	tail, err = Alloc[[3]byte](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, [3]byte{}, *tail.Value())
+	sbtest.Eq(t, 3, NumBuckets(&a))
+}
+
 func TestClear(t *testing.T) {
 	a := NewArena(unsafe.Sizeof(testStruct{}) * 3)
 
@@ -166,6 +312,200 @@ func TestClear(t *testing.T) {
 	}
 }
 
+func TestClearConcurrentWithAlloc(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 8)
+	vals := make([][]weak.Pointer[testStruct], 4)
+	var wg sync.WaitGroup
+	for i := range vals {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := range 1000 {
+				// A strong pointer, as a concurrent Clear followed by a GC
+				// could otherwise collect the value before it is used.
+				v, err := AllocStrong[testStruct](&a)
+				sbtest.Nil(t, err)
+				*v = testStruct{A: i*1000 + j, C: "val"}
+				sbtest.Eq(t, testStruct{A: i*1000 + j, C: "val"}, *v)
+				vals[i] = append(vals[i], weak.Make(v))
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			Clear(&a)
+			runtime.Gosched()
+		}
+	}()
+	wg.Wait()
+
+	Clear(&a)
+	runtime.GC()
+	sbtest.Eq(t, 0, NumBuckets(&a))
+	sbtest.Eq(t, uintptr(0), TotalMemBytes(&a))
+	for i := range vals {
+		for _, p := range vals[i] {
+			sbtest.Nil(t, p.Value())
+		}
+	}
+}
+
+// Returns the value that `action` panicked with, or nil if it did not panic.
+func recoverPanic(action func()) (rv any) {
+	defer func() { rv = recover() }()
+	action()
+	return
+}
+
+func TestCopiedArenaPanics(t *testing.T) {
+	a := NewArena(0)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+
+	// Copies the arena the way interface boxing or reflection would, which
+	// go vet does not catch.
+	c := new(Arena)
+	reflect.ValueOf(c).Elem().Set(reflect.ValueOf(&a).Elem())
+
+	for _, op := range []func(){
+		func() { Alloc[testStruct](c) },
+		func() { AllocContiguous[testStruct](c) },
+		func() { Reset(c) },
+		func() { Clear(c) },
+	} {
+		r, ok := recoverPanic(op).(error)
+		sbtest.True(t, ok)
+		sbtest.ContainsError(t, CopiedArenaErr, r)
+		sbtest.Eq(
+			t,
+			"The arena was copied by value after it was first used",
+			r.Error(),
+		)
+	}
+
+	// The original arena is unaffected.
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	p.Value().A = 1
+	Reset(&a)
+	Clear(&a)
+	sbtest.Eq(t, 0, NumBuckets(&a))
+}
+
+func TestCopyBuckets(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	src := NewArena(size * 2)
+	for i, str := range []string{"one", "two", "three", "four", "five"} {
+		p, err := Alloc[testStruct](&src)
+		sbtest.Nil(t, err)
+		*p.Value() = testStruct{A: i, B: float64(i), C: str}
+	}
+	sbtest.Eq(t, 3, NumBuckets(&src))
+
+	dst := NewArena(size * 8)
+	n, err := CopyBuckets(&dst, &src)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, size*5, n)
+	sbtest.Eq(t, UsedBytes(&src), UsedBytes(&dst))
+	sbtest.Eq(t, 1, NumBuckets(&dst))
+
+	// The source is left untouched and the copies are independent.
+	Clear(&src)
+	runtime.GC()
+	for i, str := range []string{"one", "two", "three", "four", "five"} {
+		v := (*testStruct)(unsafe.Pointer(&dst.buckets[0][uintptr(i)*size]))
+		sbtest.Eq(t, testStruct{A: i, B: float64(i), C: str}, *v)
+	}
+
+	n, err = CopyBuckets(&dst, &dst)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, uintptr(0), n)
+
+	src = NewArena(size * 2)
+	for range 2 {
+		_, err = Alloc[testStruct](&src)
+		sbtest.Nil(t, err)
+	}
+	small := NewArena(size)
+	n, err = CopyBuckets(&small, &src)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	sbtest.Eq(t, uintptr(0), n)
+}
+
+func TestRecycle(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	pool := sync.Pool{New: func() any {
+		a := NewArena(size * 2)
+		return &a
+	}}
+
+	a := pool.Get().(*Arena)
+	for range 5 {
+		_, err := Alloc[*int](a)
+		sbtest.Nil(t, err)
+		_, err = Alloc[testStruct](a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 5, NumBuckets(a))
+	sbtest.True(t, WastedBytes(a) > 0)
+	buckets := slices.Clone(a.buckets)
+
+	Recycle(a)
+	sbtest.Eq(t, 5, NumBuckets(a))
+	sbtest.Eq(t, uintptr(0), UsedBytes(a))
+	sbtest.Eq(t, uintptr(0), WastedBytes(a))
+	pool.Put(a)
+
+	// The pool may have dropped the arena, in which case there is nothing to
+	// check.
+	b := pool.Get().(*Arena)
+	if b != a {
+		t.Skip("the pool did not return the recycled arena")
+	}
+	for range 10 {
+		_, err := Alloc[testStruct](b)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 5, NumBuckets(b))
+	sbtest.Eq(t, 5, PeakBuckets(b))
+	for i := range buckets {
+		sbtest.Eq(t, unsafe.SliceData(buckets[i]), unsafe.SliceData(b.buckets[i]))
+	}
+}
+
+func TestClearKeepingOne(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 3)
+
+	vals := [6]weak.Pointer[testStruct]{}
+	for i := range vals {
+		iterV, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		iterV.Value().A = i
+		vals[i] = iterV
+	}
+	h, err := AllocHandle[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 3, NumBuckets(&a))
+
+	ClearKeepingOne(&a)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{})*3, TotalMemBytes(&a))
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{})*3, syncedBytesLeft(&a))
+
+	runtime.GC()
+	for i := range vals {
+		sbtest.Nil(t, vals[i].Value())
+	}
+	_, err = h.Resolve(&a)
+	sbtest.ContainsError(t, StaleHandleErr, err)
+
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+}
+
 func TestAllocConcurrent(t *testing.T) {
 	done := make(chan struct{}, 100)
 	a := NewArena(100)
@@ -176,6 +516,7 @@ func TestAllocConcurrent(t *testing.T) {
 			*val.Value() = byte(i)
 			time.Sleep(1 * time.Millisecond)
 			val, err = Alloc[byte](&a)
+			sbtest.Nil(t, err)
 			*val.Value() = byte(i) + 1
 			done <- struct{}{}
 		}(i * 2)
@@ -184,9 +525,1244 @@ func TestAllocConcurrent(t *testing.T) {
 		<-done
 	}
 
+	// Read the bucket through the lock rather than relying on the channel to
+	// order the read after the allocations.
+	lock(&a)
 	rawData := (*[100]byte)(unsafe.Pointer(&a.buckets[0][0]))
+	unlock(&a)
+	sbtest.Eq(t, 1, NumBuckets(&a))
 	slices.Sort(rawData[:])
 	for i := byte(0); i < 100; i++ {
 		sbtest.Eq(t, rawData[i], i)
 	}
 }
+
+func TestUsedAndFreeBytes(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size*3 - 1)
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+	sbtest.Eq(t, size*3-1, FreeBytes(&a))
+
+	for range 5 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 3, NumBuckets(&a))
+	sbtest.Eq(t, (size*3-1)*2+size, UsedBytes(&a))
+	sbtest.Eq(t, size*2-1, FreeBytes(&a))
+	sbtest.Eq(t, TotalMemBytes(&a), UsedBytes(&a)+FreeBytes(&a))
+
+	Reset(&a)
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+	sbtest.Eq(t, (size*3-1)*3, FreeBytes(&a))
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, size, UsedBytes(&a))
+	sbtest.Eq(t, (size*3-1)*3-size, FreeBytes(&a))
+
+	Clear(&a)
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+	sbtest.Eq(t, uintptr(0), FreeBytes(&a))
+}
+
+func TestTotalMemBytesMixedBucketSizes(t *testing.T) {
+	a := NewArena(64)
+	lock(&a)
+	for _, size := range []uintptr{100, 7, 256} {
+		appendBucket(&a, newBucket(size, plainKind), plainKind)
+	}
+	publishStats(&a)
+	unlock(&a)
+
+	sbtest.Eq(t, 4, NumBuckets(&a))
+	sbtest.Eq(t, uintptr(64+100+7+256), TotalMemBytes(&a))
+	sbtest.Eq(t, uintptr(64+100+7+256), Snapshot(&a).TotalBytes)
+	sbtest.Eq(t, uintptr(64+100+7+256), FreeBytes(&a))
+}
+
+func TestBucketAtMixedBucketSizes(t *testing.T) {
+	a := NewArena(64)
+	lock(&a)
+	defer unlock(&a)
+	for _, size := range []uintptr{100, 48} {
+		appendBucket(&a, newBucket(size, plainKind), plainKind)
+	}
+	for _, tc := range []struct {
+		off    uint64
+		bucket int
+		inner  uint64
+	}{
+		{0, 0, 0}, {63, 0, 63}, {64, 1, 0}, {163, 1, 99}, {164, 2, 0},
+		{211, 2, 47}, {212, 3, 0},
+	} {
+		bucket, inner := bucketAt(&a, tc.off)
+		sbtest.Eq(t, tc.bucket, bucket)
+		sbtest.Eq(t, tc.inner, inner)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{})*3 - 1)
+	sbtest.Eq(t, 2, Capacity[testStruct](&a))
+	sbtest.Eq(t, 0, Capacity[[4]testStruct](&a))
+	sbtest.Eq(t, math.MaxInt, Capacity[struct{}](&a))
+
+	for range 3 {
+		c := Capacity[testStruct](&a)
+		numBuckets := NumBuckets(&a)
+		for range c {
+			_, err := Alloc[testStruct](&a)
+			sbtest.Nil(t, err)
+			sbtest.Eq(t, numBuckets, NumBuckets(&a))
+		}
+		sbtest.Eq(t, 0, Capacity[testStruct](&a))
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		sbtest.Eq(t, numBuckets+1, NumBuckets(&a))
+	}
+
+	Reset(&a)
+	sbtest.Eq(t, 8, Capacity[testStruct](&a))
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 7, Capacity[testStruct](&a))
+
+	Clear(&a)
+	sbtest.Eq(t, 0, Capacity[testStruct](&a))
+}
+
+func TestSwap(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 3)
+	b := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+
+	aVals := [4]weak.Pointer[testStruct]{}
+	for i, str := range []string{"one", "two", "three", "four"} {
+		iterV, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		*iterV.Value() = testStruct{A: i, B: float64(i), C: str}
+		aVals[i] = iterV
+	}
+	bVal, err := Alloc[testStruct](&b)
+	sbtest.Nil(t, err)
+	*bVal.Value() = testStruct{A: 100, B: 100, C: "hundred"}
+
+	Swap(&a, &b)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{})*2, BucketSizeBytes(&a))
+	sbtest.Eq(t, 2, NumBuckets(&b))
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{})*3, BucketSizeBytes(&b))
+
+	sbtest.Eq(
+		t,
+		unsafe.Pointer(bVal.Value()),
+		unsafe.Pointer(&a.buckets[0][0]),
+	)
+	sbtest.Eq(
+		t,
+		unsafe.Pointer(aVals[0].Value()),
+		unsafe.Pointer(&b.buckets[0][0]),
+	)
+	for i, str := range []string{"one", "two", "three", "four"} {
+		sbtest.Eq(t, *aVals[i].Value(), testStruct{A: i, B: float64(i), C: str})
+	}
+	sbtest.Eq(t, *bVal.Value(), testStruct{A: 100, B: 100, C: "hundred"})
+
+	// The swapped arenas must continue allocating where the other left off.
+	next, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(
+		t,
+		unsafe.Pointer(next.Value()),
+		unsafe.Pointer(&a.buckets[0][unsafe.Sizeof(testStruct{})]),
+	)
+
+	Swap(&a, &a)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+}
+
+func TestReuseRatio(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 3)
+	sbtest.Eq(t, 0.0, ReuseRatio(&a))
+
+	prev := -1.0
+	for range 10 {
+		for range 6 {
+			_, err := Alloc[testStruct](&a)
+			sbtest.Nil(t, err)
+		}
+		sbtest.Eq(t, 2, NumBuckets(&a))
+		ratio := ReuseRatio(&a)
+		sbtest.True(t, ratio > prev)
+		prev = ratio
+		Reset(&a)
+	}
+	sbtest.True(t, ReuseRatio(&a) > 0.9)
+
+	Clear(&a)
+	for range 6 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.True(t, ReuseRatio(&a) < prev)
+}
+
+func TestStatsConcurrent(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 3)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 1000 {
+			_, err := Alloc[testStruct](&a)
+			sbtest.Nil(t, err)
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		numBuckets := NumBuckets(&a)
+		sbtest.True(t, numBuckets >= 1 && numBuckets <= 334)
+		sbtest.Eq(t, 0, int(TotalMemBytes(&a)%BucketSizeBytes(&a)))
+	}
+	sbtest.Eq(t, 334, NumBuckets(&a))
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{})*3*334, TotalMemBytes(&a))
+}
+
+func TestGettersConcurrentWithAlloc(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	var writers, readers sync.WaitGroup
+	for range 4 {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for range 250 {
+				_, err := Alloc[testStruct](&a)
+				sbtest.Nil(t, err)
+			}
+		}()
+	}
+	stop := make(chan struct{})
+	for range 4 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				n := NumBuckets(&a)
+				sbtest.True(t, n >= 1 && n <= 500)
+				sbtest.Eq(t, uintptr(0), TotalMemBytes(&a)%(size*2))
+				sbtest.True(t, PeakBuckets(&a) >= 1)
+				sbtest.Eq(t, size*2, BucketSizeBytes(&a))
+				sbtest.True(t, UsedBytes(&a) <= size*1000)
+			}
+		}()
+	}
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+	sbtest.Eq(t, 500, NumBuckets(&a))
+	sbtest.Eq(t, size*1000, TotalMemBytes(&a))
+	sbtest.Eq(t, size*1000, UsedBytes(&a))
+}
+
+func TestStatsDoNotTakeLock(t *testing.T) {
+	a := NewArena(0)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+
+	// Readers must make progress while an allocation holds the lock, and must
+	// not block each other.
+	lock(&a)
+	m := Meta{}
+	done := make(chan struct{})
+	for range 4 {
+		go func() {
+			for range 100 {
+				NumBuckets(&a)
+				PeakBuckets(&a)
+				TotalMemBytes(&a)
+				BucketSizeBytes(&a)
+				NumAllocations(&a)
+				WastedBytes(&a)
+				ReuseRatio(&a)
+				GrewSince(&a, m)
+			}
+			done <- struct{}{}
+		}()
+	}
+	for range 4 {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("reading the arenas stats blocked on the lock")
+		}
+	}
+	unlock(&a)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, DefaultBlockSize, TotalMemBytes(&a))
+}
+
+func TestLockFreeCountersSeeLockFreeAllocs(t *testing.T) {
+	a := NewArena(0)
+	_, err := Alloc[byte](&a)
+	sbtest.Nil(t, err)
+	for range 3 {
+		_, err = Alloc[uint64](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.True(t, a.bump[plainKind].Load() != nil)
+	sbtest.Eq(t, uint64(4), NumAllocations(&a))
+	sbtest.Eq(t, unsafe.Alignof(uint64(0))-1, WastedBytes(&a))
+
+	// The counters folded in by taking the lock are visible while it is
+	// held.
+	lock(&a)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sbtest.Eq(t, uint64(4), NumAllocations(&a))
+		sbtest.Eq(t, unsafe.Alignof(uint64(0))-1, WastedBytes(&a))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reading the arenas counters blocked on the lock")
+	}
+	unlock(&a)
+	sbtest.Eq(t, uint64(4), NumAllocations(&a))
+}
+
+func BenchmarkAlloc(b *testing.B) {
+	a := NewArena(0)
+	for b.Loop() {
+		if _, err := Alloc[testStruct](&a); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAllocContended(b *testing.B) {
+	a := NewArena(0)
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := Alloc[testStruct](&a); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSpinStrategy(b *testing.B) {
+	for name, s := range map[string]SpinStrategy{
+		"Yield":   YieldSpin,
+		"Busy":    BusySpin,
+		"Backoff": BackoffSpin,
+	} {
+		b.Run(name, func(b *testing.B) {
+			a := NewArena(0)
+			SetSpinStrategy(&a, s)
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					// AllocContiguous always takes the arenas lock.
+					if _, err := AllocContiguous[testStruct](&a); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkAllocSmallFastPath(b *testing.B) {
+	a := NewArena(0)
+	for b.Loop() {
+		if _, err := Alloc[[2]uint64](&a); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAllocSmallGenericPath(b *testing.B) {
+	a := NewArena(0)
+	for b.Loop() {
+		// AllocContiguous always takes the generic path through reserve.
+		if _, err := AllocContiguous[[2]uint64](&a); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAllocWithStatsPolling(b *testing.B) {
+	a := NewArena(0)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				NumBuckets(&a)
+				TotalMemBytes(&a)
+				BucketSizeBytes(&a)
+			}
+		}
+	}()
+
+	for b.Loop() {
+		if _, err := Alloc[testStruct](&a); err != nil {
+			b.Fatal(err)
+		}
+	}
+	close(done)
+}
+
+func TestAllocExactlyFillsBucket(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+
+	vals := [3]weak.Pointer[testStruct]{}
+	for i := range 2 {
+		iterV, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		*iterV.Value() = testStruct{A: i}
+		vals[i] = iterV
+	}
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, uintptr(0), syncedBytesLeft(&a))
+
+	iterV, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	*iterV.Value() = testStruct{A: 2}
+	vals[2] = iterV
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(t, unsafe.Pointer(&a.buckets[1][0]), unsafe.Pointer(vals[2].Value()))
+	for i := range vals {
+		sbtest.Eq(t, testStruct{A: i}, *vals[i].Value())
+	}
+}
+
+func TestAllocEveryAllocFillsBucket(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}))
+
+	for range 2 {
+		vals := [5]weak.Pointer[testStruct]{}
+		for i := range vals {
+			iterV, err := Alloc[testStruct](&a)
+			sbtest.Nil(t, err)
+			*iterV.Value() = testStruct{A: i}
+			vals[i] = iterV
+			sbtest.Eq(t, uintptr(0), syncedBytesLeft(&a))
+			sbtest.Eq(t, i, a.curBucket)
+		}
+		sbtest.Eq(t, 5, NumBuckets(&a))
+		for i := range vals {
+			sbtest.Eq(
+				t,
+				unsafe.Pointer(&a.buckets[i][0]),
+				unsafe.Pointer(vals[i].Value()),
+			)
+			sbtest.Eq(t, testStruct{A: i}, *vals[i].Value())
+		}
+		Reset(&a)
+	}
+}
+
+func TestNewArenaNoWaste(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+
+	a := NewArenaNoWaste[testStruct](size*3 - 1)
+	sbtest.Eq(t, size*3, BucketSizeBytes(&a))
+	a = NewArenaNoWaste[testStruct](size * 3)
+	sbtest.Eq(t, size*3, BucketSizeBytes(&a))
+	a = NewArenaNoWaste[testStruct](size*3 + 1)
+	sbtest.Eq(t, size*4, BucketSizeBytes(&a))
+	a = NewArenaNoWaste[testStruct](0)
+	sbtest.Eq(t, (DefaultBlockSize+size-1)/size*size, BucketSizeBytes(&a))
+	a = NewArenaNoWaste[struct{}](100)
+	sbtest.Eq(t, uintptr(100), BucketSizeBytes(&a))
+
+	a = NewArenaNoWaste[testStruct](size*3 - 1)
+	for i := uintptr(1); i <= 100; i++ {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		// Every byte of every full bucket is used, the only unused bytes are
+		// at the end of the current bucket.
+		sbtest.Eq(t, i*size, TotalMemBytes(&a)-syncedBytesLeft(&a))
+	}
+}
+
+func TestAllocRemaining(t *testing.T) {
+	a := NewArena(100)
+	_, err := Alloc[uint64](&a)
+	sbtest.Nil(t, err)
+
+	left := syncedBytesLeft(&a)
+	b := AllocRemaining(&a)
+	sbtest.Eq(t, int(left), len(b))
+	sbtest.Eq(t, int(left), cap(b))
+	sbtest.Eq(t, 0, int(syncedBytesLeft(&a)))
+	sbtest.True(t, AllocRemaining(&a) == nil)
+
+	_, err = Alloc[uint64](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+
+	// The bytes are only taken from the bucket of the values without
+	// pointers.
+	Reset(&a)
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.True(t, AllocRemaining(&a) == nil)
+
+	Clear(&a)
+	sbtest.True(t, AllocRemaining(&a) == nil)
+}
+
+func TestAllocContiguous(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size*2 + size/2)
+
+	for i := range 4 {
+		p, err := AllocContiguous[testStruct](&a)
+		sbtest.Nil(t, err)
+
+		// The value must lie entirely inside of the bucket it was placed in.
+		b := a.buckets[i/2]
+		start := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+		addr := uintptr(unsafe.Pointer(p.Value()))
+		sbtest.True(t, addr >= start)
+		sbtest.True(t, addr+size <= start+uintptr(len(b)))
+	}
+	// The tail of each full bucket was too small for another value and was
+	// left unused rather than being split across buckets.
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(t, 1, a.curBucket)
+	sbtest.Eq(t, size/2, syncedBytesLeft(&a))
+
+	a = NewArena(1)
+	_, err := AllocContiguous[testStruct](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestTruncate(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 4)
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	Truncate(&a, size)
+	sbtest.Eq(t, size*3, syncedBytesLeft(&a))
+
+	p2, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p.Value(), p2.Value())
+	sbtest.Eq(t, size*2, syncedBytesLeft(&a))
+
+	// Truncating more than was used only gives back the current bucket.
+	Truncate(&a, size*10)
+	sbtest.Eq(t, size*4, syncedBytesLeft(&a))
+	sbtest.Eq(t, 1, NumBuckets(&a))
+
+	Clear(&a)
+	Truncate(&a, size)
+	sbtest.Eq(t, size*4, syncedBytesLeft(&a))
+}
+
+func TestFreeLast(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	FreeLast[testStruct](&a)
+	p2, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p.Value(), p2.Value())
+
+	// The value started a new bucket, so freeing it rewinds to the start of
+	// that bucket and not into the first one.
+	p3, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	FreeLast[testStruct](&a)
+	bucket, off := CurrentOffset(&a)
+	sbtest.Eq(t, 1, bucket)
+	sbtest.Eq(t, uintptr(0), off)
+	p4, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p3.Value(), p4.Value())
+	sbtest.Eq(t, size*3, UsedBytes(&a))
+}
+
+func TestTruncateDiscardsFreedMemory(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 4)
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Nil(t, Free(&a, p))
+	Truncate(&a, size)
+
+	// The freed slot was in the truncated region so the next two allocations
+	// must not both receive it.
+	p2, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	p3, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Neq[*testStruct](t, p2.Value(), p3.Value())
+}
+
+func TestZeroValueArena(t *testing.T) {
+	var a Arena
+	sbtest.False(t, IsInitialized(&a))
+	sbtest.Eq(t, DefaultBlockSize, BucketSizeBytes(&a))
+
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	p.Value().A = 1
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, DefaultBlockSize, TotalMemBytes(&a))
+	sbtest.False(t, IsInitialized(&a))
+
+	warnings := Warnings(&a)
+	sbtest.Eq(t, 1, len(warnings))
+	sbtest.True(t, strings.Contains(warnings[0], "default bucket size"))
+}
+
+func TestWarningsConstructedArena(t *testing.T) {
+	a := NewArena(0)
+	sbtest.True(t, IsInitialized(&a))
+	sbtest.Eq(t, 0, len(Warnings(&a)))
+
+	a = NewArena(DefaultBlockSize)
+	sbtest.Eq(t, 0, len(Warnings(&a)))
+}
+
+func TestPeakBuckets(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size)
+	sbtest.Eq(t, 1, PeakBuckets(&a))
+
+	for range 4 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 4, PeakBuckets(&a))
+
+	Reset(&a)
+	for range 2 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 4, PeakBuckets(&a))
+
+	Clear(&a)
+	sbtest.Eq(t, 0, PeakBuckets(&a))
+	for range 2 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 2, PeakBuckets(&a))
+
+	ClearKeepingOne(&a)
+	sbtest.Eq(t, 1, PeakBuckets(&a))
+}
+
+func TestNumAllocations(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 4)
+	sbtest.Eq(t, uint64(0), NumAllocations(&a))
+	for range 10 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	_, err := Alloc[struct{}](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[[DefaultBlockSize]byte](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	sbtest.Eq(t, uint64(10), NumAllocations(&a))
+
+	Reset(&a)
+	sbtest.Eq(t, uint64(0), NumAllocations(&a))
+	for range 3 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, uint64(3), NumAllocations(&a))
+
+	// The other functions that allocate individual values are counted too.
+	_, ok, err := TryAlloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.True(t, ok)
+	_, err = AllocCtx[testStruct](context.Background(), &a)
+	sbtest.Nil(t, err)
+	_, err = AllocStrong[testStruct](&a)
+	sbtest.Nil(t, err)
+	_, err = New[testStruct](&a)
+	sbtest.Nil(t, err)
+	_, err = AllocMany[testStruct](&a, 4)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, uint64(11), NumAllocations(&a))
+
+	Clear(&a)
+	sbtest.Eq(t, uint64(0), NumAllocations(&a))
+
+	typed := NewTypedArena[testStruct](0)
+	for range 5 {
+		_, err := typed.New()
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, uint64(5), NumAllocations(typed.Arena()))
+}
+
+func TestNumAllocationsConcurrentWithReset(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 16)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 500 {
+				_, err := Alloc[testStruct](&a)
+				sbtest.Nil(t, err)
+			}
+		}()
+	}
+	for range 50 {
+		Reset(&a)
+	}
+	wg.Wait()
+
+	// Every counted value must still be in use after the last reset.
+	sbtest.Eq(
+		t, UsedBytes(&a),
+		uintptr(NumAllocations(&a))*unsafe.Sizeof(testStruct{}),
+	)
+}
+
+func TestFixedArena(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewFixedArena(size * 3)
+
+	first, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	for range 2 {
+		_, err = Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	_, err = Alloc[testStruct](&a)
+	sbtest.ContainsError(t, OutOfSpaceErr, err)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, size*3, TotalMemBytes(&a))
+
+	Reset(&a)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, first.Value(), p.Value())
+	sbtest.Eq(t, 1, NumBuckets(&a))
+
+	_, err = Alloc[testStruct2](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[testStruct2](&a)
+	sbtest.ContainsError(t, OutOfSpaceErr, err)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+}
+
+func TestAllocInto(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+	var p *testStruct
+	sbtest.Nil(t, AllocInto(&a, &p))
+	sbtest.NotNil(t, p)
+
+	b := a.buckets[0]
+	start := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+	addr := uintptr(unsafe.Pointer(p))
+	sbtest.True(t, addr >= start && addr < start+uintptr(len(b)))
+
+	*p = testStruct{A: 1, B: 2, C: "3"}
+	sbtest.Eq(t, testStruct{A: 1, B: 2, C: "3"}, *(*testStruct)(unsafe.Pointer(&b[0])))
+
+	var p2 *testStruct
+	sbtest.Nil(t, AllocInto(&a, &p2))
+	sbtest.Eq(t, addr+unsafe.Sizeof(testStruct{}), uintptr(unsafe.Pointer(p2)))
+
+	var tooLarge *testStruct
+	a = NewArena(1)
+	sbtest.ContainsError(t, ValueToLargeErr, AllocInto(&a, &tooLarge))
+	sbtest.Nil(t, tooLarge)
+}
+
+func TestAssertFits(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	sbtest.Nil(t, AssertFits[testStruct](size))
+	sbtest.Nil(t, AssertFits[testStruct](DefaultBlockSize))
+	sbtest.Nil(t, AssertFits[struct{}](0))
+	sbtest.ContainsError(t, ValueToLargeErr, AssertFits[testStruct](size-1))
+	sbtest.ContainsError(t, ValueToLargeErr, AssertFits[[1024]byte](1000))
+}
+
+// A heap backed bucket allocator that takes a long time to allocate each
+// bucket.
+type slowAllocator struct {
+	delay  time.Duration
+	allocs atomic.Int64
+}
+
+func (s *slowAllocator) alloc(size uintptr, kind bucketKind) bucket {
+	s.allocs.Add(1)
+	time.Sleep(s.delay)
+	return newBucket(size, kind)
+}
+func (s *slowAllocator) free(b bucket, kind bucketKind) {}
+func (s *slowAllocator) onHeap() bool                   { return true }
+
+func TestGrowDeadline(t *testing.T) {
+	slow := &slowAllocator{delay: 200 * time.Millisecond}
+	a := NewArena(unsafe.Sizeof(testStruct{}))
+	a.allocator = slow
+	SetGrowDeadline(&a, 10*time.Millisecond)
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[testStruct](&a)
+	sbtest.ContainsError(t, GrowDeadlineErr, err)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+
+	// The bucket that missed the deadline is used once it is ready rather
+	// than starting another allocation.
+	time.Sleep(slow.delay * 2)
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(t, int64(1), slow.allocs.Load())
+
+	SetGrowDeadline(&a, 0)
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 3, NumBuckets(&a))
+}
+
+func TestGrowDeadlineClearWaitsForPendingBucket(t *testing.T) {
+	slow := &slowAllocator{delay: 50 * time.Millisecond}
+	a := NewArena(unsafe.Sizeof(testStruct{}))
+	a.allocator = slow
+	SetGrowDeadline(&a, time.Millisecond)
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[testStruct](&a)
+	sbtest.ContainsError(t, GrowDeadlineErr, err)
+	Clear(&a)
+	for _, c := range a.pendingBuckets {
+		sbtest.True(t, c == nil)
+	}
+	sbtest.Eq(t, 0, NumBuckets(&a))
+}
+
+func TestAllocStrong(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	p, err := AllocStrong[testStruct](&a)
+	sbtest.Nil(t, err)
+	*p = testStruct{A: 1, B: 1, C: "one"}
+	sbtest.Eq(t, size*2, TotalMemBytes(&a))
+	sbtest.Eq(
+		t, uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[0]))),
+		uintptr(unsafe.Pointer(p)),
+	)
+
+	Reset(&a)
+	w, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p, w.Value())
+	sbtest.Eq(t, testStruct{A: 1, B: 1, C: "one"}, *w.Value())
+	w.Value().A = 2
+	sbtest.Eq(t, 2, p.A)
+
+	_, err = AllocStrong[[3]testStruct](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestAllocCopy(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct2{}))
+	one, err := AllocCopy(&a, testStruct{A: 1, B: 1, C: "one"})
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, testStruct{A: 1, B: 1, C: "one"}, *one.Value())
+
+	v := testStruct2{testStruct: testStruct{A: 2, B: 2, C: "two"}, D: 2}
+	two, err := AllocCopy(&a, v)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, v, *two.Value())
+	v.A = 3
+	sbtest.Eq(t, 2, two.Value().A)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+
+	large, err := AllocCopy(&a, [2]testStruct2{})
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	sbtest.Nil(t, large.Value())
+}
+
+func TestNew(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}))
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	*p.Value() = testStruct{A: 1, B: 2, C: "3"}
+	Reset(&a)
+
+	// The memory is reused after the reset but must be zeroed.
+	v, err := New[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Pointer(p.Value()), unsafe.Pointer(v))
+	sbtest.Eq(t, testStruct{}, *v)
+
+	v.A = 5
+	runtime.GC()
+	sbtest.Eq(t, 5, v.A)
+
+	a = NewArena(1)
+	v, err = New[testStruct](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	sbtest.Nil(t, v)
+}
+
+func TestNewArenaWithCapacity(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArenaWithCapacity(size*2, 3)
+	sbtest.Eq(t, 3, NumBuckets(&a))
+	sbtest.Eq(t, 3, PeakBuckets(&a))
+	sbtest.Eq(t, size*6, TotalMemBytes(&a))
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+
+	preallocated := slices.Clone(a.buckets)
+	for i := range 6 {
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		sbtest.Eq(
+			t,
+			uintptr(unsafe.Pointer(unsafe.SliceData(preallocated[i/2])))+
+				uintptr(i%2)*size,
+			uintptr(unsafe.Pointer(p.Value())),
+		)
+	}
+	sbtest.Eq(t, 3, NumBuckets(&a))
+	sbtest.Eq(t, size*6, UsedBytes(&a))
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 4, NumBuckets(&a))
+
+	a = NewArenaWithCapacity(0, 0)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, uintptr(DefaultBlockSize), TotalMemBytes(&a))
+}
+
+func TestReserveFor(t *testing.T) {
+	a := NewArena(1000)
+	_, err := Alloc[*int](&a)
+	sbtest.Nil(t, err)
+
+	sbtest.Nil(t, ReserveFor[testStruct](&a, 1000))
+	sbtest.True(t, Capacity[testStruct](&a) >= 1000)
+	size := unsafe.Sizeof(testStruct{})
+	perBucket := 1000 / size
+	// The first bucket lost the space of the pointer, and the padding after
+	// it.
+	first := (1000 - alignUp(
+		unsafe.Sizeof((*int)(nil)), unsafe.Alignof(testStruct{}),
+	)) / size
+	numBuckets := NumBuckets(&a)
+	sbtest.Eq(t, 1+int((1000-first+perBucket-1)/perBucket), numBuckets)
+
+	m := MetaSnapshot(&a)
+	for range 1000 {
+		_, err := AllocContiguous[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.False(t, GrewSince(&a, m))
+	sbtest.Eq(t, numBuckets, NumBuckets(&a))
+
+	// Reserving less than what is available does nothing.
+	Reset(&a)
+	sbtest.Nil(t, ReserveFor[testStruct](&a, 10))
+	sbtest.Eq(t, numBuckets, NumBuckets(&a))
+
+	Clear(&a)
+	sbtest.Nil(t, ReserveFor[testStruct](&a, int(perBucket)))
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, int(perBucket), Capacity[testStruct](&a))
+}
+
+func TestReserveForErrors(t *testing.T) {
+	a := NewArena(1)
+	sbtest.ContainsError(t, ValueToLargeErr, ReserveFor[testStruct](&a, 1))
+
+	a = NewFixedArena(unsafe.Sizeof(testStruct{}) * 2)
+	sbtest.Nil(t, ReserveFor[testStruct](&a, 2))
+	sbtest.ContainsError(t, OutOfSpaceErr, ReserveFor[testStruct](&a, 3))
+	sbtest.Eq(t, 1, NumBuckets(&a))
+}
+
+func TestAllocSmallFastPath(t *testing.T) {
+	a := NewArena(64)
+	_, err := Alloc[byte](&a)
+	sbtest.Nil(t, err)
+
+	// The next 16 byte value is not at its natural alignment so it takes the
+	// generic path, which pads it out to its types alignment.
+	sbtest.True(t, allocSmall(&a, 16) == nil)
+	p, err := Alloc[[2]uint64](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(
+		t, unsafe.Alignof([2]uint64{}),
+		uintptr(unsafe.Pointer(p.Value()))-
+			uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[0]))),
+	)
+
+	Reset(&a)
+	p, err = Alloc[[2]uint64](&a)
+	sbtest.Nil(t, err)
+	p2, err := Alloc[[2]uint64](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(
+		t,
+		uintptr(unsafe.Pointer(p.Value()))+16,
+		uintptr(unsafe.Pointer(p2.Value())),
+	)
+	sbtest.EqFloat(t, 0.5, Efficiency(&a), 1e-9)
+
+	// Freed memory is reused before the fast path is taken.
+	sbtest.Nil(t, Free(&a, p))
+	sbtest.True(t, allocSmall(&a, 16) == nil)
+	p3, err := Alloc[[2]uint64](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p.Value(), p3.Value())
+}
+
+func TestSetMaxBytes(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	SetMaxBytes(&a, size*6)
+	for range 6 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 3, NumBuckets(&a))
+	sbtest.Eq(t, size*6, TotalMemBytes(&a))
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.ContainsError(t, OutOfMemoryErr, err)
+	_, err = AllocLarge[[3]testStruct](&a)
+	sbtest.ContainsError(t, OutOfMemoryErr, err)
+	sbtest.Eq(t, 3, NumBuckets(&a))
+
+	// Existing buckets are reused without growing.
+	Reset(&a)
+	for range 6 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	_, err = Alloc[testStruct](&a)
+	sbtest.ContainsError(t, OutOfMemoryErr, err)
+
+	SetMaxBytes(&a, 0)
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 4, NumBuckets(&a))
+}
+
+func TestShrink(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	for range 8 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 4, NumBuckets(&a))
+
+	Reset(&a)
+	Shrink(&a)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, size*2, TotalMemBytes(&a))
+	sbtest.Eq(t, 4, PeakBuckets(&a))
+
+	vals := [3]weak.Pointer[testStruct]{}
+	for i := range vals {
+		iterV, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		iterV.Value().A = i
+		vals[i] = iterV
+	}
+	sbtest.Eq(t, 2, NumBuckets(&a))
+
+	// Nothing after the current bucket, so nothing is released.
+	Shrink(&a)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	for i := range vals {
+		sbtest.Eq(t, i, vals[i].Value().A)
+	}
+}
+
+func TestResetToNew(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	EnableDebug(&a)
+	SetCoalesceFrees(&a, true)
+	for range 7 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Nil(t, Free(&a, p))
+	Reset(&a)
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	Clear(&a)
+	_, err = AllocStringImmutable(&a, "str")
+	sbtest.Nil(t, err)
+	for range 3 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+
+	ResetToNew(&a)
+	fresh := NewArena(size * 2)
+	sbtest.Eq(t, BucketSizeBytes(&fresh), BucketSizeBytes(&a))
+	sbtest.Eq(t, NumBuckets(&fresh), NumBuckets(&a))
+	sbtest.Eq(t, PeakBuckets(&fresh), PeakBuckets(&a))
+	sbtest.Eq(t, TotalMemBytes(&fresh), TotalMemBytes(&a))
+	sbtest.EqFloat(t, ReuseRatio(&fresh), ReuseRatio(&a), 1e-9)
+	sbtest.EqFloat(t, Efficiency(&fresh), Efficiency(&a), 1e-9)
+	sbtest.Eq(t, Capacity[testStruct](&fresh), Capacity[testStruct](&a))
+	sbtest.Eq(t, MetaSnapshot(&fresh), MetaSnapshot(&a))
+	sbtest.Eq(t, len(Warnings(&fresh)), len(Warnings(&a)))
+	sbtest.True(t, IsInitialized(&a))
+	sbtest.True(t, a.free == nil)
+
+	// Configuration is kept.
+	sbtest.True(t, a.coalesceFrees)
+	sbtest.NotNil(t, a.debug)
+	sbtest.Eq(t, 0, len(a.debug.allocSites))
+}
+
+func TestAllocHeapPointersSurviveGC(t *testing.T) {
+	type heapRefs struct {
+		S string
+		P *int
+		L []int
+	}
+
+	a := NewArena(0)
+	vals := make([]weak.Pointer[heapRefs], 1000)
+	func() {
+		for i := range vals {
+			iterV, err := Alloc[heapRefs](&a)
+			sbtest.Nil(t, err)
+			n := i
+			*iterV.Value() = heapRefs{
+				S: strings.Repeat(string(rune('a'+i%26)), i%64+1),
+				P: &n,
+				L: slices.Repeat([]int{i}, i%16+1),
+			}
+			vals[i] = iterV
+		}
+	}()
+	for range 3 {
+		runtime.GC()
+		// Churn the heap so any freed memory is likely to be overwritten.
+		for i := range 1000 {
+			_ = slices.Repeat([]int{-1}, i%64+1)
+		}
+	}
+
+	for i := range vals {
+		v := vals[i].Value()
+		sbtest.Eq(t, strings.Repeat(string(rune('a'+i%26)), i%64+1), v.S)
+		sbtest.Eq(t, i, *v.P)
+		sbtest.SlicesMatch(t, slices.Repeat([]int{i}, i%16+1), v.L)
+	}
+	runtime.KeepAlive(&a)
+}
+
+// Returns the number of bytes left in the current bucket, including any
+// allocations that were made without taking the arenas lock.
+func syncedBytesLeft(a *Arena) uintptr {
+	lock(a)
+	defer unlock(a)
+	return a.bytesLeft
+}
+
+func TestAllocZeroSize(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, uintptr(0), syncedBytesLeft(&a))
+
+	for range 1000 {
+		p, err := Alloc[struct{}](&a)
+		sbtest.Nil(t, err)
+		sbtest.NotNil(t, p.Value())
+		sbtest.Eq(t, unsafe.Pointer(&zeroSizeBase), unsafe.Pointer(p.Value()))
+
+		p2, err := AllocContiguous[[0]int](&a)
+		sbtest.Nil(t, err)
+		sbtest.NotNil(t, p2.Value())
+
+		p3, err := AllocStrong[struct{}](&a)
+		sbtest.Nil(t, err)
+		sbtest.NotNil(t, p3)
+
+		p4, err := New[struct{}](&a)
+		sbtest.Nil(t, err)
+		sbtest.NotNil(t, p4)
+	}
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, uintptr(0), syncedBytesLeft(&a))
+	sbtest.Eq(t, size, UsedBytes(&a))
+}
+
+func TestSpinStrategies(t *testing.T) {
+	for _, s := range []SpinStrategy{YieldSpin, BusySpin, BackoffSpin} {
+		a := NewArena(unsafe.Sizeof(testStruct{}) * 64)
+		SetSpinStrategy(&a, s)
+		vals := make([][]weak.Pointer[testStruct], 100)
+		var wg sync.WaitGroup
+		for i := range vals {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := range 50 {
+					// AllocContiguous always takes the arenas lock.
+					p, err := AllocContiguous[testStruct](&a)
+					sbtest.Nil(t, err)
+					p.Value().A = i*50 + j
+					vals[i] = append(vals[i], p)
+				}
+			}(i)
+		}
+		wg.Wait()
+		for i := range vals {
+			for j, p := range vals[i] {
+				sbtest.Eq(t, i*50+j, p.Value().A)
+			}
+		}
+		sbtest.Eq(t, unsafe.Sizeof(testStruct{})*5000, UsedBytes(&a))
+	}
+}
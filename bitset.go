@@ -0,0 +1,105 @@
+package sbarena
+
+import (
+	"fmt"
+	"math/bits"
+	"unsafe"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// A fixed size set of bits whose backing words are allocated in an
+	// [Arena]. The words hold no pointers, so they are placed in a bucket
+	// that the garbage collector does not scan, see [Arena]. Large bitsets,
+	// such as those used by bloom filters or visited sets, then add nothing
+	// to the work the garbage collector does when marking, and bit patterns
+	// that happen to look like addresses are never mistaken for pointers.
+	// Fixed arenas are the exception, see [NewFixedArena].
+	//
+	// The words that back a Bitset are owned by the arena, so calling [Reset]
+	// allows them to be overwritten by other allocations and calling [Clear]
+	// invalidates them.
+	Bitset struct {
+		words []uint64
+		nbits int
+	}
+)
+
+// Creates a new [Bitset] that can hold `nbits` bits, all of which are initially
+// cleared. The backing words must fit in a single bucket, otherwise a
+// [ValueToLargeErr] is returned.
+func NewBitset(a *Arena, nbits int) (Bitset, error) {
+	if nbits < 0 {
+		return Bitset{}, sberr.Wrap(InvalidLengthErr, "Num bits: %d", nbits)
+	}
+	nwords := (nbits + 63) / 64
+	if nwords == 0 {
+		return Bitset{}, nil
+	}
+	size := uintptr(nwords) * unsafe.Sizeof(uint64(0))
+	if size > maxAllocSize(a) {
+		return Bitset{}, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	bucketIdx, off, err := reserve(a, size, unsafe.Alignof(uint64(0)), plainKind)
+	if err != nil {
+		unlock(a)
+		return Bitset{}, err
+	}
+	words := unsafe.Slice(
+		(*uint64)(unsafe.Pointer(&a.buckets[bucketIdx][off])), nwords,
+	)
+	recordAlloc(a, size)
+	publishStats(a)
+	unlock(a)
+
+	clear(words)
+	return Bitset{words: words, nbits: nbits}, nil
+}
+
+func (b Bitset) checkIndex(i int) {
+	if i < 0 || i >= b.nbits {
+		panic(fmt.Sprintf(
+			"sbarena: bit index %d out of range for bitset of length %d",
+			i, b.nbits,
+		))
+	}
+}
+
+// Returns the number of bits the bitset can hold.
+func (b Bitset) Len() int {
+	return b.nbits
+}
+
+// Sets the i-th bit. Panics if i is out of range.
+func (b Bitset) Set(i int) {
+	b.checkIndex(i)
+	b.words[i/64] |= 1 << (i % 64)
+}
+
+// Clears the i-th bit. Panics if i is out of range.
+func (b Bitset) Clear(i int) {
+	b.checkIndex(i)
+	b.words[i/64] &^= 1 << (i % 64)
+}
+
+// Returns true if the i-th bit is set. Panics if i is out of range.
+func (b Bitset) Test(i int) bool {
+	b.checkIndex(i)
+	return b.words[i/64]&(1<<(i%64)) != 0
+}
+
+// Returns the number of bits that are set.
+func (b Bitset) Count() int {
+	rv := 0
+	for _, w := range b.words {
+		rv += bits.OnesCount64(w)
+	}
+	return rv
+}
@@ -0,0 +1,117 @@
+package sbarena
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestBitset(t *testing.T) {
+	a := NewArena(0)
+	b, err := NewBitset(&a, 200)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 200, b.Len())
+	sbtest.Eq(t, 0, b.Count())
+	sbtest.Eq(
+		t, uintptr(0),
+		uintptr(unsafe.Pointer(&b.words[0]))%unsafe.Alignof(uint64(0)),
+	)
+
+	set := []int{0, 1, 62, 63, 64, 65, 127, 128, 199}
+	for _, i := range set {
+		b.Set(i)
+	}
+	sbtest.Eq(t, len(set), b.Count())
+	for i := range 200 {
+		expected := false
+		for _, s := range set {
+			expected = expected || s == i
+		}
+		sbtest.Eq(t, expected, b.Test(i))
+	}
+
+	b.Set(63)
+	sbtest.Eq(t, len(set), b.Count())
+	b.Clear(63)
+	b.Clear(64)
+	b.Clear(100)
+	sbtest.Eq(t, len(set)-2, b.Count())
+	sbtest.False(t, b.Test(63))
+	sbtest.False(t, b.Test(64))
+	sbtest.True(t, b.Test(62))
+	sbtest.True(t, b.Test(65))
+
+	sbtest.Panics(t, func() { b.Set(200) })
+	sbtest.Panics(t, func() { b.Test(-1) })
+}
+
+func TestBitsetClearedAfterReset(t *testing.T) {
+	a := NewArena(0)
+	b, err := NewBitset(&a, 128)
+	sbtest.Nil(t, err)
+	for i := range 128 {
+		b.Set(i)
+	}
+	Reset(&a)
+
+	b2, err := NewBitset(&a, 128)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Pointer(&b.words[0]), unsafe.Pointer(&b2.words[0]))
+	sbtest.Eq(t, 0, b2.Count())
+}
+
+func TestBitsetAlignment(t *testing.T) {
+	a := NewArena(0)
+	_, err := Alloc[byte](&a)
+	sbtest.Nil(t, err)
+	b, err := NewBitset(&a, 64)
+	sbtest.Nil(t, err)
+	sbtest.Eq(
+		t, uintptr(0),
+		uintptr(unsafe.Pointer(&b.words[0]))%unsafe.Alignof(uint64(0)),
+	)
+}
+
+func TestBitsetErrors(t *testing.T) {
+	a := NewArena(64)
+	_, err := NewBitset(&a, 64*8)
+	sbtest.Nil(t, err)
+	_, err = NewBitset(&a, 64*8+1)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	_, err = NewBitset(&a, -1)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+
+	b, err := NewBitset(&a, 0)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, b.Count())
+}
+
+func TestBitsetNotScanned(t *testing.T) {
+	a := NewArena(0)
+	b, err := NewBitset(&a, 64*128)
+	sbtest.Nil(t, err)
+	lock(&a)
+	for i, bucket := range a.buckets {
+		base := uintptr(unsafe.Pointer(unsafe.SliceData(bucket)))
+		addr := uintptr(unsafe.Pointer(&b.words[0]))
+		if addr >= base && addr < base+uintptr(len(bucket)) {
+			sbtest.Eq(t, plainKind, a.kinds[i])
+		}
+	}
+	unlock(&a)
+
+	// Set the bits of the address of freed memory in every word.
+	addr := freedAddr()
+	runtime.GC()
+	for w := range 128 {
+		for i := range 64 {
+			if uint64(addr+uintptr(w))&(1<<i) != 0 {
+				b.Set(w*64 + i)
+			}
+		}
+	}
+	runtime.GC()
+	sbtest.Eq(t, uint64(addr+1), b.words[1])
+}
@@ -0,0 +1,163 @@
+package sbarena
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+	"weak"
+)
+
+type (
+	// A pool of buckets that is shared between arenas. Buckets that an arena
+	// releases when it is cleared are placed in the pool and handed to the
+	// next arena that needs a bucket rather than being left for the garbage
+	// collector. This reduces GC pressure for applications that create and
+	// discard many short lived arenas.
+	//
+	// A BucketPool is safe for concurrent use.
+	BucketPool struct {
+		mu         sync.Mutex
+		bucketSize uintptr
+		// The idle buckets of each kind, see [bucketKind].
+		idle         [numKinds][]bucket
+		numAllocated uint64
+	}
+
+	// Allocates buckets from a [BucketPool] and returns the buckets that the
+	// arena releases to it.
+	poolAllocator struct {
+		pool *BucketPool
+	}
+)
+
+// Creates a new [BucketPool] that holds buckets of `bucketSizeBytes` bytes. If
+// `bucketSizeBytes` is <=0 then [DefaultBlockSize] is used.
+func NewBucketPool(bucketSizeBytes uintptr) *BucketPool {
+	if bucketSizeBytes <= 0 {
+		bucketSizeBytes = DefaultBlockSize
+	}
+	return &BucketPool{bucketSize: bucketSizeBytes}
+}
+
+// Returns the number of buckets that are in the pool waiting to be reused.
+func (p *BucketPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle[plainKind]) + len(p.idle[scanKind])
+}
+
+// Returns the number of buckets the pool has newly allocated because there
+// were no buckets waiting to be reused.
+func (p *BucketPool) NumAllocated() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.numAllocated
+}
+
+func (p *BucketPool) get(kind bucketKind) bucket {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idle := p.idle[kind]
+	if len(idle) == 0 {
+		p.numAllocated++
+		return p.newBucket(kind)
+	}
+	b := idle[len(idle)-1]
+	idle[len(idle)-1] = nil
+	p.idle[kind] = idle[:len(idle)-1]
+	return b
+}
+
+func (p *BucketPool) put(b bucket, kind bucketKind) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle[kind] = append(p.idle[kind], b)
+}
+
+// Allocates a new bucket of the pools bucket size. Buckets of [plainKind] are
+// put back in the pool once nothing references them anymore, see
+// [reclaimBucket].
+func (p *BucketPool) newBucket(kind bucketKind) bucket {
+	b, off := newBucketAt(p.bucketSize, kind)
+	if kind == plainKind {
+		reclaimBucket(weak.Make(p), unsafe.SliceData(b), off, p.bucketSize)
+	}
+	return b[off : off+p.bucketSize : off+p.bucketSize]
+}
+
+// Arranges for the bucket that starts `off` bytes into the allocation at `base`
+// to be put back in the pool once it is unreachable, which is the case once
+// the arena that held it was garbage collected without being cleared and no
+// pointers into the bucket are left. Weak pointers into the bucket return nil
+// from then on, so they never end up referencing the values of another arena.
+// Nothing is done if the pool itself was garbage collected.
+//
+// Buckets of [scanKind] are left to the garbage collector, as values in
+// different buckets may reference each other and the finalizer of an object
+// that is part of such a cycle is never run.
+func reclaimBucket(
+	p weak.Pointer[BucketPool],
+	base *byte,
+	off uintptr,
+	size uintptr,
+) {
+	runtime.SetFinalizer(base, func(base *byte) {
+		pool := p.Value()
+		if pool == nil {
+			return
+		}
+		reclaimBucket(p, base, off, size)
+		pool.put(unsafe.Slice(base, off+size)[off:], plainKind)
+	})
+}
+
+// Creates a new [Arena] whose buckets are drawn from the supplied pool. The
+// arena uses the bucket size of the pool. Calling [Clear] returns the arenas
+// buckets to the pool.
+//
+// Because buckets returned to the pool are reused by other arenas, pointers
+// into an arena created by this function are not set to nil by [Clear], they
+// must not be used after the arena is cleared.
+//
+// An arena that is garbage collected without being cleared returns the buckets
+// that hold values without pointers to the pool once no pointers into them are
+// left, so they never end up referencing the values of another arena. Its
+// buckets that hold values with pointers are left to the garbage collector.
+func NewPooledArena(p *BucketPool) (rv Arena) {
+	g := &poolAllocator{pool: p}
+
+	rv.arenaState = arenaState{
+		curBucket:    0,
+		bytesLeft:    p.bucketSize,
+		bucketSize:   p.bucketSize,
+		allocator:    g,
+		freshBuckets: 1,
+		kind:         scanKind,
+		parked:       lanePos{bucket: -1},
+	}
+	appendBucket(&rv, g.alloc(p.bucketSize, scanKind), scanKind)
+	publishStats(&rv)
+	return
+}
+
+// Returns a bucket from the pool, or a new bucket that is not part of the pool
+// if `size` is not the bucket size of the pool.
+func (g *poolAllocator) alloc(size uintptr, kind bucketKind) bucket {
+	if size != g.pool.bucketSize {
+		return newBucket(size, kind)
+	}
+	return g.pool.get(kind)
+}
+
+// Returns a bucket to the pool, leaving it to the garbage collector if it is
+// not of the bucket size of the pool.
+func (g *poolAllocator) free(b bucket, kind bucketKind) {
+	if uintptr(len(b)) != g.pool.bucketSize {
+		return
+	}
+	g.pool.put(b, kind)
+}
+
+func (g *poolAllocator) onHeap() bool {
+	return true
+}
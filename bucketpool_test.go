@@ -0,0 +1,142 @@
+package sbarena
+
+import (
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestBucketPoolReusedOnClear(t *testing.T) {
+	p := NewBucketPool(unsafe.Sizeof(testStruct{}))
+	for range 5 {
+		a := NewPooledArena(p)
+		for range 3 {
+			_, err := Alloc[testStruct](&a)
+			sbtest.Nil(t, err)
+		}
+		sbtest.Eq(t, 3, NumBuckets(&a))
+		sbtest.Eq(t, 0, p.Len())
+		Clear(&a)
+		sbtest.Eq(t, 3, p.Len())
+	}
+	sbtest.Eq(t, uint64(3), p.NumAllocated())
+}
+
+func TestBucketPoolNotReusedOnCollection(t *testing.T) {
+	p := NewBucketPool(unsafe.Sizeof(testStruct{}))
+	collected := make(chan struct{}, 1)
+	var strong *testStruct
+	func() {
+		a := NewPooledArena(p)
+		SetFinalizer(&a, func() { collected <- struct{}{} })
+		var err error
+		strong, err = New[testStruct](&a)
+		sbtest.Nil(t, err)
+		strong.A = 42
+	}()
+	sbtest.True(t, gcUntil(collected, 5*time.Second))
+	runtime.GC()
+	sbtest.Eq(t, 0, p.Len())
+
+	// The strong pointer keeps its bucket alive and must not be aliased by
+	// the buckets of the next arena.
+	a := NewPooledArena(p)
+	other, err := New[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Neq[*testStruct](t, strong, other)
+	other.A = 7
+	sbtest.Eq(t, 42, strong.A)
+	sbtest.Eq(t, uint64(2), p.NumAllocated())
+}
+
+// Runs the garbage collector until the pool holds `n` buckets.
+func gcUntilPoolLen(p *BucketPool, n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		runtime.GC()
+		if p.Len() == n {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestBucketPoolReclaimedOnCollection(t *testing.T) {
+	p := NewBucketPool(64)
+	var n int
+	func() {
+		a := NewPooledArena(p)
+		for range 3 {
+			_, err := AllocBytes(&a, 64)
+			sbtest.Nil(t, err)
+		}
+		n = p.Len() + 3
+	}()
+	sbtest.True(t, gcUntilPoolLen(p, n, 5*time.Second))
+
+	// The reclaimed buckets are handed to the next arena.
+	allocated := p.NumAllocated()
+	a := NewPooledArena(p)
+	for range 3 {
+		_, err := AllocBytes(&a, 64)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, allocated, p.NumAllocated())
+}
+
+func TestBucketPoolNotReclaimedWhileReferenced(t *testing.T) {
+	p := NewBucketPool(64)
+	var strong []byte
+	var n int
+	func() {
+		a := NewPooledArena(p)
+		var err error
+		strong, err = AllocBytes(&a, 64)
+		sbtest.Nil(t, err)
+		strong[0] = 42
+		n = p.Len()
+	}()
+	for range 5 {
+		runtime.GC()
+	}
+	sbtest.Eq(t, n, p.Len())
+
+	a := NewPooledArena(p)
+	other, err := AllocBytes(&a, 64)
+	sbtest.Nil(t, err)
+	sbtest.Neq[*byte](t, unsafe.SliceData(strong), unsafe.SliceData(other))
+	other[0] = 7
+	sbtest.Eq(t, byte(42), strong[0])
+
+	// Once the last pointer is gone the bucket is reclaimed.
+	strong = nil
+	sbtest.True(t, gcUntilPoolLen(p, n+1, 5*time.Second))
+	runtime.KeepAlive(&a)
+}
+
+func TestPoolAllocatorOtherSizes(t *testing.T) {
+	p := NewBucketPool(64)
+	g := &poolAllocator{pool: p}
+	b := g.alloc(128, plainKind)
+	sbtest.Eq(t, 128, len(b))
+	sbtest.Eq(t, uint64(0), p.NumAllocated())
+	g.free(b, plainKind)
+	sbtest.Eq(t, 0, p.Len())
+
+	b = g.alloc(64, plainKind)
+	sbtest.Eq(t, 64, len(b))
+	sbtest.Eq(t, uint64(1), p.NumAllocated())
+	g.free(b, plainKind)
+	sbtest.Eq(t, 1, p.Len())
+}
+
+func TestBucketPoolBucketSize(t *testing.T) {
+	p := NewBucketPool(0)
+	a := NewPooledArena(p)
+	sbtest.Eq(t, DefaultBlockSize, BucketSizeBytes(&a))
+	sbtest.Eq(t, 1, NumBuckets(&a))
+}
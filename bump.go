@@ -0,0 +1,366 @@
+package sbarena
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+type (
+	// A cursor into the current bucket that [Alloc] advances with a CAS, so
+	// that allocations which fit in the current bucket never take the arenas
+	// lock. The cursor is sealed whenever the lock is taken and reopened when
+	// it is released, so code that holds the lock always sees an up to date
+	// bytesLeft and never races with lock free allocations.
+	bumpCursor struct {
+		base   unsafe.Pointer
+		size   uintptr
+		bucket int
+		// The offset of the first unused byte in the bucket. A value larger
+		// than size marks the cursor as sealed.
+		off atomic.Uintptr
+		// The offset the cursor was opened at. Every byte between it and off
+		// is accounted for by payload and wasted once the allocations that
+		// advanced the cursor have updated the counters, see [foldCursor].
+		start uintptr
+		// The payload bytes allocated through the cursor that have not yet
+		// been added to the arenas payload counters.
+		payload atomic.Uintptr
+		// The alignment padding skipped by allocations made through the
+		// cursor that has not yet been added to the arenas wasted bytes.
+		wasted atomic.Uintptr
+		// The number of values allocated through the cursor that have not
+		// yet been added to the arenas allocation count.
+		allocs atomic.Uint64
+	}
+
+	// A region of the current bucket of a kind that was carved out under the
+	// arenas lock so that a single goroutine can allocate from it without
+	// contending with other goroutines on the shared [bumpCursor]. The region
+	// is already counted as used by the arena when it is carved, the values
+	// allocated from it are folded back into the arenas state when the chunk
+	// is sealed.
+	chunk struct {
+		bumpCursor
+		// Set by the goroutine that used the chunk once it dropped the chunk
+		// because a value did not fit in it anymore.
+		dropped atomic.Bool
+	}
+
+	// The chunks of an arena. The chunks that are not in use are kept in a
+	// [sync.Pool] per kind, which keeps a separate list for every P, so
+	// goroutines that run on different Ps allocate from different chunks.
+	chunkCache struct {
+		pools [numKinds]sync.Pool
+		// Every chunk that was carved and has not been sealed yet, in the
+		// order they were carved. The slice is only replaced with the arenas
+		// lock held and never modified in place, so that the allocations
+		// made from the chunks can be counted without the lock, see
+		// [pendingCounts].
+		live atomic.Pointer[[]*chunk]
+	}
+)
+
+const (
+	// The number of bytes a chunk takes from the current bucket.
+	chunkSize = 4 << 10
+	// The largest value that is allocated from a chunk. Larger values always
+	// use the shared cursor so that they do not leave most of a chunk unused.
+	maxChunkAlloc = chunkSize / 16
+	// The smallest bucket size chunks are carved from, so that a chunk never
+	// takes a large part of a bucket that other goroutines are waiting on.
+	minChunkBucket = chunkSize * 4
+)
+
+// Reserves `size` bytes aligned to `align` in the current bucket of `kind`
+// without taking the arenas lock. Nil is returned if there is no open cursor for
+// the kind or the value does not fit in the rest of its bucket, in which case
+// the caller must fall back to allocating with the lock held.
+//
+// Small values are allocated from a chunk of the kind if there is one, see
+// [chunk]. Chunks are only carved once goroutines contend on the cursor, so an
+// arena that is only used by a single goroutine never uses them.
+func bumpAlloc(
+	a *Arena,
+	size uintptr,
+	align uintptr,
+	kind bucketKind,
+) unsafe.Pointer {
+	c := a.bump[kind].Load()
+	if c == nil || size == 0 {
+		return nil
+	}
+	// The cursor is only opened after the lock recorded the arenas address,
+	// so a mismatch means this is a copy sharing the cursor of the original.
+	if a.self != a {
+		panic(CopiedArenaErr)
+	}
+	if size > maxChunkAlloc {
+		ptr, _ := c.alloc(size, align)
+		return ptr
+	}
+	if ptr := chunkAlloc(a, size, align, kind); ptr != nil {
+		return ptr
+	}
+	ptr, contended := c.alloc(size, align)
+	// Carving is skipped rather than waited for when another goroutine holds
+	// the lock, the lock free path must never block.
+	if contended && c.size >= minChunkBucket && tryLockAlloc(a) {
+		carveChunk(a, kind)
+		unlock(a)
+	}
+	return ptr
+}
+
+// Advances the cursor past `size` bytes aligned to `align` and returns the
+// address of the first byte, or nil if the cursor is sealed or the value does
+// not fit in the rest of its memory. Also returns true if the cursor was
+// advanced by another goroutine in the meantime.
+func (c *bumpCursor) alloc(size, align uintptr) (unsafe.Pointer, bool) {
+	contended := false
+	for {
+		old := c.off.Load()
+		start := alignUp(uintptr(c.base)+old, align) - uintptr(c.base)
+		if start > c.size || size > c.size-start {
+			return nil, contended
+		}
+		if c.off.CompareAndSwap(old, start+size) {
+			// The payload is added last, see [foldCursor].
+			c.allocs.Add(1)
+			c.wasted.Add(start - old)
+			c.payload.Add(size)
+			return unsafe.Add(c.base, start), contended
+		}
+		contended = true
+	}
+}
+
+// Allocates `size` bytes aligned to `align` from a chunk of `kind` that is not
+// in use by another goroutine. Nil is returned if there is no such chunk or the
+// value does not fit in it, in which case the chunk is dropped.
+func chunkAlloc(
+	a *Arena,
+	size uintptr,
+	align uintptr,
+	kind bucketKind,
+) unsafe.Pointer {
+	cache := a.chunks.Load()
+	if cache == nil {
+		return nil
+	}
+	ch, _ := cache.pools[kind].Get().(*chunk)
+	if ch == nil {
+		return nil
+	}
+	ptr, _ := ch.alloc(size, align)
+	if ptr == nil {
+		ch.dropped.Store(true)
+		return nil
+	}
+	cache.pools[kind].Put(ch)
+	return ptr
+}
+
+// Carves a chunk of up to [chunkSize] bytes out of the current bucket of `kind`
+// and places it in the chunk pool of the kind. Nothing is carved if values may
+// not be allocated without the lock, see [openLane], or if the rest of the
+// bucket is too small to be worth a chunk. Chunks that were dropped or whose
+// bucket is full are sealed first. The caller must hold the arenas lock.
+func carveChunk(a *Arena, kind bucketKind) {
+	cache := a.chunks.Load()
+	if cache == nil {
+		cache = &chunkCache{}
+		a.chunks.Store(cache)
+	}
+	// Chunks that are lost to a pool, such as when a goroutine moved to
+	// another P, are sealed once their bucket is no longer in use so that
+	// the number of live chunks stays bounded.
+	live := slices.DeleteFunc(
+		slices.Clone(cache.chunks()),
+		func(ch *chunk) bool {
+			if ch.dropped.Load() ||
+				(ch.bucket != a.curBucket && ch.bucket != a.parked.bucket) {
+				sealChunk(a, ch)
+				return true
+			}
+			return false
+		},
+	)
+	cache.live.Store(&live)
+
+	defer withKind(a, kind)()
+	if a.kind != kind || !canBump(a) || a.bucketSize < minChunkBucket ||
+		a.bytesLeft < maxChunkAlloc {
+		return
+	}
+	n := min(uintptr(chunkSize), a.bytesLeft)
+	ch := &chunk{bumpCursor: bumpCursor{
+		base: unsafe.Pointer(
+			&a.buckets[a.curBucket][a.bucketSize-a.bytesLeft],
+		),
+		size:   n,
+		bucket: a.curBucket,
+	}}
+	a.bytesLeft -= n
+	live = append(slices.Clip(live), ch)
+	cache.live.Store(&live)
+	cache.pools[kind].Put(ch)
+}
+
+// Returns the chunks that have not been sealed yet, see [chunkCache].
+func (c *chunkCache) chunks() []*chunk {
+	if live := c.live.Load(); live != nil {
+		return *live
+	}
+	return nil
+}
+
+// Returns the number of values and the number of bytes of alignment padding
+// that were allocated without the lock and have not been folded back into the
+// arenas state yet. This does not take the lock, so the result may be slightly
+// stale while values are allocated concurrently.
+func pendingCounts(a *Arena) (uint64, uintptr) {
+	var allocs uint64
+	var wasted uintptr
+	for kind := range a.bump {
+		if c := a.bump[kind].Load(); c != nil {
+			allocs += c.allocs.Load()
+			wasted += c.wasted.Load()
+		}
+	}
+	if cache := a.chunks.Load(); cache != nil {
+		for _, ch := range cache.chunks() {
+			allocs += ch.allocs.Load()
+			wasted += ch.wasted.Load()
+		}
+	}
+	return allocs, wasted
+}
+
+// Seals every chunk so that no further allocations are made from them and
+// folds the allocations they made back into the arenas state, see [sealBump].
+// The pools are replaced so that the sealed chunks do not keep the buckets
+// they were carved from alive. The caller must hold the arenas lock.
+func sealChunks(a *Arena) {
+	cache := a.chunks.Load()
+	if cache == nil || len(cache.chunks()) == 0 {
+		return
+	}
+	// Chunks are sealed newest first so that the unused ends of consecutive
+	// chunks are all given back to the bucket.
+	for _, ch := range slices.Backward(cache.chunks()) {
+		sealChunk(a, ch)
+	}
+	a.chunks.Store(&chunkCache{})
+	publishStats(a)
+}
+
+// Seals a single chunk, see [sealChunks]. The unused end of the chunk is given
+// back to its bucket if nothing was allocated after it, otherwise it is counted
+// as wasted. The caller must hold the arenas lock.
+func sealChunk(a *Arena, ch *chunk) {
+	off := ch.off.Swap(ch.size + 1)
+	foldCursor(a, &ch.bumpCursor, off)
+
+	left := ch.size - off
+	base := uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[ch.bucket])))
+	end := uintptr(ch.base) - base + ch.size
+	switch {
+	case ch.bucket == a.curBucket && a.bucketSize-a.bytesLeft == end:
+		a.bytesLeft += left
+	case ch.bucket == a.parked.bucket &&
+		bucketSizeAt(a, ch.bucket)-a.parked.bytesLeft == end:
+		a.parked.bytesLeft += left
+	default:
+		a.wastedBytes += left
+	}
+}
+
+// Closes the open cursors, if any, so that no further allocations are made
+// through them, and folds the allocations they made back into the arenas
+// state. The counters are published again so that readers that do not take
+// the lock do not miss the folded allocations. The caller must hold the arenas
+// lock.
+func sealBump(a *Arena) {
+	sealLane(a)
+	if a.parked.bucket >= 0 {
+		swapLanes(a)
+		sealLane(a)
+		swapLanes(a)
+	}
+	publishStats(a)
+}
+
+// Closes the open cursor of the current kind, see [sealBump]. The caller must
+// hold the arenas lock.
+func sealLane(a *Arena) {
+	c := a.bump[a.kind].Swap(nil)
+	if c == nil {
+		return
+	}
+	off := c.off.Swap(c.size + 1)
+	a.bytesLeft = c.size - off
+	foldCursor(a, c, off)
+}
+
+// Adds the allocations made through the cursor `c`, which was sealed at offset
+// `off`, to the arenas counters. An allocation updates the counters of the
+// cursor after it advanced the cursor, so this first waits until the counters
+// account for every byte up to `off`. The payload is the last counter an
+// allocation updates and is read before the wasted bytes, so once they add up
+// every allocation has updated all of the counters. The caller must hold the
+// arenas lock.
+func foldCursor(a *Arena, c *bumpCursor, off uintptr) {
+	for c.payload.Load()+c.wasted.Load() != off-c.start {
+		runtime.Gosched()
+	}
+	addPayload(a, c.bucket, c.payload.Swap(0))
+	a.wastedBytes += c.wasted.Swap(0)
+	a.allocs += c.allocs.Swap(0)
+}
+
+// Opens a cursor at the first unused byte of the current bucket of each kind so
+// that allocations can be made without the lock. No cursor is opened when
+// allocations must go through the lock: when there is free memory that should
+// be reused first, when the arena is in debug mode, or when the arenas memory
+// does not live on the go heap. The caller must hold the arenas lock.
+func openBump(a *Arena) {
+	openLane(a)
+	if a.parked.bucket >= 0 {
+		swapLanes(a)
+		openLane(a)
+		swapLanes(a)
+	}
+}
+
+// Opens the cursor of the current kind, see [openBump]. The caller must hold
+// the arenas lock.
+func openLane(a *Arena) {
+	if !canBump(a) {
+		// Drop the last cursor so that it does not keep a released bucket
+		// alive.
+		a.cursor = nil
+		return
+	}
+	base := unsafe.Pointer(unsafe.SliceData(a.buckets[a.curBucket]))
+	if a.cursor == nil || a.cursor.base != base ||
+		a.cursor.bucket != a.curBucket {
+		a.cursor = &bumpCursor{
+			base:   base,
+			size:   a.bucketSize,
+			bucket: a.curBucket,
+		}
+	}
+	a.cursor.start = a.bucketSize - a.bytesLeft
+	a.cursor.off.Store(a.cursor.start)
+	a.bump[a.kind].Store(a.cursor)
+}
+
+// Returns true if values of the current kind may be allocated without the
+// lock, see [openBump]. The caller must hold the arenas lock.
+func canBump(a *Arena) bool {
+	return a.debug == nil && a.curBucket >= 0 && a.curBucket < len(a.buckets) &&
+		(a.free == nil || a.free.len == 0) && checkOnHeap(a) == nil
+}
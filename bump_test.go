@@ -0,0 +1,418 @@
+package sbarena
+
+import (
+	"cmp"
+	"context"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+	"weak"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocConcurrentNoAliasing(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 64)
+	vals := make([][]weak.Pointer[testStruct], 16)
+	var wg sync.WaitGroup
+	for i := range vals {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := range 500 {
+				p, err := Alloc[testStruct](&a)
+				sbtest.Nil(t, err)
+				p.Value().A = i*500 + j
+				vals[i] = append(vals[i], p)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	addrs := []uintptr{}
+	for i := range vals {
+		for j, p := range vals[i] {
+			sbtest.Eq(t, i*500+j, p.Value().A)
+			addrs = append(addrs, uintptr(unsafe.Pointer(p.Value())))
+		}
+	}
+	slices.Sort(addrs)
+	for i := 1; i < len(addrs); i++ {
+		sbtest.True(t, addrs[i]-addrs[i-1] >= unsafe.Sizeof(testStruct{}))
+	}
+	sbtest.Eq(t, 16*500/64, NumBuckets(&a))
+	sbtest.EqFloat(t, 1, Efficiency(&a), 1e-9)
+	runtime.KeepAlive(&a)
+}
+
+func TestAllocConcurrentMixedSizesNoOverlap(t *testing.T) {
+	type span struct{ start, end uintptr }
+	a := NewArena(512)
+	spans := make([][]span, 8)
+	ptrs := make([][]any, 8)
+	var wg sync.WaitGroup
+	for i := range spans {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			record := func(p unsafe.Pointer, size, align uintptr) {
+				sbtest.Eq(t, uintptr(0), uintptr(p)%align)
+				spans[i] = append(spans[i], span{uintptr(p), uintptr(p) + size})
+			}
+			for range 300 {
+				b, err := Alloc[byte](&a)
+				sbtest.Nil(t, err)
+				record(unsafe.Pointer(b.Value()), 1, 1)
+				u, err := Alloc[[3]uint16](&a)
+				sbtest.Nil(t, err)
+				record(unsafe.Pointer(u.Value()), 6, 2)
+				s, err := Alloc[testStruct](&a)
+				sbtest.Nil(t, err)
+				record(
+					unsafe.Pointer(s.Value()),
+					unsafe.Sizeof(testStruct{}), unsafe.Alignof(testStruct{}),
+				)
+				ptrs[i] = append(ptrs[i], b, u, s)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	all := slices.Concat(spans...)
+	slices.SortFunc(all, func(l, r span) int {
+		return cmp.Compare(l.start, r.start)
+	})
+	for i := 1; i < len(all); i++ {
+		sbtest.True(t, all[i-1].end <= all[i].start)
+	}
+	runtime.KeepAlive(ptrs)
+	runtime.KeepAlive(&a)
+}
+
+func TestAllocCountedWhileSealed(t *testing.T) {
+	// Several Ps are needed for an allocation to be interrupted between
+	// advancing the cursor and counting the value.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 64)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 2000 {
+				_, err := Alloc[testStruct](&a)
+				sbtest.Nil(t, err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	// Every lock seals the cursor while the allocations are in flight.
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			UsedBytes(&a)
+		}
+	}
+
+	sbtest.Eq(t, uint64(4*2000), NumAllocations(&a))
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{})*4*2000, UsedBytes(&a))
+	sbtest.EqFloat(t, 1, Efficiency(&a), 1e-9)
+	runtime.KeepAlive(&a)
+}
+
+func TestAllocLockFreeSeesLockedState(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 4)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{})*2, syncedBytesLeft(&a))
+
+	// Freed memory must be reused, so the lock free path is closed until the
+	// free lists are empty again.
+	sbtest.Nil(t, Free(&a, p))
+	p2, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p.Value(), p2.Value())
+
+	Reset(&a)
+	p2, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p.Value(), p2.Value())
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{})*3, syncedBytesLeft(&a))
+}
+
+// Carves `n` chunks of `kind` so that the following allocations are made from
+// them, as they are once goroutines contend on the shared cursor.
+func seedChunks(a *Arena, kind bucketKind, n int) {
+	lockAlloc(a)
+	for range n {
+		carveChunk(a, kind)
+	}
+	unlock(a)
+}
+
+func TestChunkAllocFoldedOnLock(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(0)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	seedChunks(&a, scanKind, 1)
+	// The chunk is used directly as the pool only hands it out on the P it
+	// was put on.
+	p2, _ := a.chunks.Load().chunks()[0].alloc(size, unsafe.Alignof(testStruct{}))
+	sbtest.Eq(t, uintptr(unsafe.Pointer(p.Value()))+size, uintptr(p2))
+
+	// Taking the lock seals the chunk and gives back the rest of it.
+	sbtest.Eq(t, uint64(2), NumAllocations(&a))
+	sbtest.Eq(t, size*2, UsedBytes(&a))
+	sbtest.Eq(t, uintptr(0), WastedBytes(&a))
+	p3, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, uintptr(p2)+size, uintptr(unsafe.Pointer(p3.Value())))
+	runtime.KeepAlive(&a)
+}
+
+func TestChunksSealedOnReset(t *testing.T) {
+	a := NewArena(0)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	seedChunks(&a, scanKind, 2)
+	Reset(&a)
+	sbtest.Eq(t, 0, len(a.chunks.Load().chunks()))
+
+	p2, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p.Value(), p2.Value())
+	p3, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Neq[*testStruct](t, p2.Value(), p3.Value())
+}
+
+func TestChunksNotCarvedFromSmallBuckets(t *testing.T) {
+	a := NewArena(minChunkBucket / 2)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	seedChunks(&a, scanKind, 1)
+	sbtest.Eq(t, 0, len(a.chunks.Load().chunks()))
+}
+
+func TestChunkAllocConcurrentNoOverlap(t *testing.T) {
+	type span struct{ start, end uintptr }
+	a := NewArena(0)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[[3]uint16](&a)
+	sbtest.Nil(t, err)
+	seedChunks(&a, scanKind, 8)
+	seedChunks(&a, plainKind, 8)
+
+	spans := make([][]span, 8)
+	ptrs := make([][]any, 8)
+	var wg sync.WaitGroup
+	for i := range spans {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			record := func(p unsafe.Pointer, size uintptr) {
+				spans[i] = append(spans[i], span{uintptr(p), uintptr(p) + size})
+			}
+			for range 1000 {
+				u, err := Alloc[[3]uint16](&a)
+				sbtest.Nil(t, err)
+				record(unsafe.Pointer(u.Value()), 6)
+				s, err := Alloc[testStruct](&a)
+				sbtest.Nil(t, err)
+				record(unsafe.Pointer(s.Value()), unsafe.Sizeof(testStruct{}))
+				ptrs[i] = append(ptrs[i], u, s)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	all := slices.Concat(spans...)
+	slices.SortFunc(all, func(l, r span) int {
+		return cmp.Compare(l.start, r.start)
+	})
+	for i := 1; i < len(all); i++ {
+		sbtest.True(t, all[i-1].end <= all[i].start)
+	}
+	sbtest.Eq(t, uint64(2+8*2000), NumAllocations(&a))
+	runtime.KeepAlive(ptrs)
+	runtime.KeepAlive(&a)
+}
+
+func BenchmarkAllocParallel(b *testing.B) {
+	b.Run("LockFree", func(b *testing.B) {
+		a := NewArena(0)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := Alloc[testStruct](&a); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+	b.Run("SmallValues", func(b *testing.B) {
+		a := NewArena(0)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := Alloc[uint64](&a); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+	b.Run("Locked", func(b *testing.B) {
+		a := NewArena(0)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				// AllocContiguous always takes the arenas lock.
+				if _, err := AllocContiguous[testStruct](&a); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func TestTryAlloc(t *testing.T) {
+	a := NewArena(0)
+	p, ok, err := TryAlloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.True(t, ok)
+	p.Value().A = 1
+
+	lock(&a)
+	done := make(chan bool)
+	go func() {
+		_, ok, err := TryAlloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		sbtest.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("TryAlloc blocked while the lock was held")
+	}
+	unlock(&a)
+
+	p2, ok, err := TryAlloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.True(t, ok)
+	sbtest.Eq(
+		t,
+		uintptr(unsafe.Pointer(p.Value()))+unsafe.Sizeof(testStruct{}),
+		uintptr(unsafe.Pointer(p2.Value())),
+	)
+
+	_, ok, err = TryAlloc[[DefaultBlockSize + 1]byte](&a)
+	sbtest.True(t, ok)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestAllocCtx(t *testing.T) {
+	a := NewArena(0)
+	p, err := AllocCtx[testStruct](context.Background(), &a)
+	sbtest.Nil(t, err)
+	p.Value().A = 1
+
+	lock(&a)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := AllocCtx[testStruct](ctx, &a)
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		sbtest.ContainsError(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("AllocCtx kept waiting after the context was cancelled")
+	}
+	unlock(&a)
+
+	p2, err := AllocCtx[testStruct](ctx, &a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(
+		t,
+		uintptr(unsafe.Pointer(p.Value()))+unsafe.Sizeof(testStruct{}),
+		uintptr(unsafe.Pointer(p2.Value())),
+	)
+	sbtest.Eq(t, 1, p.Value().A)
+}
+
+func TestAllocMany(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 16)
+	vals, err := AllocMany[testStruct](&a, 1000)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 1000, len(vals))
+	sbtest.Eq(t, 63, NumBuckets(&a))
+	sbtest.Eq(t, size*1000, UsedBytes(&a))
+
+	seen := map[*testStruct]struct{}{}
+	for i, v := range vals {
+		p := v.Value()
+		sbtest.NotNil(t, p)
+		seen[p] = struct{}{}
+		*p = testStruct{A: i, C: "many"}
+	}
+	sbtest.Eq(t, 1000, len(seen))
+	for i, v := range vals {
+		sbtest.Eq(t, testStruct{A: i, C: "many"}, *v.Value())
+	}
+
+	vals, err = AllocMany[testStruct](&a, 0)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, len(vals))
+	_, err = AllocMany[testStruct](&a, -1)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+	_, err = AllocMany[[17 * 32]byte](&a, 1)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+
+	// A failed batch leaves the arena as it was.
+	f := NewFixedArena(size * 4)
+	_, err = Alloc[testStruct](&f)
+	sbtest.Nil(t, err)
+	_, err = AllocMany[testStruct](&f, 4)
+	sbtest.ContainsError(t, OutOfSpaceErr, err)
+	sbtest.Eq(t, size, UsedBytes(&f))
+	vals, err = AllocMany[testStruct](&f, 3)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 3, len(vals))
+}
+
+func BenchmarkAllocMany(b *testing.B) {
+	b.Run("AllocMany", func(b *testing.B) {
+		a := NewArena(0)
+		for b.Loop() {
+			if _, err := AllocMany[testStruct](&a, 1000); err != nil {
+				b.Fatal(err)
+			}
+			Reset(&a)
+		}
+	})
+	b.Run("AllocLoop", func(b *testing.B) {
+		a := NewArena(0)
+		for b.Loop() {
+			for range 1000 {
+				if _, err := Alloc[testStruct](&a); err != nil {
+					b.Fatal(err)
+				}
+			}
+			Reset(&a)
+		}
+	})
+}
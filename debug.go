@@ -0,0 +1,290 @@
+package sbarena
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"time"
+	"unsafe"
+	"weak"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// State that is only maintained once [EnableDebug] has been called on an
+	// arena. Nil for arenas that are not in debug mode.
+	debugState struct {
+		allocSites map[allocStack]*allocSite
+		// The time the arenas lock was last acquired and the total time it
+		// has been held for.
+		lockedAt time.Time
+		lockHeld time.Duration
+	}
+
+	// The program counters of the call stack that performed an allocation,
+	// starting with the caller of the arenas allocation function.
+	allocStack [32]uintptr
+
+	// The aggregated allocations that were made from a single call stack.
+	allocSite struct {
+		allocs int64
+		bytes  int64
+	}
+)
+
+var (
+	DebugModeRequiredErr = errors.New(
+		"The operation is only available when the arena is in debug mode",
+	)
+	InvalidPlacementErr = errors.New(
+		"The requested location is outside of the arena or overlaps memory that is in use",
+	)
+)
+
+// The byte that the memory released by [Clear] is overwritten with when the
+// arena is in debug mode.
+const PoisonByte byte = 0xDE
+
+// Puts the arena into debug mode. Debug mode adds extra bookkeeping to every
+// allocation, making it considerably slower, in exchange for diagnostics such
+// as the allocation profile written by [WriteAllocProfile]. Calling this on an
+// arena that is already in debug mode does nothing.
+//
+// In debug mode [Clear] and its variants overwrite every byte of the memory
+// they release with [PoisonByte]. Values that are read through stale pointers
+// between clearing the arena and the memory being garbage collected then hold
+// obviously wrong values instead of their old contents, which makes use after
+// free bugs much easier to spot.
+func EnableDebug(a *Arena) {
+	lock(a)
+	defer unlock(a)
+	if a.debug == nil {
+		a.debug = &debugState{
+			allocSites: map[allocStack]*allocSite{},
+			lockedAt:   time.Now(),
+		}
+	}
+}
+
+// Returns the total time the arenas lock has been held for since [EnableDebug]
+// was called. Comparing this against the total time spent allocating shows
+// whether time goes to waiting on the lock or to the allocation work itself.
+// Zero is returned if the arena is not in debug mode.
+func LockHeldTime(a *Arena) time.Duration {
+	lock(a)
+	defer unlock(a)
+	if a.debug == nil {
+		return 0
+	}
+	return a.debug.lockHeld
+}
+
+// Records an allocation of `size` bytes against the call stack of the caller
+// of the function that called recordAlloc. This must be called directly from
+// the exported allocation function so that the arenas own frames are not part
+// of the recorded stack. The caller must hold the arenas lock.
+func recordAlloc(a *Arena, size uintptr) {
+	recordAllocSkip(a, size, 1)
+}
+
+// Behaves the same as [recordAlloc] except that `skip` additional frames
+// between the exported allocation function and the caller of recordAllocSkip
+// are left out of the recorded stack. The caller must hold the arenas lock.
+func recordAllocSkip(a *Arena, size uintptr, skip int) {
+	if a.debug == nil {
+		return
+	}
+	var stk allocStack
+	runtime.Callers(3+skip, stk[:])
+	site, ok := a.debug.allocSites[stk]
+	if !ok {
+		site = &allocSite{}
+		a.debug.allocSites[stk] = site
+	}
+	site.allocs++
+	site.bytes += int64(size)
+}
+
+// Writes the allocations that were made from the arena since [EnableDebug] was
+// called to `w`, grouped by the call stack that made them. The profile uses
+// the same text format as the heap profile written by [runtime/pprof] with a
+// debug level of 1, so it can be read with `go tool pprof` given the binary
+// that produced it. Memory in an arena is never released back on its own, so
+// every allocation is reported as both allocated and in use.
+//
+// Nothing is written if the arena is not in debug mode.
+func WriteAllocProfile(a *Arena, w io.Writer) error {
+	lock(a)
+	if a.debug == nil {
+		unlock(a)
+		return nil
+	}
+	type record struct {
+		stk allocStack
+		allocSite
+	}
+	records := make([]record, 0, len(a.debug.allocSites))
+	for stk, site := range a.debug.allocSites {
+		records = append(records, record{stk: stk, allocSite: *site})
+	}
+	unlock(a)
+
+	slices.SortFunc(records, func(l, r record) int {
+		return int(r.bytes - l.bytes)
+	})
+	var total allocSite
+	for _, r := range records {
+		total.allocs += r.allocs
+		total.bytes += r.bytes
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(
+		bw, "heap profile: %d: %d [%d: %d] @ heap/1\n",
+		total.allocs, total.bytes, total.allocs, total.bytes,
+	)
+	for _, r := range records {
+		stk := r.stk[:]
+		if i := slices.Index(stk, 0); i >= 0 {
+			stk = stk[:i]
+		}
+		fmt.Fprintf(
+			bw, "%d: %d [%d: %d] @",
+			r.allocs, r.bytes, r.allocs, r.bytes,
+		)
+		for _, pc := range stk {
+			fmt.Fprintf(bw, " %#x", pc)
+		}
+		fmt.Fprintln(bw)
+
+		frames := runtime.CallersFrames(stk)
+		for {
+			frame, more := frames.Next()
+			fmt.Fprintf(
+				bw, "#\t%#x\t%s+%#x\t%s:%d\n",
+				frame.PC, frame.Function, frame.PC-frame.Entry,
+				frame.File, frame.Line,
+			)
+			if !more {
+				break
+			}
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// Overwrites every byte of the arenas buckets, including the dedicated buckets
+// created by [AllocLarge], with [PoisonByte] if the arena is in debug mode. The
+// caller must hold the arenas lock.
+func poisonBuckets(a *Arena) {
+	if a.debug == nil {
+		return
+	}
+	for i, b := range a.buckets {
+		poisonBucket(a.kinds[i], b)
+	}
+	for i, b := range a.large {
+		poisonBucket(a.largeKinds[i], b)
+	}
+}
+
+// Overwrites every byte of `b` with [PoisonByte]. The bucket is zeroed first so
+// that the GC observes the pointers that are overwritten, see [zeroBucket]. The
+// caller must hold the arenas lock.
+func poisonBucket(kind bucketKind, b []byte) {
+	zeroBucket(kind, b)
+	for i := range b {
+		b[i] = PoisonByte
+	}
+}
+
+// Places a value of type T at exactly `offset` bytes into the bucket with index
+// `bucket`, rather than wherever [Alloc] would have put it. This exists so that
+// regression tests can reproduce memory corruption bugs that depend on where a
+// value lives, and is only available in debug mode, otherwise a
+// [DebugModeRequiredErr] is returned.
+//
+// The location must be at or after the first unused byte of the bucket that
+// values of type T are currently allocated from, or in a bucket that is not in
+// use yet, and must satisfy the alignment of T. Values with pointers and values
+// without pointers are allocated from different buckets, see [Arena]. An
+// [InvalidPlacementErr] is returned if the location is outside of the arena, is
+// not aligned, or would overlap memory that may already be in use.
+// The memory that is skipped to reach the location is counted as wasted, see
+// [WastedBytes], and is not used for any later allocations until the arena is
+// rewound.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocAt[T any](
+	a *Arena,
+	bucket int,
+	offset uintptr,
+) (weak.Pointer[T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	align := unsafe.Alignof(tmp)
+
+	lock(a)
+	defer unlock(a)
+	if a.debug == nil {
+		return weak.Make[T](nil), DebugModeRequiredErr
+	}
+	if err := checkOnHeap(a); err != nil {
+		return weak.Make[T](nil), err
+	}
+	useKind(a, kindOf[T]())
+	if bucket < 0 || bucket >= len(a.buckets) {
+		return weak.Make[T](nil), sberr.Wrap(
+			InvalidPlacementErr,
+			"Bucket: %d Num buckets: %d", bucket, len(a.buckets),
+		)
+	}
+	if n := uintptr(len(a.buckets[bucket])); offset >= n || size > n-offset {
+		return weak.Make[T](nil), sberr.Wrap(
+			InvalidPlacementErr,
+			"Offset: %d Size: %d Bucket size: %d", offset, size, n,
+		)
+	}
+	if (bucket <= frontier(a) && bucket != a.curBucket) ||
+		(bucket == a.curBucket && offset < a.bucketSize-a.bytesLeft) {
+		return weak.Make[T](nil), sberr.Wrap(
+			InvalidPlacementErr,
+			"Bucket: %d Offset: %d Current bucket: %d First unused byte: %d",
+			bucket, offset, a.curBucket, bucketUsed(a, a.curBucket),
+		)
+	}
+	if a.kinds[bucket] != a.kind {
+		if err := retypeBucket(a, bucket); err != nil {
+			return weak.Make[T](nil), err
+		}
+	}
+	b := a.buckets[bucket]
+	if uintptr(unsafe.Pointer(&b[offset]))%align != 0 {
+		return weak.Make[T](nil), sberr.Wrap(
+			InvalidPlacementErr, "Offset: %d Alignment: %d", offset, align,
+		)
+	}
+
+	if a.curBucket != bucket {
+		a.wastedBytes += a.bytesLeft
+		for i := frontier(a) + 1; i < bucket; i++ {
+			a.wastedBytes += uintptr(len(a.buckets[i]))
+			a.reusedBuckets++
+		}
+		a.reusedBuckets++
+		setCurBucket(a, bucket)
+	}
+	a.wastedBytes += offset - (a.bucketSize - a.bytesLeft)
+	a.bytesLeft = a.bucketSize - offset - size
+	addPayload(a, bucket, size)
+	a.allocs++
+	recordAlloc(a, size)
+	publishStats(a)
+	return weak.Make((*T)(unsafe.Pointer(&b[offset]))), nil
+}
@@ -0,0 +1,175 @@
+package sbarena
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+//go:noinline
+func allocFromSiteOne(a *Arena) error {
+	_, err := Alloc[testStruct](a)
+	return err
+}
+
+//go:noinline
+func allocFromSiteTwo(a *Arena) error {
+	_, err := Alloc[testStruct2](a)
+	return err
+}
+
+// Parses a profile written by [WriteAllocProfile] and returns the number of
+// bytes attributed to each function that appears directly as the caller of an
+// allocation.
+func parseAllocProfile(t *testing.T, profile string) map[string]int {
+	rv := map[string]int{}
+	blocks := strings.Split(profile, "\n\n")
+	sbtest.True(t, strings.HasPrefix(blocks[0], "heap profile: "))
+	for i, block := range blocks {
+		lines := strings.Split(block, "\n")
+		if i == 0 {
+			lines = lines[1:]
+		}
+		if len(lines) < 2 {
+			continue
+		}
+		bytesField := strings.Fields(lines[0])[1]
+		n, err := strconv.Atoi(bytesField)
+		sbtest.Nil(t, err)
+		fn := strings.Fields(lines[1])[2]
+		fn = fn[:strings.LastIndex(fn, "+")]
+		rv[fn] += n
+	}
+	return rv
+}
+
+func TestWriteAllocProfile(t *testing.T) {
+	a := NewArena(0)
+	EnableDebug(&a)
+	for range 3 {
+		sbtest.Nil(t, allocFromSiteOne(&a))
+	}
+	for range 5 {
+		sbtest.Nil(t, allocFromSiteTwo(&a))
+	}
+
+	var buf bytes.Buffer
+	sbtest.Nil(t, WriteAllocProfile(&a, &buf))
+	sites := parseAllocProfile(t, buf.String())
+	sbtest.Eq(
+		t,
+		3*int(unsafe.Sizeof(testStruct{})),
+		sites["github.com/barbell-math/smoothbrain-arena.allocFromSiteOne"],
+	)
+	sbtest.Eq(
+		t,
+		5*int(unsafe.Sizeof(testStruct2{})),
+		sites["github.com/barbell-math/smoothbrain-arena.allocFromSiteTwo"],
+	)
+}
+
+func TestWriteAllocProfileDebugDisabled(t *testing.T) {
+	a := NewArena(0)
+	sbtest.Nil(t, allocFromSiteOne(&a))
+
+	var buf bytes.Buffer
+	sbtest.Nil(t, WriteAllocProfile(&a, &buf))
+	sbtest.Eq(t, 0, buf.Len())
+}
+
+func TestLockHeldTime(t *testing.T) {
+	a := NewArena(0)
+	sbtest.Eq(t, 0, LockHeldTime(&a))
+
+	EnableDebug(&a)
+	start := time.Now()
+	for range 1000 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	held := LockHeldTime(&a)
+	elapsed := time.Since(start)
+	sbtest.True(t, held > 0)
+	sbtest.True(t, held <= elapsed)
+}
+
+func TestClearPoisonsMemory(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	for _, debug := range []bool{true, false} {
+		a := NewArena(0)
+		if debug {
+			EnableDebug(&a)
+		}
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		*p.Value() = testStruct{A: 1, B: 2, C: "three"}
+		large, err := AllocLarge[[DefaultBlockSize + 8]byte](&a)
+		sbtest.Nil(t, err)
+		large.Value()[0] = 1
+
+		// Stale raw pointers keep the old memory alive across the call.
+		raw := unsafe.Slice((*byte)(unsafe.Pointer(p.Value())), size)
+		rawLarge := large.Value()[:]
+		Clear(&a)
+
+		if debug {
+			sbtest.SlicesMatch(t, bytes.Repeat([]byte{PoisonByte}, int(size)), raw)
+			sbtest.SlicesMatch(
+				t, bytes.Repeat([]byte{PoisonByte}, len(rawLarge)), rawLarge,
+			)
+		} else {
+			v := (*testStruct)(unsafe.Pointer(unsafe.SliceData(raw)))
+			sbtest.Eq(t, testStruct{A: 1, B: 2, C: "three"}, *v)
+			sbtest.Eq(t, byte(1), rawLarge[0])
+		}
+	}
+}
+
+func TestAllocAt(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 4)
+	_, err := AllocAt[testStruct](&a, 0, 0)
+	sbtest.ContainsError(t, DebugModeRequiredErr, err)
+
+	EnableDebug(&a)
+	for range 8 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	Reset(&a)
+
+	p, err := AllocAt[testStruct](&a, 1, size*2)
+	sbtest.Nil(t, err)
+	*p.Value() = testStruct{A: 1, C: "placed"}
+	placed := (*testStruct)(unsafe.Add(
+		unsafe.Pointer(unsafe.SliceData(a.buckets[1])), size*2,
+	))
+	sbtest.Eq(t, testStruct{A: 1, C: "placed"}, *placed)
+	sbtest.Eq(t, size*6, WastedBytes(&a))
+
+	// Allocation continues after the placed value.
+	next, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(
+		t, uintptr(unsafe.Pointer(placed))+size,
+		uintptr(unsafe.Pointer(next.Value())),
+	)
+
+	for _, loc := range []struct {
+		bucket int
+		offset uintptr
+	}{
+		{0, 0}, {1, size * 2}, {1, size * 3}, {-1, 0}, {2, 0}, {1, size*3 + 8},
+	} {
+		_, err := AllocAt[testStruct](&a, loc.bucket, loc.offset)
+		sbtest.ContainsError(t, InvalidPlacementErr, err)
+	}
+	_, err = AllocAt[int64](&a, 1, size*4-4)
+	sbtest.ContainsError(t, InvalidPlacementErr, err)
+	sbtest.Eq(t, testStruct{A: 1, C: "placed"}, *p.Value())
+}
@@ -0,0 +1,67 @@
+package sbarena
+
+// Adds `n` bytes to the payload of the bucket at index `i`. The caller must
+// hold the arenas lock.
+func addPayload(a *Arena, i int, n uintptr) {
+	for len(a.payload) <= i {
+		a.payload = append(a.payload, 0)
+	}
+	a.payload[i] += n
+}
+
+// Removes `n` bytes from the payload of the bucket at index `i`. The caller
+// must hold the arenas lock.
+func subPayload(a *Arena, i int, n uintptr) {
+	if i < len(a.payload) {
+		a.payload[i] -= min(n, a.payload[i])
+	}
+}
+
+// Returns the fraction of the arenas memory that holds live allocations, as a
+// value between 0 and 1. This rolls everything that keeps the arena from using
+// its memory into a single number: alignment padding, space at the end of
+// buckets that was too small for the next value, the unused rest of the
+// current bucket, buckets that are allocated but unused and memory that was
+// returned with [Free].
+//
+// The payload bytes are the sizes of the values that were allocated and not
+// freed. The total is the memory the arena holds, as reported by
+// [TotalMemBytes]. Zero is returned if the arena holds no memory.
+func Efficiency(a *Arena) float64 {
+	lock(a)
+	defer unlock(a)
+
+	total := totalBytes(a)
+	if total == 0 {
+		return 0
+	}
+	payload := a.largeBytes
+	for _, n := range a.payload {
+		payload += n
+	}
+	return float64(payload) / float64(total)
+}
+
+// Returns the fraction of each bucket that holds live allocations, as values
+// between 0 and 1 indexed by bucket. This breaks [Efficiency] down by bucket,
+// which makes it easy to see how much space is lost at the end of each bucket
+// when values regularly do not fit in the rest of the current bucket. A bucket
+// size that is a poor match for the sizes of the allocated values shows up as
+// every full bucket reporting a utilization well below 1.
+//
+// The current bucket reports how much of it has been filled so far and the
+// buckets after it, such as those that are waiting to be reused after a call
+// to [Reset], report 0. Memory that was returned with [Free] and alignment
+// padding are not counted as utilized.
+func BucketUtilization(a *Arena) []float64 {
+	lock(a)
+	defer unlock(a)
+
+	rv := make([]float64, len(a.buckets))
+	for i := 0; i <= frontier(a) && i < len(a.buckets); i++ {
+		if i < len(a.payload) && len(a.buckets[i]) > 0 {
+			rv[i] = float64(a.payload[i]) / float64(len(a.buckets[i]))
+		}
+	}
+	return rv
+}
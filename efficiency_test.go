@@ -0,0 +1,92 @@
+package sbarena
+
+import (
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestEfficiency(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	// Only leaves room for two testStructs after the leading byte.
+	bucketSize := alignUp(1, unsafe.Alignof(testStruct{})) + 3*size - 1
+	total := float64(2 * bucketSize)
+	a := NewArena(bucketSize)
+	sbtest.EqFloat(t, 0, Efficiency(&a), 1e-9)
+
+	_, err := AllocContiguous[byte](&a)
+	sbtest.Nil(t, err)
+	p, err := AllocContiguous[testStruct](&a)
+	sbtest.Nil(t, err)
+	for range 2 {
+		_, err = AllocContiguous[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	// One byte, padding up to the alignment of testStruct, two testStructs,
+	// the unused tail of the first bucket and a testStruct in the second
+	// bucket.
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.EqFloat(t, float64(1+3*size)/total, Efficiency(&a), 1e-9)
+
+	sbtest.Nil(t, Free(&a, p))
+	sbtest.EqFloat(t, float64(1+2*size)/total, Efficiency(&a), 1e-9)
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.EqFloat(t, float64(1+3*size)/total, Efficiency(&a), 1e-9)
+
+	Truncate(&a, size)
+	sbtest.EqFloat(t, float64(1+2*size)/total, Efficiency(&a), 1e-9)
+
+	Reset(&a)
+	sbtest.EqFloat(t, 0, Efficiency(&a), 1e-9)
+
+	b := AllocRemaining(&a)
+	sbtest.EqFloat(t, float64(len(b))/total, Efficiency(&a), 1e-9)
+
+	Clear(&a)
+	sbtest.EqFloat(t, 0, Efficiency(&a), 1e-9)
+}
+
+func TestEfficiencyRollback(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	_, closer, err := AllocScoped[testStruct](&a)
+	sbtest.Nil(t, err)
+	for range 3 {
+		_, err = Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.EqFloat(t, 5.0/6, Efficiency(&a), 1e-9)
+	closer()
+	sbtest.EqFloat(t, 1.0/6, Efficiency(&a), 1e-9)
+
+	for range 3 {
+		_, err = Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	ResetBuckets(&a, 1)
+	sbtest.EqFloat(t, 2.0/6, Efficiency(&a), 1e-9)
+}
+
+func TestBucketUtilization(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size*2 + size/2)
+	sbtest.SlicesMatch(t, []float64{0}, BucketUtilization(&a))
+
+	// Only two values fit in each bucket, leaving half a value of space at
+	// the end of every full bucket.
+	for range 5 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.SlicesMatch(t, []float64{0.8, 0.8, 0.4}, BucketUtilization(&a))
+
+	Reset(&a)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.SlicesMatch(t, []float64{0.4, 0, 0}, BucketUtilization(&a))
+}
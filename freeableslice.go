@@ -0,0 +1,103 @@
+package sbarena
+
+import (
+	"unsafe"
+	"weak"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// A slice of values that are allocated contiguously in an [Arena], where
+	// each element can be individually returned to the arena with
+	// [FreeableSlice.Free] while the other elements remain valid. This is
+	// suitable for object pools that are laid out as arrays.
+	//
+	// Freed elements are placed in the arenas free lists, so they will be
+	// reused by later calls to [Alloc] for values of the same size class.
+	//
+	// A FreeableSlice is not safe for concurrent use.
+	FreeableSlice[T any] struct {
+		arena   *Arena
+		handles []weak.Pointer[T]
+		live    []bool
+	}
+)
+
+// Allocates `n` contiguous values of type T, returning a [FreeableSlice] that
+// provides a handle to each element. All `n` elements must fit in a single
+// bucket, otherwise a [ValueToLargeErr] will be returned.
+func AllocFreeableSlice[T any](a *Arena, n int) (FreeableSlice[T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	align := unsafe.Alignof(tmp)
+	if n < 0 {
+		return FreeableSlice[T]{}, sberr.Wrap(InvalidLengthErr, "Length: %d", n)
+	}
+	total, err := sliceBytes(a, uintptr(n), size)
+	if err != nil {
+		return FreeableSlice[T]{}, err
+	}
+	if n == 0 {
+		return FreeableSlice[T]{arena: a}, nil
+	}
+
+	lock(a)
+	if err := checkOnHeap(a); err != nil {
+		unlock(a)
+		return FreeableSlice[T]{}, err
+	}
+	bucketIdx, off, err := reserve(a, total, align, kindOf[T]())
+	if err != nil {
+		unlock(a)
+		return FreeableSlice[T]{}, err
+	}
+	base := unsafe.Pointer(&a.buckets[bucketIdx][off])
+	recordAlloc(a, total)
+	publishStats(a)
+	unlock(a)
+
+	rv := FreeableSlice[T]{
+		arena:   a,
+		handles: make([]weak.Pointer[T], n),
+		live:    make([]bool, n),
+	}
+	for i := range n {
+		rv.handles[i] = weak.Make((*T)(unsafe.Add(base, uintptr(i)*size)))
+		rv.live[i] = true
+	}
+	return rv, nil
+}
+
+// Returns the number of elements in the slice, including freed elements.
+func (f FreeableSlice[T]) Len() int {
+	return len(f.handles)
+}
+
+// Returns true if the i-th element has not been freed.
+func (f FreeableSlice[T]) Live(i int) bool {
+	return f.live[i]
+}
+
+// Returns a handle to the i-th element. If the element has been freed the
+// returned handle will be nil.
+func (f FreeableSlice[T]) Handle(i int) weak.Pointer[T] {
+	if !f.live[i] {
+		return weak.Make[T](nil)
+	}
+	return f.handles[i]
+}
+
+// Returns the i-th element to the arena so that it can be reused by later
+// allocations. Freeing an element that has already been freed returns an
+// [InvalidFreeErr].
+func (f FreeableSlice[T]) Free(i int) error {
+	if !f.live[i] {
+		return sberr.Wrap(InvalidFreeErr, "Element %d was already freed", i)
+	}
+	if err := Free(f.arena, f.handles[i]); err != nil {
+		return err
+	}
+	f.live[i] = false
+	return nil
+}
@@ -0,0 +1,70 @@
+package sbarena
+
+import (
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestFreeableSlice(t *testing.T) {
+	a := NewArena(0)
+	s, err := AllocFreeableSlice[testStruct](&a, 8)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 8, s.Len())
+
+	for i := range s.Len() {
+		sbtest.True(t, s.Live(i))
+		*s.Handle(i).Value() = testStruct{A: i}
+		if i > 0 {
+			sbtest.Eq(
+				t,
+				unsafe.Add(
+					unsafe.Pointer(s.Handle(i-1).Value()),
+					unsafe.Sizeof(testStruct{}),
+				),
+				unsafe.Pointer(s.Handle(i).Value()),
+			)
+		}
+	}
+
+	freed := map[unsafe.Pointer]struct{}{}
+	for i := 0; i < s.Len(); i += 2 {
+		freed[unsafe.Pointer(s.Handle(i).Value())] = struct{}{}
+		sbtest.Nil(t, s.Free(i))
+		sbtest.False(t, s.Live(i))
+		sbtest.Nil(t, s.Handle(i).Value())
+	}
+	sbtest.ContainsError(t, InvalidFreeErr, s.Free(0))
+
+	bytesLeft := syncedBytesLeft(&a)
+	for range 4 {
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		_, ok := freed[unsafe.Pointer(p.Value())]
+		sbtest.True(t, ok)
+		delete(freed, unsafe.Pointer(p.Value()))
+		*p.Value() = testStruct{A: -1}
+	}
+	sbtest.Eq(t, bytesLeft, syncedBytesLeft(&a))
+
+	for i := 1; i < s.Len(); i += 2 {
+		sbtest.True(t, s.Live(i))
+		sbtest.Eq(t, testStruct{A: i}, *s.Handle(i).Value())
+	}
+}
+
+func TestFreeableSliceErrors(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 4)
+	_, err := AllocFreeableSlice[testStruct](&a, 5)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	_, err = AllocFreeableSlice[testStruct](&a, -1)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+
+	s, err := AllocFreeableSlice[testStruct](&a, 4)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 4, s.Len())
+	s, err = AllocFreeableSlice[testStruct](&a, 0)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, s.Len())
+}
@@ -0,0 +1,322 @@
+package sbarena
+
+import (
+	"errors"
+	"math/bits"
+	"unsafe"
+	"weak"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// A region of arena memory that was returned to the arena with [Free].
+	freeSlot struct {
+		ptr    unsafe.Pointer
+		size   uintptr
+		bucket int
+	}
+
+	// Free slots binned by power of two size classes. A slot of n bytes is
+	// placed in bin floor(log2(n)).
+	freeLists struct {
+		bins [bits.UintSize][]freeSlot
+		len  int
+		// Indexes of the free slots by their start and end addresses. These
+		// are only maintained when coalescing is enabled.
+		byStart map[uintptr]freeSlot
+		byEnd   map[uintptr]freeSlot
+	}
+)
+
+var (
+	InvalidFreeErr = errors.New(
+		"The supplied pointer does not reference memory allocated by the arena",
+	)
+	DoubleFreeErr = errors.New(
+		"The supplied pointer references memory that was already freed",
+	)
+)
+
+// Returns the size class that a slot or allocation of `size` bytes belongs to.
+// `size` must be greater than zero.
+func sizeClass(size uintptr) int {
+	return bits.Len(uint(size)) - 1
+}
+
+// Adds a slot to the free list bin that matches its size class. If coalescing
+// is enabled the slot is first merged with any free slots that directly border
+// it in the same bucket. The caller must hold the arenas lock.
+func pushFree(a *Arena, s freeSlot) {
+	if a.free == nil {
+		a.free = &freeLists{}
+	}
+	if a.coalesceFrees {
+		if a.free.byStart == nil {
+			indexFree(a.free)
+		}
+		start := uintptr(s.ptr)
+		if left, ok := a.free.byEnd[start]; ok && left.bucket == s.bucket {
+			removeFree(a.free, left)
+			s.ptr = left.ptr
+			s.size += left.size
+		}
+		end := uintptr(s.ptr) + s.size
+		if right, ok := a.free.byStart[end]; ok && right.bucket == s.bucket {
+			removeFree(a.free, right)
+			s.size += right.size
+		}
+		a.free.byStart[uintptr(s.ptr)] = s
+		a.free.byEnd[uintptr(s.ptr)+s.size] = s
+	}
+
+	bin := &a.free.bins[sizeClass(s.size)]
+	*bin = append(*bin, s)
+	a.free.len++
+}
+
+// Returns true if any of the `size` bytes starting at `ptr` are part of a slot
+// in the free lists.
+func isFree(f *freeLists, ptr unsafe.Pointer, size uintptr) bool {
+	start, end := uintptr(ptr), uintptr(ptr)+size
+	for _, bin := range f.bins {
+		for _, s := range bin {
+			if start < uintptr(s.ptr)+s.size && uintptr(s.ptr) < end {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Builds the start and end address indexes for all slots in the free lists.
+func indexFree(f *freeLists) {
+	f.byStart = map[uintptr]freeSlot{}
+	f.byEnd = map[uintptr]freeSlot{}
+	for _, bin := range f.bins {
+		for _, s := range bin {
+			f.byStart[uintptr(s.ptr)] = s
+			f.byEnd[uintptr(s.ptr)+s.size] = s
+		}
+	}
+}
+
+// Removes the supplied slot from the free lists.
+func removeFree(f *freeLists, s freeSlot) {
+	bin := &f.bins[sizeClass(s.size)]
+	for i := range *bin {
+		if (*bin)[i].ptr == s.ptr {
+			removeFreeIdx(f, bin, i)
+			return
+		}
+	}
+}
+
+// Removes the i-th slot from the supplied bin.
+func removeFreeIdx(f *freeLists, bin *[]freeSlot, i int) {
+	s := (*bin)[i]
+	(*bin)[i] = (*bin)[len(*bin)-1]
+	*bin = (*bin)[:len(*bin)-1]
+	f.len--
+	if f.byStart != nil {
+		delete(f.byStart, uintptr(s.ptr))
+		delete(f.byEnd, uintptr(s.ptr)+s.size)
+	}
+}
+
+// Removes all free slots in the bucket at index `bucket` that overlap the
+// memory at or after `addr`, along with all free slots in later buckets. This
+// must be called whenever memory is given back to the bump allocator so that
+// it is never handed out twice. Returns the number of free bytes at or after
+// `addr` in the bucket at index `bucket` that were discarded. The caller must
+// hold the arenas lock.
+func discardFreeAfter(a *Arena, bucket int, addr uintptr) uintptr {
+	if a.free == nil {
+		return 0
+	}
+	var rv uintptr
+	for class := range a.free.bins {
+		bin := &a.free.bins[class]
+		for i := len(*bin) - 1; i >= 0; i-- {
+			s := (*bin)[i]
+			if s.bucket > bucket ||
+				(s.bucket == bucket && uintptr(s.ptr)+s.size > addr) {
+				removeFreeIdx(a.free, bin, i)
+			}
+			if s.bucket == bucket && uintptr(s.ptr)+s.size > addr {
+				rv += uintptr(s.ptr) + s.size - max(uintptr(s.ptr), addr)
+			}
+		}
+	}
+	return rv
+}
+
+// Removes and returns a free slot that can hold a value of the supplied size
+// and alignment, or nil if there is no such slot.
+//
+// Normally only slots from the bin that matches the size class of `size` are
+// considered so that allocations of one size class never consume slots from
+// another. When coalescing is enabled larger size classes are also searched,
+// and any part of the slot that is not needed is returned to the free lists.
+//
+// The caller must hold the arenas lock.
+func popFree(a *Arena, size uintptr, align uintptr) unsafe.Pointer {
+	if a.free == nil || a.free.len == 0 || size == 0 {
+		return nil
+	}
+	lastClass := sizeClass(size)
+	if a.coalesceFrees {
+		lastClass = len(a.free.bins) - 1
+	}
+	for class := sizeClass(size); class <= lastClass; class++ {
+		bin := &a.free.bins[class]
+		for i := len(*bin) - 1; i >= 0; i-- {
+			s := (*bin)[i]
+			if s.size < size || uintptr(s.ptr)%align != 0 {
+				continue
+			}
+			removeFreeIdx(a.free, bin, i)
+			addPayload(a, s.bucket, size)
+			if a.coalesceFrees && s.size > size {
+				pushFree(a, freeSlot{
+					ptr:    unsafe.Add(s.ptr, size),
+					size:   s.size - size,
+					bucket: s.bucket,
+				})
+			}
+			return s.ptr
+		}
+	}
+	return nil
+}
+
+// Removes the free slot that starts at `ptr` from the free lists and returns
+// true, or returns false if there is no such slot that can hold `size` bytes.
+// The slot is gone once the memory was handed out to another allocation or the
+// arena was rewound past it. When coalescing is enabled any part of the slot
+// that is not needed is returned to the free lists. `size` must be greater
+// than zero.
+//
+// The caller must hold the arenas lock.
+func takeFree(a *Arena, ptr unsafe.Pointer, size uintptr) bool {
+	bucketIdx, _, ok := findAllocated(a, ptr, size)
+	if !ok {
+		return false
+	}
+	useKind(a, a.kinds[bucketIdx])
+	if a.free == nil || a.free.len == 0 {
+		return false
+	}
+	lastClass := sizeClass(size)
+	if a.coalesceFrees {
+		lastClass = len(a.free.bins) - 1
+	}
+	for class := sizeClass(size); class <= lastClass; class++ {
+		bin := &a.free.bins[class]
+		for i, s := range *bin {
+			if s.ptr != ptr || s.size < size {
+				continue
+			}
+			removeFreeIdx(a.free, bin, i)
+			addPayload(a, s.bucket, size)
+			if a.coalesceFrees && s.size > size {
+				pushFree(a, freeSlot{
+					ptr:    unsafe.Add(s.ptr, size),
+					size:   s.size - size,
+					bucket: s.bucket,
+				})
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Enables or disables coalescing of free memory. When enabled, freeing memory
+// that directly borders other free memory in the same bucket merges the two
+// into a single larger free region. Allocations are then also allowed to take
+// memory from free regions of a larger size class than their own, with any
+// unused part of the region remaining free. This reduces fragmentation when
+// values of many different sizes are freed and allocated.
+//
+// Coalescing is disabled by default.
+func SetCoalesceFrees(a *Arena, enabled bool) {
+	lock(a)
+	defer unlock(a)
+
+	a.coalesceFrees = enabled
+	for _, f := range []*freeLists{a.free, a.parked.free} {
+		if f == nil {
+			continue
+		}
+		if enabled {
+			indexFree(f)
+		} else {
+			f.byStart = nil
+			f.byEnd = nil
+		}
+	}
+}
+
+// Returns the index of the bucket that contains the `size` bytes starting at
+// `ptr` along with the offset of `ptr` into that bucket. Only memory that has
+// already been handed out by the arena is considered. The caller must hold the
+// arenas lock.
+func findAllocated(
+	a *Arena,
+	ptr unsafe.Pointer,
+	size uintptr,
+) (int, uintptr, bool) {
+	addr := uintptr(ptr)
+	for i := 0; i < len(a.buckets) && i <= frontier(a); i++ {
+		base := uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[i])))
+		used := bucketUsed(a, i)
+		if addr >= base && addr+size <= base+used {
+			return i, addr - base, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Returns the memory referenced by `p` to the arena so that later allocations
+// can reuse it. The memory is placed in a free list bin determined by its power
+// of two size class and [Alloc] will take memory from the bin that matches the
+// size class of the requested type before falling back to bump allocating.
+// Allocations never consume free memory from a different size class unless
+// coalescing has been enabled with [SetCoalesceFrees].
+//
+// `p` must reference memory that was allocated by this arena as a T, otherwise
+// an [InvalidFreeErr] is returned. Freeing nil or a zero sized value is a no-op.
+// After a value has been freed `p` will still reference the memory, but the
+// memory may be handed out to a different allocation at any time.
+//
+// In debug mode, see [EnableDebug], freeing memory that is already free
+// returns a [DoubleFreeErr] rather than placing the memory in the free lists a
+// second time, which would cause it to be handed out to two allocations.
+//
+// All free lists are discarded by [Reset] and [Clear], as the memory they
+// reference will be reused by bump allocation anyways.
+func Free[T any](a *Arena, p weak.Pointer[T]) error {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	ptr := unsafe.Pointer(p.Value())
+	if ptr == nil || size == 0 {
+		return nil
+	}
+
+	lock(a)
+	defer unlock(a)
+
+	bucketIdx, _, ok := findAllocated(a, ptr, size)
+	if !ok {
+		return sberr.Wrap(InvalidFreeErr, "Address: %p Size: %d", ptr, size)
+	}
+	// The slot is reused by values of the same kind as the bucket it is in.
+	useKind(a, a.kinds[bucketIdx])
+	if a.debug != nil && a.free != nil && isFree(a.free, ptr, size) {
+		return sberr.Wrap(DoubleFreeErr, "Address: %p Size: %d", ptr, size)
+	}
+	pushFree(a, freeSlot{ptr: ptr, size: size, bucket: bucketIdx})
+	subPayload(a, bucketIdx, size)
+	return nil
+}
@@ -0,0 +1,263 @@
+package sbarena
+
+import (
+	"testing"
+	"unsafe"
+	"weak"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestFreeReusesSameSizeClass(t *testing.T) {
+	a := NewArena(0)
+
+	small, err := Alloc[*int](&a)
+	sbtest.Nil(t, err)
+	medium, err := Alloc[[2]*int](&a)
+	sbtest.Nil(t, err)
+	large, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	bytesLeft := syncedBytesLeft(&a)
+
+	sbtest.Nil(t, Free(&a, small))
+	sbtest.Nil(t, Free(&a, medium))
+	sbtest.Nil(t, Free(&a, large))
+
+	large2, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Pointer(large.Value()), unsafe.Pointer(large2.Value()))
+	medium2, err := Alloc[[2]*int](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Pointer(medium.Value()), unsafe.Pointer(medium2.Value()))
+	small2, err := Alloc[*int](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Pointer(small.Value()), unsafe.Pointer(small2.Value()))
+	sbtest.Eq(t, bytesLeft, syncedBytesLeft(&a))
+	sbtest.Eq(t, 0, a.free.len)
+}
+
+func TestFreeNoCrossClassMixing(t *testing.T) {
+	a := NewArena(0)
+
+	smalls := [4]weak.Pointer[int64]{}
+	for i := range smalls {
+		p, err := Alloc[int64](&a)
+		sbtest.Nil(t, err)
+		smalls[i] = p
+	}
+	for _, p := range smalls {
+		sbtest.Nil(t, Free(&a, p))
+	}
+
+	// A 16 byte value must not consume the freed 8 byte slots, even though
+	// two of them are adjacent.
+	bytesLeft := syncedBytesLeft(&a)
+	medium, err := Alloc[[2]int64](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, bytesLeft-16, syncedBytesLeft(&a))
+	for _, p := range smalls {
+		sbtest.Neq[unsafe.Pointer](t, unsafe.Pointer(p.Value()), unsafe.Pointer(medium.Value()))
+	}
+
+	// A smaller value of a different size class must not consume the freed
+	// 16 byte slot.
+	sbtest.Nil(t, Free(&a, medium))
+	bytesLeft = syncedBytesLeft(&a)
+	b, err := Alloc[int32](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, bytesLeft-4, syncedBytesLeft(&a))
+	sbtest.Neq[unsafe.Pointer](t, unsafe.Pointer(medium.Value()), unsafe.Pointer(b.Value()))
+
+	// Values of the same size class reuse slots even if their sizes differ.
+	// The 24 byte slot is in the same class as a 16 byte value.
+	c, err := Alloc[[3]int64](&a)
+	sbtest.Nil(t, err)
+	sbtest.Nil(t, Free(&a, c))
+	medium2, err := Alloc[[2]int64](&a)
+	sbtest.Nil(t, err)
+	sbtest.True(
+		t,
+		unsafe.Pointer(medium2.Value()) == unsafe.Pointer(medium.Value()) ||
+			unsafe.Pointer(medium2.Value()) == unsafe.Pointer(c.Value()),
+	)
+}
+
+func TestFreeChurn(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 8)
+
+	vals := []weak.Pointer[testStruct]{}
+	small := []weak.Pointer[int64]{}
+	for range 8 {
+		v, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		vals = append(vals, v)
+		s, err := Alloc[int64](&a)
+		sbtest.Nil(t, err)
+		small = append(small, s)
+	}
+	numBuckets := NumBuckets(&a)
+	for range 100 {
+		for i := range vals {
+			sbtest.Nil(t, Free(&a, vals[i]))
+			sbtest.Nil(t, Free(&a, small[i]))
+		}
+		for i := range vals {
+			v, err := Alloc[testStruct](&a)
+			sbtest.Nil(t, err)
+			*v.Value() = testStruct{A: i}
+			vals[i] = v
+			s, err := Alloc[int64](&a)
+			sbtest.Nil(t, err)
+			*s.Value() = int64(i)
+			small[i] = s
+		}
+	}
+	sbtest.Eq(t, numBuckets, NumBuckets(&a))
+	for i := range vals {
+		sbtest.Eq(t, testStruct{A: i}, *vals[i].Value())
+		sbtest.Eq(t, int64(i), *small[i].Value())
+	}
+}
+
+func TestFreeInvalid(t *testing.T) {
+	a := NewArena(0)
+	b := NewArena(0)
+
+	p, err := Alloc[testStruct](&b)
+	sbtest.Nil(t, err)
+	sbtest.ContainsError(t, InvalidFreeErr, Free(&a, p))
+	sbtest.Nil(t, Free(&a, weak.Make[testStruct](nil)))
+
+	p, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	Reset(&a)
+	sbtest.ContainsError(t, InvalidFreeErr, Free(&a, p))
+}
+
+func TestFreeListsDiscardedOnReset(t *testing.T) {
+	a := NewArena(0)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Nil(t, Free(&a, p))
+	Reset(&a)
+	sbtest.Nil(t, a.free)
+}
+
+func TestFreeCoalesce(t *testing.T) {
+	a := NewArena(0)
+	SetCoalesceFrees(&a, true)
+
+	first, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	second, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	third, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	bytesLeft := syncedBytesLeft(&a)
+
+	// Free out of order so both the left and right neighbors get merged.
+	sbtest.Nil(t, Free(&a, first))
+	sbtest.Nil(t, Free(&a, third))
+	sbtest.Eq(t, 2, a.free.len)
+	sbtest.Nil(t, Free(&a, second))
+	sbtest.Eq(t, 1, a.free.len)
+	sbtest.Eq(
+		t,
+		3*unsafe.Sizeof(testStruct{}),
+		a.free.byStart[uintptr(unsafe.Pointer(first.Value()))].size,
+	)
+
+	large, err := Alloc[[2]testStruct2](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Pointer(first.Value()), unsafe.Pointer(large.Value()))
+	sbtest.Eq(t, bytesLeft, syncedBytesLeft(&a))
+
+	// The remainder of the coalesced region is still available.
+	rest := 3*unsafe.Sizeof(testStruct{}) - unsafe.Sizeof([2]testStruct2{})
+	sbtest.Eq(t, 1, a.free.len)
+	small, err := Alloc[*int](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(
+		t,
+		unsafe.Add(
+			unsafe.Pointer(first.Value()), unsafe.Sizeof([2]testStruct2{}),
+		),
+		unsafe.Pointer(small.Value()),
+	)
+	sbtest.Eq(t, rest > unsafe.Sizeof((*int)(nil)), a.free.len == 1)
+	sbtest.Eq(t, bytesLeft, syncedBytesLeft(&a))
+}
+
+func TestFreeCoalesceDisabled(t *testing.T) {
+	a := NewArena(0)
+
+	first, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	second, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Nil(t, Free(&a, first))
+	sbtest.Nil(t, Free(&a, second))
+	sbtest.Eq(t, 2, a.free.len)
+
+	bytesLeft := syncedBytesLeft(&a)
+	large, err := Alloc[[2]testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, bytesLeft-2*unsafe.Sizeof(testStruct{}), syncedBytesLeft(&a))
+	sbtest.Neq[unsafe.Pointer](
+		t, unsafe.Pointer(first.Value()), unsafe.Pointer(large.Value()),
+	)
+
+	// Enabling coalescing later indexes the existing free slots so that they
+	// can be merged with later frees. The large value directly follows the
+	// second value.
+	SetCoalesceFrees(&a, true)
+	sbtest.Eq(t, 2, len(a.free.byStart))
+	sbtest.Nil(t, Free(&a, large))
+	sbtest.Eq(t, 2, a.free.len)
+	sbtest.Eq(
+		t,
+		3*unsafe.Sizeof(testStruct{}),
+		a.free.byStart[uintptr(unsafe.Pointer(second.Value()))].size,
+	)
+}
+
+func TestFreeCoalesceSameBucketOnly(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}))
+	SetCoalesceFrees(&a, true)
+
+	vals := [4]weak.Pointer[testStruct]{}
+	for i := range vals {
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		vals[i] = p
+	}
+	for _, p := range vals {
+		sbtest.Nil(t, Free(&a, p))
+	}
+	// Every value is in its own bucket, so even if the buckets happen to be
+	// adjacent in memory nothing can be merged.
+	sbtest.Eq(t, 4, a.free.len)
+}
+
+func TestFreeDoubleFreeDebug(t *testing.T) {
+	for _, coalesce := range []bool{false, true} {
+		a := NewArena(0)
+		EnableDebug(&a)
+		SetCoalesceFrees(&a, coalesce)
+
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		p2, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		sbtest.Nil(t, Free(&a, p))
+		sbtest.Nil(t, Free(&a, p2))
+		sbtest.ContainsError(t, DoubleFreeErr, Free(&a, p))
+		sbtest.ContainsError(t, DoubleFreeErr, Free(&a, p2))
+
+		// Once the memory is handed out again it can be freed again.
+		p3, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		sbtest.Nil(t, Free(&a, p3))
+		sbtest.ContainsError(t, DoubleFreeErr, Free(&a, p3))
+	}
+}
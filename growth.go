@@ -0,0 +1,122 @@
+package sbarena
+
+import "slices"
+
+type (
+	// Controls the size of the buckets an arena allocates as it grows. See
+	// [NewArenaWithPolicy].
+	GrowthPolicy int
+)
+
+const (
+	// Every bucket has the same size. This is the policy used by all arenas
+	// that are not created with [NewArenaWithPolicy].
+	FixedGrowth GrowthPolicy = iota
+	// Every bucket is twice the size of the bucket before it, up to a maximum
+	// bucket size.
+	ExponentialGrowth
+)
+
+// Creates a new [Arena] allocator whose buckets are sized according to
+// `policy`. The first bucket is `bucketSizeBytes` bytes large. With
+// [ExponentialGrowth] every following bucket is twice as large as the one
+// before it until `maxBucketSizeBytes` is reached, after which all buckets are
+// `maxBucketSizeBytes` large. This lets an arena start small and still grow
+// quickly when a lot of memory is needed. With [FixedGrowth] the arena is the
+// same as one created with [NewArena] and `maxBucketSizeBytes` is ignored.
+//
+// The size of a bucket only depends on its position, so buckets that are
+// reused after a call to [Reset] keep their sizes. Values must fit in the
+// current bucket, so [Alloc] and similar functions return a [ValueToLargeErr]
+// for values that are larger than the current bucket even if a later bucket
+// would be large enough to hold them. [BucketSizeBytes] returns the size of the
+// first bucket.
+//
+// If `bucketSizeBytes` is <=0 then [DefaultBlockSize] is used. If
+// `maxBucketSizeBytes` is smaller than the first bucket then every bucket has
+// the size of the first bucket.
+func NewArenaWithPolicy(
+	bucketSizeBytes uintptr,
+	maxBucketSizeBytes uintptr,
+	policy GrowthPolicy,
+) (rv Arena) {
+	rv = NewArena(bucketSizeBytes)
+	rv.growth = policy
+	rv.baseBucketSize = rv.bucketSize
+	rv.maxBucketSize = max(maxBucketSizeBytes, rv.bucketSize)
+	publishStats(&rv)
+	return
+}
+
+// Returns the size of the bucket at index `i` according to the arenas growth
+// policy. The caller must hold the arenas lock.
+func bucketSizeAt(a *Arena, i int) uintptr {
+	if a.growth != ExponentialGrowth {
+		return a.bucketSize
+	}
+	size := a.baseBucketSize
+	for ; i > 0 && size < a.maxBucketSize; i-- {
+		size = min(size*2, a.maxBucketSize)
+	}
+	return size
+}
+
+// Returns the combined size of the first `n` buckets. The actual length of
+// each bucket is used rather than the size the growth policy says it should
+// have, so the result is correct no matter how the buckets were created. The
+// caller must hold the arenas lock.
+func bucketsBytes(a *Arena, n int) uintptr {
+	if n == 0 {
+		return 0
+	}
+	return a.bucketEnds[n-1]
+}
+
+// Appends `b`, whose memory is of `kind`, to the arenas buckets, keeping the
+// running bucket lengths that [bucketsBytes] and [bucketAt] use up to date.
+// Every bucket must be added to the arena through this function. The caller
+// must hold the arenas lock.
+func appendBucket(a *Arena, b bucket, kind bucketKind) {
+	a.bucketEnds = append(
+		a.bucketEnds, bucketsBytes(a, len(a.buckets))+uintptr(len(b)),
+	)
+	a.buckets = append(a.buckets, b)
+	a.kinds = append(a.kinds, kind)
+}
+
+// Returns the size of the first bucket the arena allocates, which is the size
+// of every bucket unless the arena uses [ExponentialGrowth]. The caller must
+// hold the arenas lock.
+func initialBucketSize(a *Arena) uintptr {
+	if a.growth != ExponentialGrowth {
+		return a.bucketSize
+	}
+	return a.baseBucketSize
+}
+
+// Makes the bucket at index `i` the current bucket, with all of its space
+// unused. The caller must hold the arenas lock.
+func setCurBucket(a *Arena, i int) {
+	a.bucketSize = bucketSizeAt(a, i)
+	a.curBucket = i
+	a.bytesLeft = a.bucketSize
+}
+
+// Returns the index of the bucket that holds the byte at offset `off` when all
+// of the arenas buckets are laid out back to back, along with the offset of the
+// byte in that bucket. An index of len(a.buckets) is returned if `off` is past
+// the end of the last bucket. The caller must hold the arenas lock.
+func bucketAt(a *Arena, off uint64) (int, uint64) {
+	i, _ := slices.BinarySearchFunc(
+		a.bucketEnds, off, func(end uintptr, off uint64) int {
+			if uint64(end) <= off {
+				return -1
+			}
+			return 1
+		},
+	)
+	if i >= len(a.buckets) {
+		return len(a.buckets), 0
+	}
+	return i, off - uint64(bucketsBytes(a, i))
+}
@@ -0,0 +1,92 @@
+package sbarena
+
+import (
+	"bytes"
+	"testing"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestNewArenaWithPolicyExponential(t *testing.T) {
+	a := NewArenaWithPolicy(64, 256, ExponentialGrowth)
+	for range 11 {
+		_, err := Alloc[[64]byte](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 4, NumBuckets(&a))
+	for i, size := range []int{64, 128, 256, 256} {
+		sbtest.Eq(t, size, len(a.buckets[i]))
+	}
+	sbtest.Eq(t, uintptr(64), BucketSizeBytes(&a))
+	sbtest.Eq(t, uintptr(64+128+256+256), TotalMemBytes(&a))
+	sbtest.Eq(t, uintptr(64+128+256+256), UsedBytes(&a))
+	sbtest.Eq(t, uintptr(0), FreeBytes(&a))
+
+	_, err := Alloc[[64]byte](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 5, NumBuckets(&a))
+	sbtest.Eq(t, 256, len(a.buckets[4]))
+
+	// Reused buckets keep their sizes.
+	Reset(&a)
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+	for range 3 {
+		_, err := Alloc[[64]byte](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 1, a.curBucket)
+	sbtest.Eq(t, uintptr(64+128+256*3), TotalMemBytes(&a))
+	sbtest.Eq(t, 5, NumBuckets(&a))
+}
+
+func TestNewArenaWithPolicyRejectsLargerThanCurrentBucket(t *testing.T) {
+	a := NewArenaWithPolicy(64, 256, ExponentialGrowth)
+	_, err := Alloc[[128]byte](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+
+	_, err = Alloc[[64]byte](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[[64]byte](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 1, a.curBucket)
+
+	_, err = Alloc[[256]byte](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	_, err = Alloc[[128]byte](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 2, a.curBucket)
+	_, err = Alloc[[256]byte](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[[512]byte](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestNewArenaWithPolicyRecords(t *testing.T) {
+	a := NewArenaWithPolicy(16, 1024, ExponentialGrowth)
+	offsets := make([]uint64, 10)
+	for i := range offsets {
+		var err error
+		offsets[i], err = AppendRecord(&a, bytes.Repeat([]byte{byte(i)}, 14))
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 4, NumBuckets(&a))
+	for i := range offsets {
+		rec, err := ReadRecord(&a, offsets[i])
+		sbtest.Nil(t, err)
+		sbtest.SlicesMatch(t, bytes.Repeat([]byte{byte(i)}, 14), rec)
+	}
+	_, err := ReadRecord(&a, uint64(TotalMemBytes(&a)))
+	sbtest.ContainsError(t, InvalidRecordErr, err)
+}
+
+func TestNewArenaWithPolicyFixed(t *testing.T) {
+	a := NewArenaWithPolicy(64, 256, FixedGrowth)
+	for range 4 {
+		_, err := Alloc[[64]byte](&a)
+		sbtest.Nil(t, err)
+	}
+	for i := range a.buckets {
+		sbtest.Eq(t, 64, len(a.buckets[i]))
+	}
+	sbtest.Eq(t, uintptr(256), TotalMemBytes(&a))
+}
@@ -0,0 +1,110 @@
+//go:build linux || darwin
+
+package sbarena
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// Allocates buckets outside of the go heap, each one directly followed by
+	// an inaccessible guard page.
+	guardAllocator struct {
+		mappings guardMappings
+	}
+
+	// The memory mappings that back the buckets of a guardAllocator, keyed
+	// by the address of the first byte of the bucket they back.
+	guardMappings map[uintptr][]byte
+)
+
+// Creates a new [Arena] whose buckets are allocated outside of the go heap with
+// mmap, each one directly followed by an inaccessible guard page. Any write
+// that runs past the end of a bucket will immediately fault instead of silently
+// corrupting adjacent memory, making this a debugging aid for tracking down
+// memory safety bugs in code that uses the arena.
+//
+// Each bucket is placed at the very end of its own mapping so that the guard
+// page directly follows the last byte of the bucket. As a result every bucket
+// consumes at least one page of memory plus the guard page.
+//
+// Because the memory does not live on the go heap the garbage collector does
+// not scan it and weak pointers cannot reference it, so functions such as
+// [Alloc] that return weak pointers will return a [NonHeapMemoryErr]. Values
+// stored in the arena must not hold the only reference to any go heap memory.
+//
+// The memory is unmapped when [Clear] is called or once the arena is garbage
+// collected.
+func NewGuardedArena(bucketSizeBytes uintptr) (rv Arena, err error) {
+	if bucketSizeBytes <= 0 {
+		bucketSizeBytes = DefaultBlockSize
+	}
+
+	g := &guardAllocator{mappings: guardMappings{}}
+	runtime.AddCleanup(g, guardMappings.unmapAll, g.mappings)
+
+	b := g.alloc(bucketSizeBytes, plainKind)
+	if b == nil {
+		err = sberr.Wrap(
+			BucketAllocationErr, "Bucket size: %d", bucketSizeBytes,
+		)
+		return
+	}
+	rv.arenaState = arenaState{
+		curBucket:    0,
+		bytesLeft:    bucketSizeBytes,
+		bucketSize:   bucketSizeBytes,
+		allocator:    g,
+		freshBuckets: 1,
+		parked:       lanePos{bucket: -1},
+	}
+	appendBucket(&rv, b, plainKind)
+	publishStats(&rv)
+	return
+}
+
+func (g *guardAllocator) alloc(size uintptr, kind bucketKind) bucket {
+	pageSize := uintptr(os.Getpagesize())
+	dataLen := alignUp(size, pageSize)
+
+	m, err := syscall.Mmap(
+		-1, 0, int(dataLen+pageSize),
+		syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE,
+	)
+	if err != nil {
+		return nil
+	}
+	if err := syscall.Mprotect(m[dataLen:], syscall.PROT_NONE); err != nil {
+		syscall.Munmap(m)
+		return nil
+	}
+
+	b := bucket(m[dataLen-size : dataLen : dataLen])
+	g.mappings[uintptr(unsafe.Pointer(unsafe.SliceData(b)))] = m
+	return b
+}
+
+func (g *guardAllocator) free(b bucket, kind bucketKind) {
+	key := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+	if m, ok := g.mappings[key]; ok {
+		syscall.Munmap(m)
+		delete(g.mappings, key)
+	}
+}
+
+func (g *guardAllocator) onHeap() bool {
+	return false
+}
+
+func (m guardMappings) unmapAll() {
+	for _, mapping := range m {
+		syscall.Munmap(mapping)
+	}
+	clear(m)
+}
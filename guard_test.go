@@ -0,0 +1,71 @@
+//go:build linux || darwin
+
+package sbarena
+
+import (
+	"bytes"
+	"runtime/debug"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestGuardedArenaOverflowFaults(t *testing.T) {
+	a, err := NewGuardedArena(64)
+	sbtest.Nil(t, err)
+
+	off, err := AppendRecord(&a, bytes.Repeat([]byte{'a'}, 63))
+	sbtest.Nil(t, err)
+	rec, err := ReadRecord(&a, off)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 63, len(rec))
+
+	past := (*byte)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(rec)), len(rec)))
+	faultAddr := func() (addr uintptr) {
+		defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+		defer func() {
+			if r, ok := recover().(interface{ Addr() uintptr }); ok {
+				addr = r.Addr()
+			}
+		}()
+		*past = 'b'
+		return 0
+	}()
+	sbtest.Eq(t, uintptr(unsafe.Pointer(past)), faultAddr)
+}
+
+func TestGuardedArenaGrowAndClear(t *testing.T) {
+	a, err := NewGuardedArena(64)
+	sbtest.Nil(t, err)
+
+	offsets := [4]uint64{}
+	for i := range offsets {
+		offsets[i], err = AppendRecord(&a, bytes.Repeat([]byte{byte(i)}, 40))
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 4, NumBuckets(&a))
+	for i := range offsets {
+		rec, err := ReadRecord(&a, offsets[i])
+		sbtest.Nil(t, err)
+		sbtest.SlicesMatch(t, bytes.Repeat([]byte{byte(i)}, 40), rec)
+	}
+
+	Clear(&a)
+	sbtest.Eq(t, 0, len(a.allocator.(*guardAllocator).mappings))
+
+	off, err := AppendRecord(&a, []byte("one"))
+	sbtest.Nil(t, err)
+	rec, err := ReadRecord(&a, off)
+	sbtest.Nil(t, err)
+	sbtest.SlicesMatch(t, []byte("one"), rec)
+	sbtest.Eq(t, 1, len(a.allocator.(*guardAllocator).mappings))
+}
+
+func TestGuardedArenaAllocNonHeap(t *testing.T) {
+	a, err := NewGuardedArena(64)
+	sbtest.Nil(t, err)
+	p, err := Alloc[testStruct](&a)
+	sbtest.ContainsError(t, NonHeapMemoryErr, err)
+	sbtest.Nil(t, p.Value())
+}
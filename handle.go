@@ -0,0 +1,137 @@
+package sbarena
+
+import (
+	"errors"
+	"unsafe"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// A reference to a value of type T that was allocated with [AllocHandle].
+	// Unlike a pointer, a handle records the generation of the bucket it was
+	// allocated in. Once that bucket is reset, either by [Reset] or
+	// [ResetBuckets], or the arenas memory is released with [Clear], the
+	// handle can no longer be resolved. Handles into buckets that were not
+	// reset remain valid.
+	Handle[T any] struct {
+		bucket int
+		off    uintptr
+		gen    uint64
+	}
+)
+
+var (
+	StaleHandleErr = errors.New(
+		"The handle references memory that has been reset or released",
+	)
+)
+
+// Returns the generation stamp of the bucket at index `i`, stamping any
+// buckets up to and including `i` that do not have one yet. Every stamp is
+// unique for the lifetime of the arena, so a bucket that is reset and stamped
+// again never matches a stamp it was given previously. The caller must hold
+// the arenas lock.
+func bucketGen(a *Arena, i int) uint64 {
+	for len(a.gens) <= i {
+		a.lastGen++
+		a.gens = append(a.gens, a.lastGen)
+	}
+	return a.gens[i]
+}
+
+// Allocates enough space in the arena to hold a value of type T and returns a
+// [Handle] to it. The size of T must be less than the bucket size the
+// allocator was initialized with, otherwise a [ValueToLargeErr] will be
+// returned.
+//
+// Handles do not rely on weak pointers, so they can be used with arenas whose
+// memory does not live on the go heap.
+func AllocHandle[T any](a *Arena) (Handle[T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if size > maxAllocSize(a) {
+		return Handle[T]{}, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	defer unlock(a)
+	bucketIdx, off, err := reserve(a, size, unsafe.Alignof(tmp), kindOf[T]())
+	if err != nil {
+		return Handle[T]{}, err
+	}
+	a.allocs++
+	recordAlloc(a, size)
+	publishStats(a)
+	return Handle[T]{
+		bucket: bucketIdx,
+		off:    off,
+		gen:    bucketGen(a, bucketIdx),
+	}, nil
+}
+
+// Returns a pointer to the value the handle references. A [StaleHandleErr]
+// will be returned if the bucket the handle was allocated in has been reset or
+// released since the handle was created.
+func (h Handle[T]) Resolve(a *Arena) (*T, error) {
+	lock(a)
+	defer unlock(a)
+	if h.gen == 0 ||
+		h.bucket >= len(a.buckets) ||
+		bucketGen(a, h.bucket) != h.gen {
+		return nil, sberr.Wrap(
+			StaleHandleErr,
+			"Bucket: %d Generation: %d", h.bucket, h.gen,
+		)
+	}
+	base := unsafe.Pointer(unsafe.SliceData(a.buckets[h.bucket]))
+	return (*T)(unsafe.Add(base, h.off)), nil
+}
+
+// Resets all buckets starting at index `from`, leaving the buckets before it
+// untouched. Allocation continues at the start of bucket `from`, overwriting
+// the memory that the reset buckets previously held. All handles into the
+// reset buckets become stale while handles into earlier buckets stay valid.
+// This allows values with a long lifetime to be allocated first and values
+// with a short lifetime to be repeatedly allocated and discarded after them.
+//
+// If `from` is past the last bucket that is in use nothing is reset. A `from`
+// of 0 is equivalent to [Reset], and a negative `from` is treated as 0. Any
+// memory returned with [Free] is discarded.
+//
+// Otherwise the values in the buckets before `from` are still live, so unlike
+// [Reset] the number of allocations reported by [NumAllocations] is left as
+// is, and the dedicated buckets created by [AllocLarge] are kept.
+func ResetBuckets(a *Arena, from int) {
+	lock(a)
+	defer unlock(a)
+
+	if from <= 0 {
+		reset(a)
+		return
+	}
+	if from > frontier(a) || from >= len(a.buckets) {
+		return
+	}
+	updateHighWater(a)
+	a.reusedBuckets++
+	a.generation++
+	useKind(a, a.kinds[from])
+	setCurBucket(a, from)
+	a.free = nil
+	a.parked.free = nil
+	if a.parked.bucket >= from {
+		a.parked = lanePos{bucket: -1}
+	}
+	if from < len(a.gens) {
+		a.gens = a.gens[:from]
+	}
+	if from < len(a.payload) {
+		a.payload = a.payload[:from]
+	}
+	publishStats(a)
+}
@@ -0,0 +1,142 @@
+package sbarena
+
+import (
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestHandleResolve(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+	h, err := AllocHandle[testStruct](&a)
+	sbtest.Nil(t, err)
+	v, err := h.Resolve(&a)
+	sbtest.Nil(t, err)
+	*v = testStruct{A: 1, B: 2, C: "3"}
+
+	v2, err := h.Resolve(&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, testStruct{A: 1, B: 2, C: "3"}, *v2)
+
+	_, err = Handle[testStruct]{}.Resolve(&a)
+	sbtest.ContainsError(t, StaleHandleErr, err)
+}
+
+func TestHandleValueToLarge(t *testing.T) {
+	a := NewArena(1)
+	_, err := AllocHandle[testStruct](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestResetBucketsInvalidatesLaterHandles(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+	handles := make([]Handle[testStruct], 6)
+	for i := range handles {
+		h, err := AllocHandle[testStruct](&a)
+		sbtest.Nil(t, err)
+		v, err := h.Resolve(&a)
+		sbtest.Nil(t, err)
+		v.A = i
+		handles[i] = h
+	}
+	sbtest.Eq(t, 3, NumBuckets(&a))
+
+	ResetBuckets(&a, 1)
+	for i, h := range handles {
+		v, err := h.Resolve(&a)
+		if i < 2 {
+			sbtest.Nil(t, err)
+			sbtest.Eq(t, i, v.A)
+		} else {
+			sbtest.ContainsError(t, StaleHandleErr, err)
+		}
+	}
+
+	// New allocations reuse the reset buckets and are valid while the stale
+	// handles into the same buckets stay invalid.
+	h, err := AllocHandle[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 1, h.bucket)
+	_, err = h.Resolve(&a)
+	sbtest.Nil(t, err)
+	_, err = handles[2].Resolve(&a)
+	sbtest.ContainsError(t, StaleHandleErr, err)
+	sbtest.Eq(t, 3, NumBuckets(&a))
+}
+
+func TestResetBucketsPastCurrentBucket(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+	h, err := AllocHandle[testStruct](&a)
+	sbtest.Nil(t, err)
+
+	ResetBuckets(&a, 1)
+	_, err = h.Resolve(&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.Sizeof(testStruct{}), syncedBytesLeft(&a))
+}
+
+func TestResetBucketsFromZeroMatchesReset(t *testing.T) {
+	arenas := [2]Arena{
+		NewArena(unsafe.Sizeof(testStruct{}) * 2),
+		NewArena(unsafe.Sizeof(testStruct{}) * 2),
+	}
+	for i := range arenas {
+		for range 3 {
+			_, err := Alloc[testStruct](&arenas[i])
+			sbtest.Nil(t, err)
+		}
+		_, err := AllocLarge[[4096]byte](&arenas[i])
+		sbtest.Nil(t, err)
+	}
+	Reset(&arenas[0])
+	ResetBuckets(&arenas[1], 0)
+	for i := range arenas {
+		sbtest.Eq(t, uint64(0), NumAllocations(&arenas[i]))
+		sbtest.Eq(t, uintptr(0), UsedBytes(&arenas[i]))
+	}
+	sbtest.Eq(t, TotalMemBytes(&arenas[0]), TotalMemBytes(&arenas[1]))
+	sbtest.Eq(t, MetaSnapshot(&arenas[0]), MetaSnapshot(&arenas[1]))
+}
+
+func TestResetBucketsKeepsEarlierStats(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+	for range 3 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	_, err := AllocLarge[[4096]byte](&a)
+	sbtest.Nil(t, err)
+	total := TotalMemBytes(&a)
+
+	// The values before the reset bucket are still live, so they are still
+	// counted and the large value is kept.
+	ResetBuckets(&a, 1)
+	sbtest.Eq(t, uint64(4), NumAllocations(&a))
+	sbtest.Eq(t, total, TotalMemBytes(&a))
+}
+
+func TestResetAndClearInvalidateHandles(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+	h, err := AllocHandle[testStruct](&a)
+	sbtest.Nil(t, err)
+	Reset(&a)
+	_, err = h.Resolve(&a)
+	sbtest.ContainsError(t, StaleHandleErr, err)
+
+	h, err = AllocHandle[testStruct](&a)
+	sbtest.Nil(t, err)
+	Clear(&a)
+	_, err = h.Resolve(&a)
+	sbtest.ContainsError(t, StaleHandleErr, err)
+
+	// A handle into a bucket that was allocated after the clear must not
+	// match a handle from before it.
+	h2, err := AllocHandle[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, h.bucket, h2.bucket)
+	_, err = h.Resolve(&a)
+	sbtest.ContainsError(t, StaleHandleErr, err)
+	_, err = h2.Resolve(&a)
+	sbtest.Nil(t, err)
+}
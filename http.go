@@ -0,0 +1,91 @@
+package sbarena
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+)
+
+type (
+	// The view of an arena that is served by [Handler].
+	handlerView struct {
+		BucketSizeBytes uintptr
+		NumBuckets      int
+		PeakBuckets     int
+		CurBucket       int
+		BytesLeft       uintptr
+		TotalMemBytes   uintptr
+		ReuseRatio      float64
+		Buckets         []handlerBucket
+	}
+
+	// The layout of a single bucket as served by [Handler]. The unused tail of
+	// buckets before the current one is not tracked, so their used bytes are
+	// reported as their full size.
+	handlerBucket struct {
+		Index     int
+		SizeBytes uintptr
+		UsedBytes uintptr
+	}
+)
+
+var handlerTemplate = template.Must(template.New("arena").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Arena</title></head>
+<body>
+<h1>Arena</h1>
+<table>
+<tr><td>BucketSizeBytes</td><td>{{.BucketSizeBytes}}</td></tr>
+<tr><td>NumBuckets</td><td>{{.NumBuckets}}</td></tr>
+<tr><td>PeakBuckets</td><td>{{.PeakBuckets}}</td></tr>
+<tr><td>CurBucket</td><td>{{.CurBucket}}</td></tr>
+<tr><td>BytesLeft</td><td>{{.BytesLeft}}</td></tr>
+<tr><td>TotalMemBytes</td><td>{{.TotalMemBytes}}</td></tr>
+<tr><td>ReuseRatio</td><td>{{.ReuseRatio}}</td></tr>
+</table>
+<h2>Buckets</h2>
+<table>
+<tr><th>Index</th><th>SizeBytes</th><th>UsedBytes</th></tr>
+{{range .Buckets}}<tr><td>{{.Index}}</td><td>{{.SizeBytes}}</td><td>{{.UsedBytes}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// Returns an [http.Handler] that serves the current stats and bucket layout of
+// the arena, in the style of the `net/http/pprof` debug endpoints. It is
+// intended to be mounted under a path such as `/debug/arena`. The view is
+// served as JSON unless the `format=html` query parameter is supplied, in
+// which case it is served as an HTML page.
+func Handler(a *Arena) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		view := arenaView(a)
+		if r.URL.Query().Get("format") == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			handlerTemplate.Execute(w, view)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(view)
+	})
+}
+
+// Collects the view of the arena that is served by [Handler].
+func arenaView(a *Arena) handlerView {
+	rv := handlerView{ReuseRatio: ReuseRatio(a)}
+
+	lock(a)
+	defer unlock(a)
+	rv.BucketSizeBytes = initialBucketSize(a)
+	rv.NumBuckets = len(a.buckets)
+	rv.PeakBuckets = a.peakBuckets
+	rv.CurBucket = a.curBucket
+	rv.BytesLeft = a.bytesLeft
+	rv.TotalMemBytes = totalBytes(a)
+	rv.Buckets = make([]handlerBucket, len(a.buckets))
+	for i, b := range a.buckets {
+		rv.Buckets[i] = handlerBucket{Index: i, SizeBytes: uintptr(len(b))}
+		rv.Buckets[i].UsedBytes = bucketUsed(a, i)
+	}
+	return rv
+}
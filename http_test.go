@@ -0,0 +1,57 @@
+package sbarena
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestHandlerJSON(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	for range 3 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(&a).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/arena", nil))
+	sbtest.Eq(t, 200, rec.Code)
+	sbtest.Eq(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var view handlerView
+	sbtest.Nil(t, json.Unmarshal(rec.Body.Bytes(), &view))
+	sbtest.Eq(t, size*2, view.BucketSizeBytes)
+	sbtest.Eq(t, 2, view.NumBuckets)
+	sbtest.Eq(t, 2, view.PeakBuckets)
+	sbtest.Eq(t, 1, view.CurBucket)
+	sbtest.Eq(t, size, view.BytesLeft)
+	sbtest.Eq(t, size*4, view.TotalMemBytes)
+	sbtest.SlicesMatch(
+		t,
+		[]handlerBucket{
+			{Index: 0, SizeBytes: size * 2, UsedBytes: size * 2},
+			{Index: 1, SizeBytes: size * 2, UsedBytes: size},
+		},
+		view.Buckets,
+	)
+}
+
+func TestHandlerHTML(t *testing.T) {
+	a := NewArena(0)
+	rec := httptest.NewRecorder()
+	Handler(&a).ServeHTTP(
+		rec, httptest.NewRequest("GET", "/debug/arena?format=html", nil),
+	)
+	sbtest.Eq(t, 200, rec.Code)
+	body := rec.Body.String()
+	for _, field := range []string{
+		"BucketSizeBytes", "NumBuckets", "TotalMemBytes", "65536",
+	} {
+		sbtest.True(t, strings.Contains(body, field))
+	}
+}
@@ -0,0 +1,227 @@
+package sbarena
+
+import (
+	"reflect"
+	"sync"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// The kind of memory that backs a bucket. The garbage collector treats
+	// every pointer aligned word of memory that it scans as a pointer, so
+	// only values that hold pointers are placed in scanned buckets. Values
+	// without pointers, such as integers and byte buffers, are placed in
+	// buckets that are not scanned so that their contents are never mistaken
+	// for pointers. See [kindOf].
+	bucketKind uint8
+
+	// The position that allocations of one [bucketKind] are made from. Each
+	// kind fills its own bucket, and buckets are handed out to the kinds in
+	// order, so the buckets of the two kinds are interleaved. See [useKind].
+	lanePos struct {
+		// The index of the bucket the kind allocates from, or -1 if the kind
+		// has not been given a bucket since the arena was last rewound.
+		bucket    int
+		bytesLeft uintptr
+		free      *freeLists
+		cursor    *bumpCursor
+	}
+)
+
+const (
+	// Memory that is not scanned by the garbage collector.
+	plainKind bucketKind = iota
+	// Memory that is scanned by the garbage collector.
+	scanKind
+	numKinds
+)
+
+// The kinds of the struct and array types that were allocated, keyed by their
+// [reflect.Type].
+var typeKinds sync.Map
+
+// Returns the kind of bucket that values of type T are placed in, which is
+// [scanKind] if T holds any pointers and [plainKind] otherwise.
+func kindOf[T any]() bucketKind {
+	t := reflect.TypeFor[T]()
+	if k := t.Kind(); k != reflect.Struct && k != reflect.Array {
+		return typeKind(t)
+	}
+	if k, ok := typeKinds.Load(t); ok {
+		return k.(bucketKind)
+	}
+	k := typeKind(t)
+	typeKinds.Store(t, k)
+	return k
+}
+
+// Returns the kind of bucket that values of type `t` are placed in, see
+// [kindOf].
+func typeKind(t reflect.Type) bucketKind {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Complex64, reflect.Complex128:
+		return plainKind
+	case reflect.Array:
+		if t.Len() == 0 {
+			return plainKind
+		}
+		return typeKind(t.Elem())
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if typeKind(t.Field(i).Type) == scanKind {
+				return scanKind
+			}
+		}
+		return plainKind
+	}
+	return scanKind
+}
+
+// Returns true if the arena places values of different kinds in different
+// buckets. Arenas whose memory does not live on the go heap cannot be scanned
+// by the garbage collector at all, so they place every value in buckets of
+// [plainKind]. Fixed arenas only ever hold a single bucket, so they place every
+// value in a bucket of [scanKind].
+func hasKinds(a *Arena) bool {
+	return !a.fixed && checkOnHeap(a) == nil
+}
+
+// Makes `kind` the current kind, so that the following allocations are made
+// from its bucket. The position of the other kind is parked until it is used
+// again. Arenas that do not place values of different kinds in different
+// buckets, see [hasKinds], are left unchanged. The caller must hold the arenas
+// lock.
+func useKind(a *Arena, kind bucketKind) {
+	if kind != a.kind && hasKinds(a) {
+		swapLanes(a)
+	}
+}
+
+// Makes `kind` the current kind, see [useKind], and returns a function that
+// makes the kind that was current before current again. The caller must hold
+// the arenas lock until the returned function was called.
+func withKind(a *Arena, kind bucketKind) func() {
+	prev := a.kind
+	useKind(a, kind)
+	return func() { useKind(a, prev) }
+}
+
+// Exchanges the position of the current kind with the parked position of the
+// other kind. The caller must hold the arenas lock.
+func swapLanes(a *Arena) {
+	cur := lanePos{
+		bucket:    a.curBucket,
+		bytesLeft: a.bytesLeft,
+		free:      a.free,
+		cursor:    a.cursor,
+	}
+	a.curBucket = a.parked.bucket
+	a.bytesLeft = a.parked.bytesLeft
+	a.free = a.parked.free
+	a.cursor = a.parked.cursor
+	a.parked = cur
+	a.kind = numKinds - 1 - a.kind
+	a.bucketSize = bucketSizeAt(a, max(a.curBucket, 0))
+}
+
+// Returns the index of the last bucket that either kind has allocated from.
+// Every bucket before it has been handed out to one of the kinds, every
+// bucket after it is unused. The caller must hold the arenas lock.
+func frontier(a *Arena) int {
+	return max(a.curBucket, a.parked.bucket)
+}
+
+// Returns the number of bytes at the start of the bucket at index `i` that
+// were handed out. The buckets the two kinds are allocating from are used up
+// to their current positions, every other bucket before the [frontier] is
+// counted in full, including any space at its end that was too small for the
+// value that followed it. The caller must hold the arenas lock.
+func bucketUsed(a *Arena, i int) uintptr {
+	switch {
+	case i == a.curBucket:
+		return a.bucketSize - a.bytesLeft
+	case i == a.parked.bucket:
+		return bucketSizeAt(a, i) - a.parked.bytesLeft
+	case i < frontier(a):
+		return uintptr(len(a.buckets[i]))
+	}
+	return 0
+}
+
+// Returns the index of the bucket that the current kind moves to once it needs
+// more space, along with true if that bucket is taken over from the other kind.
+// Buckets are handed out in order, so this is normally the bucket after the
+// [frontier]. A kind that does not have a bucket yet instead takes over the
+// bucket of the other kind if nothing was allocated from it, so that an arena
+// that only ever holds values of one kind uses the same buckets as if there
+// were only one kind. The caller must hold the arenas lock.
+func nextBucket(a *Arena) (int, bool) {
+	if p := a.parked.bucket; a.curBucket < 0 && p >= 0 &&
+		a.parked.bytesLeft == bucketSizeAt(a, p) {
+		return p, true
+	}
+	return frontier(a) + 1, false
+}
+
+// Moves the current kind to the bucket at index `i`, as returned by
+// [nextBucket], allocating the bucket if the arena does not hold it yet and
+// giving it the memory of the current kind if it has the memory of the other
+// kind. The rest of the bucket that is moved away from is counted as wasted.
+// The caller must hold the arenas lock.
+func claimBucket(a *Arena, i int, takeOver bool) error {
+	if i == len(a.buckets) {
+		b, err := allocBucket(a, a.kind)
+		if err != nil {
+			return err
+		}
+		appendBucket(a, b, a.kind)
+	} else {
+		if a.kinds[i] != a.kind {
+			if err := retypeBucket(a, i); err != nil {
+				return err
+			}
+		}
+		if !takeOver {
+			a.reusedBuckets++
+		}
+	}
+	if takeOver {
+		a.parked = lanePos{bucket: -1, free: a.parked.free}
+	}
+	a.wastedBytes += a.bytesLeft
+	setCurBucket(a, i)
+	return nil
+}
+
+// Gives the unused bucket at index `i` the memory of the current kind. A later
+// bucket of the same size that already has the right memory and is not in use
+// either is moved into its place if there is one, so that the buckets are
+// reused rather than reallocated when values of the two kinds are allocated
+// in a different order after the arena was rewound. Otherwise the memory of the
+// bucket is replaced. The caller must hold the arenas lock.
+func retypeBucket(a *Arena, i int) error {
+	for j := i + 1; j < len(a.buckets); j++ {
+		if a.kinds[j] == a.kind && len(a.buckets[j]) == len(a.buckets[i]) {
+			a.buckets[i], a.buckets[j] = a.buckets[j], a.buckets[i]
+			a.kinds[i], a.kinds[j] = a.kinds[j], a.kinds[i]
+			return nil
+		}
+	}
+	size := uintptr(len(a.buckets[i]))
+	b := newAllocatorBucket(a.allocator, size, a.kind)
+	if b == nil {
+		return sberr.Wrap(BucketAllocationErr, "Bucket size: %d", size)
+	}
+	if a.allocator != nil {
+		a.allocator.free(a.buckets[i], a.kinds[i])
+	}
+	a.buckets[i] = b
+	a.kinds[i] = a.kind
+	return nil
+}
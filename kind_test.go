@@ -0,0 +1,132 @@
+package sbarena
+
+import (
+	"encoding/binary"
+	"runtime"
+	"strings"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestKindOf(t *testing.T) {
+	sbtest.Eq(t, plainKind, kindOf[int]())
+	sbtest.Eq(t, plainKind, kindOf[[4]float64]())
+	sbtest.Eq(t, plainKind, kindOf[struct{}]())
+	sbtest.Eq(t, plainKind, kindOf[[0]*int]())
+	sbtest.Eq(t, plainKind, kindOf[struct {
+		A int
+		B [2]uint8
+	}]())
+	sbtest.Eq(t, scanKind, kindOf[*int]())
+	sbtest.Eq(t, scanKind, kindOf[string]())
+	sbtest.Eq(t, scanKind, kindOf[[]int]())
+	sbtest.Eq(t, scanKind, kindOf[unsafe.Pointer]())
+	sbtest.Eq(t, scanKind, kindOf[testStruct]())
+	sbtest.Eq(t, scanKind, kindOf[[2]testStruct2]())
+}
+
+// Returns the address of a large slice that is garbage once this returns.
+//
+//go:noinline
+func freedAddr() uintptr {
+	b := make([]byte, 1<<20)
+	b[0] = 1
+	return uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+}
+
+func TestPointerShapedBytesNotScanned(t *testing.T) {
+	a := NewArena(0)
+	raw, err := AllocBytes(&a, 1024)
+	sbtest.Nil(t, err)
+	ints, err := AllocSlice[uintptr](&a, 128)
+	sbtest.Nil(t, err)
+
+	// The slice is freed before its address is written, so the GC would find
+	// bad pointers if it scanned the memory.
+	addr := freedAddr()
+	runtime.GC()
+	for i := 0; i < len(raw); i += 8 {
+		binary.LittleEndian.PutUint64(raw[i:], uint64(addr)+uint64(i))
+		(*ints.Value())[i/8] = addr + uintptr(i)
+	}
+	for range 3 {
+		runtime.GC()
+	}
+	runtime.KeepAlive(&a)
+}
+
+func TestPointersKeptAliveAcrossKinds(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 4)
+	vals := make([]*testStruct, 8)
+	for i := range vals {
+		_, err := AllocBytes(&a, 7)
+		sbtest.Nil(t, err)
+		vals[i], err = New[testStruct](&a)
+		sbtest.Nil(t, err)
+		vals[i].C = strings.Repeat("x", i+1)
+	}
+	lock(&a)
+	for i, b := range a.buckets {
+		p := uintptr(unsafe.Pointer(vals[0]))
+		base := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+		if p >= base && p < base+uintptr(len(b)) {
+			sbtest.Eq(t, scanKind, a.kinds[i])
+		}
+	}
+	unlock(&a)
+
+	runtime.GC()
+	for i, v := range vals {
+		sbtest.Eq(t, strings.Repeat("x", i+1), v.C)
+	}
+}
+
+func TestKindsReuseBuckets(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	for range 2 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		_, err = Alloc[uint64](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(t, uintptr(0), WastedBytes(&a))
+
+	// Allocating the kinds in the other order swaps the buckets rather than
+	// allocating new ones.
+	Reset(&a)
+	m := MetaSnapshot(&a)
+	for range 2 {
+		_, err := Alloc[uint64](&a)
+		sbtest.Nil(t, err)
+		_, err = Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.False(t, GrewSince(&a, m))
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(t, plainKind, a.kinds[0])
+	sbtest.Eq(t, scanKind, a.kinds[1])
+	sbtest.Eq(t, size*2+16, UsedBytes(&a))
+}
+
+func TestKindsMarkRestore(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 2)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	_, err = Alloc[uint64](&a)
+	sbtest.Nil(t, err)
+	used := UsedBytes(&a)
+
+	m := Mark(&a)
+	for range 5 {
+		_, err = Alloc[uint64](&a)
+		sbtest.Nil(t, err)
+		_, err = Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	Restore(&a, m)
+	sbtest.Eq(t, used, UsedBytes(&a))
+}
@@ -0,0 +1,108 @@
+package sbarena
+
+import (
+	"slices"
+	"unsafe"
+	"weak"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+// Allocates enough space in the arena to hold a value of type T, the same as
+// [Alloc], except that T may be larger than the bucket size. A value that does
+// not fit in a bucket is placed in a dedicated bucket that is sized to exactly
+// hold it, so the bucket size does not have to be chosen to fit the largest
+// value that is ever allocated.
+//
+// Dedicated buckets count towards [TotalMemBytes] and [UsedBytes], but are not
+// counted by [NumBuckets] and are never used for any other value. They are
+// released by [Reset] and [Clear], after which the values they hold must not
+// be used.
+//
+// A fixed size arena, see [NewFixedArena], never allocates a dedicated bucket
+// and will return an [OutOfSpaceErr] instead.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocLarge[T any](a *Arena) (weak.Pointer[T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if size <= maxAllocSize(a) {
+		return Alloc[T](a)
+	}
+
+	lock(a)
+	defer unlock(a)
+	if err := checkOnHeap(a); err != nil {
+		return weak.Make[T](nil), err
+	}
+	if a.fixed {
+		return weak.Make[T](nil), sberr.Wrap(
+			OutOfSpaceErr, "Requested size: %d", size,
+		)
+	}
+	if err := checkMaxBytes(a, size); err != nil {
+		return weak.Make[T](nil), err
+	}
+	kind := kindOf[T]()
+	b := newBucket(size, kind)
+	a.large = append(a.large, b)
+	a.largeKinds = append(a.largeKinds, kind)
+	a.largeBytes += size
+	a.allocs++
+	recordAlloc(a, size)
+	publishStats(a)
+	return weak.Make((*T)(unsafe.Pointer(unsafe.SliceData(b)))), nil
+}
+
+// Releases the dedicated bucket that holds the value referenced by `p` so that
+// it can be garbage collected, shrinking [TotalMemBytes] by the size of that
+// bucket. This allows a one-off value that was too large for a regular bucket,
+// see [AllocLarge], to be dropped without resetting the whole arena. All other
+// values in the arena are left untouched.
+//
+// An [InvalidFreeErr] will be returned if `p` does not reference a value that
+// was placed in a dedicated bucket, including values that [AllocLarge] placed
+// in a regular bucket. Use [Free] for those values instead. Nil pointers are
+// ignored.
+//
+// The value referenced by `p` must not be used once this function returns.
+func FreeOversized[T any](a *Arena, p weak.Pointer[T]) error {
+	ptr := unsafe.Pointer(p.Value())
+	if ptr == nil {
+		return nil
+	}
+
+	lock(a)
+	defer unlock(a)
+	i := slices.IndexFunc(a.large, func(b bucket) bool {
+		return unsafe.Pointer(unsafe.SliceData(b)) == ptr
+	})
+	if i < 0 {
+		return sberr.Wrap(
+			InvalidFreeErr,
+			"Address: %p is not in a dedicated bucket", ptr,
+		)
+	}
+	updateHighWater(a)
+	a.largeBytes -= uintptr(len(a.large[i]))
+	a.large = slices.Delete(a.large, i, i+1)
+	a.largeKinds = slices.Delete(a.largeKinds, i, i+1)
+	publishStats(a)
+	return nil
+}
+
+// Returns the number of bytes held by the arena across all buckets, including
+// dedicated buckets created by [AllocLarge]. The caller must hold the arenas
+// lock.
+func totalBytes(a *Arena) uintptr {
+	return bucketsBytes(a, len(a.buckets)) + a.largeBytes
+}
+
+// Drops the dedicated buckets created by [AllocLarge] so that they can be
+// garbage collected. The caller must hold the arenas lock.
+func releaseLarge(a *Arena) {
+	a.large = nil
+	a.largeKinds = nil
+	a.largeBytes = 0
+}
@@ -0,0 +1,83 @@
+package sbarena
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+	"weak"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocLarge(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size)
+
+	_, err := Alloc[testStruct2](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+
+	p, err := AllocLarge[testStruct2](&a)
+	sbtest.Nil(t, err)
+	*p.Value() = testStruct2{testStruct: testStruct{A: 1, C: "one"}, D: 2}
+	sbtest.Eq(
+		t, testStruct2{testStruct: testStruct{A: 1, C: "one"}, D: 2}, *p.Value(),
+	)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, size+unsafe.Sizeof(testStruct2{}), TotalMemBytes(&a))
+	sbtest.Eq(t, unsafe.Sizeof(testStruct2{}), UsedBytes(&a))
+
+	// Values that fit in a bucket are allocated as usual.
+	small, err := AllocLarge[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(
+		t, uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[0]))),
+		uintptr(unsafe.Pointer(small.Value())),
+	)
+	sbtest.Eq(t, TotalMemBytes(&a), UsedBytes(&a)+FreeBytes(&a))
+
+	Clear(&a)
+	runtime.GC()
+	sbtest.Nil(t, p.Value())
+	sbtest.Eq(t, uintptr(0), TotalMemBytes(&a))
+}
+
+func TestAllocLargeFixedArena(t *testing.T) {
+	a := NewFixedArena(unsafe.Sizeof(testStruct{}))
+	_, err := AllocLarge[testStruct2](&a)
+	sbtest.ContainsError(t, OutOfSpaceErr, err)
+}
+
+func TestFreeOversized(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size)
+	small, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	*small.Value() = testStruct{A: 1, C: "small"}
+
+	var big weak.Pointer[testStruct2]
+	func() {
+		big, err = AllocLarge[testStruct2](&a)
+		sbtest.Nil(t, err)
+		big.Value().D = 2
+	}()
+	other, err := AllocLarge[testStruct2](&a)
+	sbtest.Nil(t, err)
+	other.Value().D = 3
+	total := TotalMemBytes(&a)
+	sbtest.Eq(t, size+unsafe.Sizeof(testStruct2{})*2, total)
+
+	sbtest.Nil(t, FreeOversized(&a, big))
+	runtime.GC()
+	sbtest.Nil(t, big.Value())
+	sbtest.Eq(t, total-unsafe.Sizeof(testStruct2{}), TotalMemBytes(&a))
+	sbtest.Eq(t, size+unsafe.Sizeof(testStruct2{}), UsedBytes(&a))
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, testStruct{A: 1, C: "small"}, *small.Value())
+	sbtest.Eq(t, 3, other.Value().D)
+
+	// Values in regular buckets can not be freed this way.
+	sbtest.ContainsError(t, InvalidFreeErr, FreeOversized(&a, small))
+	sbtest.Nil(t, FreeOversized(&a, weak.Make[testStruct](nil)))
+	sbtest.Eq(t, testStruct{A: 1, C: "small"}, *small.Value())
+}
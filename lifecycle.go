@@ -0,0 +1,77 @@
+package sbarena
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+type (
+	// A heap allocated object that is only referenced by the arena that owns
+	// it, so it becomes unreachable at the same time as the arena does.
+	// It contains a pointer so that it is never tiny allocated, which would
+	// delay its cleanup.
+	sentinel struct {
+		_ unsafe.Pointer
+	}
+
+	// Tracks the hooks that run when an arena is garbage collected. These
+	// belong to the arena itself rather than its contents, so they are not
+	// exchanged by [Swap].
+	arenaLifecycle struct {
+		sentinel     *sentinel
+		finalizer    runtime.Cleanup
+		hasFinalizer bool
+	}
+)
+
+// Registers `fn` to be run once the arena has become unreachable and has been
+// garbage collected, which is the point at which all of the memory the arena
+// owns is released. This makes it possible to release any external resources
+// associated with the arena. Any previously registered function is replaced
+// and passing a nil function removes the current one.
+//
+// As with [runtime.AddCleanup], `fn` runs on a separate goroutine and must not
+// reference the arena, otherwise the arena will never become unreachable and
+// `fn` will never run. There is no guarantee that `fn` will run before the
+// program exits.
+func SetFinalizer(a *Arena, fn func()) {
+	lock(a)
+	defer unlock(a)
+
+	if a.lifecycle.sentinel == nil {
+		a.lifecycle.sentinel = &sentinel{}
+	}
+	if a.lifecycle.hasFinalizer {
+		a.lifecycle.finalizer.Stop()
+		a.lifecycle.hasFinalizer = false
+	}
+	if fn == nil {
+		return
+	}
+	a.lifecycle.finalizer = runtime.AddCleanup(
+		a.lifecycle.sentinel, func(f func()) { f() }, fn,
+	)
+	a.lifecycle.hasFinalizer = true
+}
+
+// Registers `fn` to be run once the arena has become unreachable and has been
+// garbage collected, the same as [SetFinalizer]. Unlike [SetFinalizer] every
+// function that is registered with OnFree runs, in no particular order, and
+// registering a function does not replace the one set with [SetFinalizer].
+// Functions registered with OnFree cannot be removed. A nil `fn` is ignored.
+//
+// The same restrictions as for [SetFinalizer] apply: `fn` runs on a separate
+// goroutine, must not reference the arena and is not guaranteed to run before
+// the program exits.
+func OnFree(a *Arena, fn func()) {
+	if fn == nil {
+		return
+	}
+	lock(a)
+	defer unlock(a)
+
+	if a.lifecycle.sentinel == nil {
+		a.lifecycle.sentinel = &sentinel{}
+	}
+	runtime.AddCleanup(a.lifecycle.sentinel, func(f func()) { f() }, fn)
+}
@@ -0,0 +1,74 @@
+package sbarena
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+// Runs the garbage collector until `c` receives a value or the timeout
+// expires. Returns true if a value was received.
+func gcUntil(c <-chan struct{}, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		runtime.GC()
+		select {
+		case <-c:
+			return true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return false
+}
+
+func TestSetFinalizer(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	func() {
+		a := NewArena(0)
+		SetFinalizer(&a, func() { ran <- struct{}{} })
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}()
+	sbtest.True(t, gcUntil(ran, time.Second))
+}
+
+func TestSetFinalizerReplaced(t *testing.T) {
+	first := make(chan struct{}, 1)
+	second := make(chan struct{}, 1)
+	func() {
+		a := NewArena(0)
+		SetFinalizer(&a, func() { first <- struct{}{} })
+		SetFinalizer(&a, func() { second <- struct{}{} })
+	}()
+	sbtest.True(t, gcUntil(second, time.Second))
+	sbtest.Eq(t, 0, len(first))
+}
+
+func TestSetFinalizerRemoved(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	func() {
+		a := NewArena(0)
+		SetFinalizer(&a, func() { ran <- struct{}{} })
+		SetFinalizer(&a, nil)
+	}()
+	sbtest.False(t, gcUntil(ran, 100*time.Millisecond))
+}
+
+func TestOnFree(t *testing.T) {
+	ran := make(chan struct{}, 3)
+	func() {
+		a := NewArena(0)
+		SetFinalizer(&a, func() { ran <- struct{}{} })
+		OnFree(&a, func() { ran <- struct{}{} })
+		OnFree(&a, func() { ran <- struct{}{} })
+		OnFree(&a, nil)
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}()
+	for range 3 {
+		sbtest.True(t, gcUntil(ran, time.Second))
+	}
+	sbtest.Eq(t, 0, len(ran))
+}
@@ -0,0 +1,313 @@
+package sbarena
+
+import (
+	"cmp"
+	"slices"
+	"unsafe"
+	"weak"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// A position in an arena that the arena can later be rolled back to,
+	// releasing everything that was allocated after it. See [Mark].
+	Marker struct {
+		bucket    int
+		bytesLeft uintptr
+		payload   uintptr
+		// The kind that was current and the position of the other kind.
+		kind          bucketKind
+		parked        int
+		parkedLeft    uintptr
+		parkedPayload uintptr
+	}
+)
+
+// Returns a [Marker] for the arenas current position. Passing the marker to
+// [Restore] rolls the arena back to this position, reclaiming everything that
+// was allocated after it in one step without touching earlier allocations. This
+// allows batches of temporary values to be allocated and released in a stack
+// like fashion.
+func Mark(a *Arena) Marker {
+	lock(a)
+	defer unlock(a)
+	return mark(a)
+}
+
+// Rolls the arena back to the position captured by `m`, see [Mark]. Later
+// allocations overwrite the memory that was allocated after the marker was
+// created, so any pointers to that memory must no longer be used. Free memory
+// that lies after the marker is discarded and handles into any bucket after
+// the one the marker is in become stale. Buckets past the marker are kept and
+// reused rather than freed.
+//
+// Markers must be restored in the reverse of the order they were created in.
+// Restoring a marker after the arena was rewound past it, for example by
+// [Reset] or an earlier call to Restore, is undefined. Markers from before the
+// arena was cleared are ignored.
+func Restore(a *Arena, m Marker) {
+	lock(a)
+	defer unlock(a)
+	restore(a, m)
+	publishStats(a)
+}
+
+// Returns a marker for the arenas current position. The caller must hold the
+// arenas lock.
+func mark(a *Arena) Marker {
+	m := Marker{
+		bucket:     a.curBucket,
+		bytesLeft:  a.bytesLeft,
+		kind:       a.kind,
+		parked:     a.parked.bucket,
+		parkedLeft: a.parked.bytesLeft,
+	}
+	if m.bucket >= 0 && m.bucket < len(a.payload) {
+		m.payload = a.payload[m.bucket]
+	}
+	if m.parked >= 0 && m.parked < len(a.payload) {
+		m.parkedPayload = a.payload[m.parked]
+	}
+	return m
+}
+
+// Rolls the arena back to the position described by `m`, so that the memory
+// allocated after the marker was created is reused by later allocations. Free
+// memory that lies after the marker is discarded and handles into any bucket
+// after the one the marker is in become stale. Markers from before the arena
+// was cleared are ignored. The caller must hold the arenas lock.
+func restore(a *Arena, m Marker) {
+	f := max(m.bucket, m.parked)
+	if f >= len(a.buckets) {
+		return
+	}
+	updateHighWater(a)
+	if a.kind != m.kind {
+		swapLanes(a)
+	}
+	restoreLane(a, f, m.bucket, m.bytesLeft)
+	swapLanes(a)
+	restoreLane(a, f, m.parked, m.parkedLeft)
+	swapLanes(a)
+	if f+1 < len(a.gens) {
+		a.gens = a.gens[:f+1]
+	}
+	if f < len(a.payload) {
+		a.payload = a.payload[:f+1]
+	}
+	if m.bucket >= 0 && m.bucket < len(a.payload) {
+		a.payload[m.bucket] = m.payload
+	}
+	if m.parked >= 0 && m.parked < len(a.payload) {
+		a.payload[m.parked] = m.parkedPayload
+	}
+}
+
+// Moves the current kind back to `bytesLeft` bytes before the end of the bucket
+// at index `i`, as recorded by a marker whose last used bucket was `f`, and
+// discards the free memory of the kind that lies after that position. The
+// bucket may have been taken over by the other kind since the marker was
+// created if nothing was allocated from it, in which case the current kind is
+// left without a bucket. The caller must hold the arenas lock.
+func restoreLane(a *Arena, f int, i int, bytesLeft uintptr) {
+	if i < 0 || a.kinds[i] != a.kind {
+		a.curBucket = -1
+		a.bytesLeft = 0
+		discardFreeAfter(a, f, ^uintptr(0))
+		return
+	}
+	setCurBucket(a, i)
+	a.bytesLeft = bytesLeft
+	discardFreeAfter(
+		a, i,
+		uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[i])))+
+			a.bucketSize-bytesLeft,
+	)
+}
+
+// Allocates enough space in the arena to hold a value of type T and returns a
+// function that rolls the arena back to where it was just before the
+// allocation, releasing the value and everything that was allocated after it.
+// This allows `defer close()` style cleanup of allocations that are made in
+// strictly nested scopes. Calling the returned functions in any order other
+// than the reverse of the order the allocations were made in, or after the
+// arena was reset, is undefined.
+//
+// The size of T must be less than the bucket size the allocator was
+// initialized with, otherwise a [ValueToLargeErr] will be returned. The value
+// is always taken from the current bucket, memory returned with [Free] is never
+// reused.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocScoped[T any](a *Arena) (weak.Pointer[T], func(), error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if size > maxAllocSize(a) {
+		return weak.Make[T](nil), func() {}, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	if err := checkOnHeap(a); err != nil {
+		unlock(a)
+		return weak.Make[T](nil), func() {}, err
+	}
+	m := mark(a)
+	bucketIdx, off, err := reserve(a, size, unsafe.Alignof(tmp), kindOf[T]())
+	if err != nil {
+		unlock(a)
+		return weak.Make[T](nil), func() {}, err
+	}
+	ptr := unsafe.Pointer(&a.buckets[bucketIdx][off])
+	a.allocs++
+	recordAlloc(a, size)
+	publishStats(a)
+	unlock(a)
+
+	return weak.Make((*T)(ptr)), func() {
+		lock(a)
+		restore(a, m)
+		publishStats(a)
+		unlock(a)
+	}, nil
+}
+
+// Runs `fn` and then rolls the arena back to where it was before `fn` was
+// called, releasing everything `fn` allocated from the arena. The arena is
+// rolled back even if `fn` panics, after which the panic continues. This is a
+// convenient way to make temporary allocations, see [Mark] and [Restore] for
+// the rules that apply. In particular no pointers to values allocated by `fn`
+// may be used after WithScope returns.
+func WithScope(a *Arena, fn func()) {
+	m := Mark(a)
+	defer Restore(a, m)
+	fn()
+}
+
+// Moves the allocations referenced by `keep` to the front of the arenas
+// buckets, in the order they appear in the arena, and rewinds the arena to just
+// after the last of them. Everything else that was allocated is reclaimed the
+// same as with [Reset], including the holes between the kept allocations. The
+// arena cannot know which of its allocations are still live, so the caller
+// supplies them along with their sizes in `sizes`, which must have the same
+// length as `keep`, otherwise a [MismatchedLengthsErr] is returned. This turns
+// the arena into a compacting allocator for batch workloads where only a few
+// values outlive each batch.
+//
+// The returned slice holds the new location of each kept allocation, in the
+// same order as `keep`. The old pointers, and any other pointers into the
+// arena, must no longer be used. Nil pointers and zero sized allocations are
+// returned as is. Every kept allocation must lie in memory the arena already
+// handed out and must not overlap another kept allocation, otherwise an
+// [InvalidFreeErr] is returned and the arena is left unchanged.
+//
+// Moved allocations keep their alignment up to the size of a pointer, which
+// covers the alignment of all types allocated with [Alloc]. Larger alignments,
+// such as those requested with [AllocAligned], are not preserved. Values in
+// dedicated buckets created by [AllocLarge] cannot be kept and are released,
+// and all handles become stale.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func Compact(
+	a *Arena,
+	keep []weak.Pointer[byte],
+	sizes []uintptr,
+) ([]weak.Pointer[byte], error) {
+	if len(keep) != len(sizes) {
+		return nil, sberr.Wrap(
+			MismatchedLengthsErr,
+			"Pointers: %d Sizes: %d", len(keep), len(sizes),
+		)
+	}
+	type kept struct {
+		idx    int
+		bucket int
+		off    uintptr
+		size   uintptr
+		align  uintptr
+		kind   bucketKind
+		// A copy of the value that is made before the arena is rewound.
+		saved bucket
+	}
+
+	lock(a)
+	defer unlock(a)
+	if err := checkOnHeap(a); err != nil {
+		return nil, err
+	}
+	rv := make([]weak.Pointer[byte], len(keep))
+	vals := make([]kept, 0, len(keep))
+	for i, p := range keep {
+		ptr := unsafe.Pointer(p.Value())
+		if ptr == nil || sizes[i] == 0 {
+			rv[i] = p
+			continue
+		}
+		bucketIdx, off, ok := findAllocated(a, ptr, sizes[i])
+		if !ok {
+			return nil, sberr.Wrap(
+				InvalidFreeErr, "Address: %p Size: %d", ptr, sizes[i],
+			)
+		}
+		vals = append(vals, kept{
+			idx:    i,
+			bucket: bucketIdx,
+			off:    off,
+			size:   sizes[i],
+			kind:   a.kinds[bucketIdx],
+		})
+	}
+	slices.SortFunc(vals, func(l kept, r kept) int {
+		return cmp.Or(cmp.Compare(l.bucket, r.bucket), cmp.Compare(l.off, r.off))
+	})
+	for i := 1; i < len(vals); i++ {
+		prev := vals[i-1]
+		if vals[i].bucket == prev.bucket && vals[i].off < prev.off+prev.size {
+			return nil, sberr.Wrap(
+				InvalidFreeErr,
+				"Address: %p overlaps another kept allocation",
+				unsafe.Pointer(&a.buckets[vals[i].bucket][vals[i].off]),
+			)
+		}
+	}
+
+	// The values are copied out first, as the buckets they are moved to may
+	// be given new memory when the kinds of the buckets are rearranged.
+	for i := range vals {
+		v := &vals[i]
+		src := a.buckets[v.bucket][v.off : v.off+v.size]
+		addr := uintptr(unsafe.Pointer(unsafe.SliceData(src)))
+		v.align = min(addr&-addr, unsafe.Sizeof(unsafe.Pointer(nil)))
+		v.saved = makeBucket(v.size, copyKind(v.kind, v.align))
+		copyBucket(copyKind(v.kind, v.align), v.saved, src)
+	}
+	reset(a)
+	for _, v := range vals {
+		bucketIdx, off, err := reserve(a, v.size, v.align, v.kind)
+		if err != nil {
+			return nil, err
+		}
+		dst := a.buckets[bucketIdx][off : off+v.size]
+		copyBucket(copyKind(v.kind, v.align), dst, v.saved)
+		rv[v.idx] = weak.Make((*byte)(unsafe.Pointer(unsafe.SliceData(dst))))
+	}
+	a.allocs = uint64(len(vals))
+	publishStats(a)
+	return rv, nil
+}
+
+// Returns the kind to copy a value that lives in a bucket of `kind` as, given
+// the alignment of its address. Values that are not pointer aligned cannot hold
+// pointers, so they are always copied as plain memory.
+func copyKind(kind bucketKind, align uintptr) bucketKind {
+	if align < unsafe.Sizeof(unsafe.Pointer(nil)) {
+		return plainKind
+	}
+	return kind
+}
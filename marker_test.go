@@ -0,0 +1,202 @@
+package sbarena
+
+import (
+	"strconv"
+	"testing"
+	"unsafe"
+	"weak"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocScopedNested(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+
+	outer, closeOuter, err := AllocScoped[testStruct](&a)
+	sbtest.Nil(t, err)
+	middle, closeMiddle, err := AllocScoped[testStruct](&a)
+	sbtest.Nil(t, err)
+	inner, closeInner, err := AllocScoped[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(t, 1, a.curBucket)
+
+	// The first bucket was full when the inner value was allocated, so the
+	// rollback leaves the arena at the end of the first bucket.
+	closeInner()
+	sbtest.Eq(t, 0, a.curBucket)
+	sbtest.Eq(t, uintptr(0), syncedBytesLeft(&a))
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, inner.Value(), p.Value())
+
+	closeMiddle()
+	sbtest.Eq(t, 0, a.curBucket)
+	sbtest.Eq(t, size, syncedBytesLeft(&a))
+	p, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, middle.Value(), p.Value())
+
+	closeOuter()
+	sbtest.Eq(t, 0, a.curBucket)
+	sbtest.Eq(t, size*2, syncedBytesLeft(&a))
+	p, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, outer.Value(), p.Value())
+	sbtest.Eq(t, 2, NumBuckets(&a))
+}
+
+func TestAllocScopedDiscardsFreedMemory(t *testing.T) {
+	a := NewArena(0)
+	_, closer, err := AllocScoped[testStruct](&a)
+	sbtest.Nil(t, err)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Nil(t, Free(&a, p))
+	closer()
+
+	p2, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	p3, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Neq[*testStruct](t, p2.Value(), p3.Value())
+}
+
+func TestAllocScopedAfterClear(t *testing.T) {
+	a := NewArena(0)
+	_, closer, err := AllocScoped[testStruct](&a)
+	sbtest.Nil(t, err)
+	Clear(&a)
+	closer()
+	sbtest.Eq(t, 0, NumBuckets(&a))
+	sbtest.Eq(t, 0, a.curBucket)
+}
+
+func TestAllocScopedValueToLarge(t *testing.T) {
+	a := NewArena(1)
+	_, closer, err := AllocScoped[testStruct](&a)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	closer()
+}
+
+func TestMarkRestore(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 16)
+	before, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	before.Value().A = -1
+
+	m := Mark(&a)
+	first, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	for i := range 99 {
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		p.Value().A = i
+	}
+	sbtest.Eq(t, 7, NumBuckets(&a))
+	sbtest.Eq(t, 6, a.curBucket)
+
+	Restore(&a, m)
+	sbtest.Eq(t, 0, a.curBucket)
+	sbtest.Eq(t, size*15, syncedBytesLeft(&a))
+	sbtest.Eq(t, 7, NumBuckets(&a))
+	sbtest.Eq(t, size, UsedBytes(&a))
+
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, first.Value(), p.Value())
+	sbtest.Eq(t, -1, before.Value().A)
+}
+
+func TestWithScope(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+
+	WithScope(&a, func() {
+		for range 3 {
+			_, err := Alloc[testStruct](&a)
+			sbtest.Nil(t, err)
+		}
+		bucket, off := CurrentOffset(&a)
+		sbtest.Eq(t, 1, bucket)
+		sbtest.Eq(t, size*2, off)
+	})
+	bucket, off := CurrentOffset(&a)
+	sbtest.Eq(t, 0, bucket)
+	sbtest.Eq(t, size, off)
+	sbtest.Eq(t, size, UsedBytes(&a))
+
+	r := recoverPanic(func() {
+		WithScope(&a, func() {
+			_, err := Alloc[testStruct](&a)
+			sbtest.Nil(t, err)
+			_, off := CurrentOffset(&a)
+			sbtest.Eq(t, size*2, off)
+			panic("scope")
+		})
+	})
+	sbtest.Eq[any](t, "scope", r)
+	bucket, off = CurrentOffset(&a)
+	sbtest.Eq(t, 0, bucket)
+	sbtest.Eq(t, size, off)
+	sbtest.Eq(t, size, UsedBytes(&a))
+}
+
+func TestCompact(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 4)
+	vals := make([]weak.Pointer[testStruct], 10)
+	for i := range vals {
+		var err error
+		vals[i], err = Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		*vals[i].Value() = testStruct{A: i, C: strconv.Itoa(i)}
+	}
+	bucket, off := CurrentOffset(&a)
+	sbtest.Eq(t, 2, bucket)
+	sbtest.Eq(t, size*2, off)
+
+	keep := []weak.Pointer[byte]{}
+	sizes := []uintptr{}
+	for i := 0; i < len(vals); i += 2 {
+		keep = append(keep, weak.Make((*byte)(unsafe.Pointer(vals[i].Value()))))
+		sizes = append(sizes, size)
+	}
+	moved, err := Compact(&a, keep, sizes)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, len(keep), len(moved))
+
+	for i, p := range moved {
+		v := (*testStruct)(unsafe.Pointer(p.Value()))
+		sbtest.Eq(t, testStruct{A: i * 2, C: strconv.Itoa(i * 2)}, *v)
+		sbtest.Eq(
+			t, uintptr(unsafe.Pointer(vals[i].Value())), uintptr(unsafe.Pointer(v)),
+		)
+	}
+	bucket, off = CurrentOffset(&a)
+	sbtest.Eq(t, 1, bucket)
+	sbtest.Eq(t, size, off)
+	sbtest.Eq(t, size*5, UsedBytes(&a))
+	sbtest.Eq(t, 3, NumBuckets(&a))
+	sbtest.Eq(t, uint64(5), NumAllocations(&a))
+
+	// The reclaimed memory is reused by the following allocations.
+	next, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(
+		t, uintptr(unsafe.Pointer(vals[5].Value())),
+		uintptr(unsafe.Pointer(next.Value())),
+	)
+
+	_, err = Compact(&a, keep, sizes[1:])
+	sbtest.ContainsError(t, MismatchedLengthsErr, err)
+	_, err = Compact(&a, []weak.Pointer[byte]{moved[0], moved[0]}, sizes[:2])
+	sbtest.ContainsError(t, InvalidFreeErr, err)
+	_, err = Compact(&a, []weak.Pointer[byte]{keep[4]}, sizes[:1])
+	sbtest.ContainsError(t, InvalidFreeErr, err)
+	sbtest.Eq(t, size*6, UsedBytes(&a))
+}
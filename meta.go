@@ -0,0 +1,95 @@
+package sbarena
+
+import (
+	"expvar"
+	"fmt"
+)
+
+type (
+	// A snapshot of the metadata that describes the position and size of an
+	// arena, without any of the arenas memory. See [MetaSnapshot].
+	Meta struct {
+		NumBuckets int
+		CurBucket  int
+		BytesLeft  uintptr
+		// The number of times the arena had been reset or cleared when the
+		// snapshot was taken.
+		Generation uint64
+
+		freshBuckets uint64
+	}
+
+	// A snapshot of the arenas memory usage for logging and metrics. See
+	// [Snapshot].
+	Stats struct {
+		NumBuckets int
+		BucketSize uintptr
+		TotalBytes uintptr
+		UsedBytes  uintptr
+		FreeBytes  uintptr
+		CurBucket  int
+	}
+)
+
+// Returns a snapshot of the arenas metadata. Taking a snapshot does not copy
+// any of the arenas memory, so it is cheap enough to take around any operation
+// to find out how it affected the arena, for example with [GrewSince].
+func MetaSnapshot(a *Arena) Meta {
+	lock(a)
+	defer unlock(a)
+	return Meta{
+		NumBuckets:   len(a.buckets),
+		CurBucket:    a.curBucket,
+		BytesLeft:    a.bytesLeft,
+		Generation:   a.generation,
+		freshBuckets: a.freshBuckets,
+	}
+}
+
+// Returns true if the arena has allocated any new buckets since the snapshot
+// `m` was taken with [MetaSnapshot]. Reusing buckets that the arena already
+// held, such as after a call to [Reset], does not count as growing.
+func GrewSince(a *Arena, m Meta) bool {
+	return a.stats.freshBuckets.Load() > m.freshBuckets
+}
+
+// Returns a snapshot of the arenas memory usage. The snapshot is taken while
+// holding the arenas lock, so unlike calling [NumBuckets], [TotalMemBytes],
+// [UsedBytes] and [FreeBytes] separately all of its fields describe the arena
+// at the same point in time, even when the arena is being used concurrently.
+// In particular UsedBytes and FreeBytes always add up to TotalBytes.
+func Snapshot(a *Arena) Stats {
+	lock(a)
+	defer unlock(a)
+	total, used := totalBytes(a), usedBytes(a)
+	return Stats{
+		NumBuckets: len(a.buckets),
+		BucketSize: initialBucketSize(a),
+		TotalBytes: total,
+		UsedBytes:  used,
+		FreeBytes:  total - used,
+		CurBucket:  a.curBucket,
+	}
+}
+
+// Returns a short human readable description of the arenas memory usage, such
+// as `Arena{buckets:3, bucketSize:65536, used:131000, free:65608}`, which is
+// intended for logging. The description is built from a [Snapshot], so all of
+// the values in it describe the arena at the same point in time.
+func Describe(a *Arena) string {
+	s := Snapshot(a)
+	return fmt.Sprintf(
+		"Arena{buckets:%d, bucketSize:%d, used:%d, free:%d}",
+		s.NumBuckets, s.BucketSize, s.UsedBytes, s.FreeBytes,
+	)
+}
+
+// Publishes the arenas [Stats] as an [expvar.Func] under `name`, so that the
+// arenas memory usage is served as JSON by the `/debug/vars` endpoint along
+// with the other exported variables. Each read of the variable takes a new
+// [Snapshot]. Several arenas can be published as long as each uses a distinct
+// name, publishing a name that is already in use panics, the same as
+// [expvar.Publish].
+func PublishExpvar(name string, a *Arena) {
+	expvar.Publish(name, expvar.Func(func() any { return Snapshot(a) }))
+}
@@ -0,0 +1,169 @@
+package sbarena
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestMetaSnapshot(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+
+	m := MetaSnapshot(&a)
+	sbtest.Eq(t, Meta{
+		NumBuckets:   1,
+		CurBucket:    0,
+		BytesLeft:    size,
+		Generation:   0,
+		freshBuckets: 1,
+	}, m)
+
+	Reset(&a)
+	ResetBuckets(&a, 0)
+	Clear(&a)
+	sbtest.Eq(t, uint64(3), MetaSnapshot(&a).Generation)
+}
+
+func TestGrewSince(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+
+	m := MetaSnapshot(&a)
+	for range 2 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.False(t, GrewSince(&a, m))
+	_, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.True(t, GrewSince(&a, m))
+
+	// Reusing the existing buckets is not growth.
+	Reset(&a)
+	m = MetaSnapshot(&a)
+	for range 4 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.False(t, GrewSince(&a, m))
+
+	// Allocating a fresh bucket after clearing is.
+	Clear(&a)
+	m = MetaSnapshot(&a)
+	_, err = Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.True(t, GrewSince(&a, m))
+}
+
+func TestSnapshot(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	for range 5 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, Stats{
+		NumBuckets: 3,
+		BucketSize: size * 2,
+		TotalBytes: size * 6,
+		UsedBytes:  size * 5,
+		FreeBytes:  size,
+		CurBucket:  2,
+	}, Snapshot(&a))
+
+	Reset(&a)
+	sbtest.Eq(t, Stats{
+		NumBuckets: 3,
+		BucketSize: size * 2,
+		TotalBytes: size * 6,
+		UsedBytes:  0,
+		FreeBytes:  size * 6,
+		CurBucket:  0,
+	}, Snapshot(&a))
+}
+
+func TestSnapshotConcurrent(t *testing.T) {
+	a := NewArena(unsafe.Sizeof(testStruct{}) * 4)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				_, err := Alloc[testStruct](&a)
+				sbtest.Nil(t, err)
+			}
+		}()
+	}
+	for range 200 {
+		s := Snapshot(&a)
+		sbtest.Eq(t, s.TotalBytes, s.UsedBytes+s.FreeBytes)
+		sbtest.Eq(t, s.TotalBytes, uintptr(s.NumBuckets)*s.BucketSize)
+		sbtest.True(t, s.CurBucket < s.NumBuckets)
+	}
+	wg.Wait()
+	sbtest.Eq(t, 400, Snapshot(&a).NumBuckets)
+}
+
+func TestDescribe(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	sbtest.Eq(
+		t,
+		fmt.Sprintf("Arena{buckets:1, bucketSize:%d, used:0, free:%d}", 2*size, 2*size),
+		Describe(&a),
+	)
+	for range 5 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(
+		t,
+		fmt.Sprintf(
+			"Arena{buckets:3, bucketSize:%d, used:%d, free:%d}",
+			2*size, 5*size, size,
+		),
+		Describe(&a),
+	)
+
+	Clear(&a)
+	sbtest.Eq(
+		t,
+		fmt.Sprintf("Arena{buckets:0, bucketSize:%d, used:0, free:0}", 2*size),
+		Describe(&a),
+	)
+}
+
+// Expvars can not be unpublished, so each run of the test needs new names.
+var expvarRuns atomic.Int64
+
+func TestPublishExpvar(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	b := NewArena(0)
+	run := expvarRuns.Add(1)
+	nameA := fmt.Sprintf("sbarena_test_a_%d", run)
+	nameB := fmt.Sprintf("sbarena_test_b_%d", run)
+	PublishExpvar(nameA, &a)
+	PublishExpvar(nameB, &b)
+	for range 3 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+
+	for name, arena := range map[string]*Arena{nameA: &a, nameB: &b} {
+		var got Stats
+		sbtest.Nil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &got))
+		sbtest.Eq(t, Snapshot(arena), got)
+	}
+	sbtest.Panics(t, func() { PublishExpvar(nameA, &b) })
+}
@@ -0,0 +1,153 @@
+package sbarena
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// Allocates buckets outside of the go heap whose pages are interleaved
+	// across all online NUMA nodes.
+	interleaveAllocator struct {
+		mappings guardMappings
+		// The nodes to interleave pages across, as the bitmask expected by
+		// mbind.
+		nodemask []uint
+	}
+)
+
+const (
+	mpolInterleave = 3
+	uintBits       = int(unsafe.Sizeof(uint(0)) * 8)
+)
+
+// Creates a new [Arena] whose buckets are allocated outside of the go heap with
+// mmap and have their pages interleaved across all online NUMA nodes using
+// mbind with MPOL_INTERLEAVE. On machines with multiple NUMA nodes this spreads
+// each bucket over the memory of every node, so scans over the arena that are
+// run in parallel from different nodes get balanced memory bandwidth rather
+// than all competing for the memory of a single node.
+//
+// This is only available on linux. Arenas created with [NewArena] use the go
+// heap, which places memory according to the default policy of the process.
+//
+// Because the memory does not live on the go heap the garbage collector does
+// not scan it and weak pointers cannot reference it, so functions such as
+// [Alloc] that return weak pointers will return a [NonHeapMemoryErr]. Values
+// stored in the arena must not hold the only reference to any go heap memory.
+//
+// The memory is unmapped when [Clear] is called or once the arena is garbage
+// collected.
+func NewInterleavedArena(bucketSizeBytes uintptr) (rv Arena, err error) {
+	if bucketSizeBytes <= 0 {
+		bucketSizeBytes = DefaultBlockSize
+	}
+
+	nodemask, err := onlineNodemask()
+	if err != nil {
+		return
+	}
+	g := &interleaveAllocator{mappings: guardMappings{}, nodemask: nodemask}
+	runtime.AddCleanup(g, guardMappings.unmapAll, g.mappings)
+
+	b := g.alloc(bucketSizeBytes, plainKind)
+	if b == nil {
+		err = sberr.Wrap(
+			BucketAllocationErr, "Bucket size: %d", bucketSizeBytes,
+		)
+		return
+	}
+	rv.arenaState = arenaState{
+		curBucket:    0,
+		bytesLeft:    bucketSizeBytes,
+		bucketSize:   bucketSizeBytes,
+		allocator:    g,
+		freshBuckets: 1,
+		parked:       lanePos{bucket: -1},
+	}
+	appendBucket(&rv, b, plainKind)
+	publishStats(&rv)
+	return
+}
+
+// Returns the bitmask of the NUMA nodes that are online. Machines without
+// NUMA support are treated as having a single node.
+func onlineNodemask() ([]uint, error) {
+	data, err := os.ReadFile("/sys/devices/system/node/online")
+	if os.IsNotExist(err) {
+		return []uint{1}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rv []uint
+	for _, r := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		lo, hi, found := strings.Cut(r, "-")
+		if !found {
+			hi = lo
+		}
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, err
+		}
+		last, err := strconv.Atoi(hi)
+		if err != nil {
+			return nil, err
+		}
+		for node := first; node <= last; node++ {
+			for len(rv) <= node/uintBits {
+				rv = append(rv, 0)
+			}
+			rv[node/uintBits] |= 1 << (node % uintBits)
+		}
+	}
+	return rv, nil
+}
+
+func (g *interleaveAllocator) alloc(size uintptr, kind bucketKind) bucket {
+	dataLen := alignUp(size, uintptr(os.Getpagesize()))
+	m, err := syscall.Mmap(
+		-1, 0, int(dataLen),
+		syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE,
+	)
+	if err != nil {
+		return nil
+	}
+	// The pages are not faulted in yet, so the policy applies to all of them.
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_MBIND,
+		uintptr(unsafe.Pointer(unsafe.SliceData(m))), uintptr(dataLen),
+		mpolInterleave,
+		uintptr(unsafe.Pointer(unsafe.SliceData(g.nodemask))),
+		// The kernel expects one more than the number of bits in the mask.
+		uintptr(len(g.nodemask)*uintBits+1),
+		0,
+	)
+	if errno != 0 {
+		syscall.Munmap(m)
+		return nil
+	}
+
+	b := bucket(m[:size:size])
+	g.mappings[uintptr(unsafe.Pointer(unsafe.SliceData(b)))] = m
+	return b
+}
+
+func (g *interleaveAllocator) free(b bucket, kind bucketKind) {
+	key := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+	if m, ok := g.mappings[key]; ok {
+		syscall.Munmap(m)
+		delete(g.mappings, key)
+	}
+}
+
+func (g *interleaveAllocator) onHeap() bool {
+	return false
+}
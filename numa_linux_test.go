@@ -0,0 +1,111 @@
+package sbarena
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+// Skips the test if the kernel, or the container the tests run in, does not
+// allow setting a memory policy with mbind.
+func skipWithoutMbind(t testing.TB) {
+	nodemask, err := onlineNodemask()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := syscall.Mmap(
+		-1, 0, os.Getpagesize(),
+		syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Munmap(m)
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_MBIND,
+		uintptr(unsafe.Pointer(unsafe.SliceData(m))), uintptr(len(m)),
+		mpolInterleave,
+		uintptr(unsafe.Pointer(unsafe.SliceData(nodemask))),
+		uintptr(len(nodemask)*uintBits+1),
+		0,
+	)
+	if errors.Is(errno, syscall.ENOSYS) || errors.Is(errno, syscall.EPERM) {
+		t.Skipf("mbind is not supported: %v", errno)
+	}
+}
+
+func TestInterleavedArena(t *testing.T) {
+	skipWithoutMbind(t)
+	a, err := NewInterleavedArena(unsafe.Sizeof(testStruct{}) * 4)
+	sbtest.Nil(t, err)
+
+	for i := range 10 {
+		var p *testStruct
+		sbtest.Nil(t, AllocInto(&a, &p))
+		*p = testStruct{A: i, B: float64(i)}
+	}
+	sbtest.Eq(t, 3, NumBuckets(&a))
+	sbtest.Eq(t, 3, len(a.allocator.(*interleaveAllocator).mappings))
+
+	_, err = Alloc[testStruct](&a)
+	sbtest.ContainsError(t, NonHeapMemoryErr, err)
+
+	Clear(&a)
+	sbtest.Eq(t, 0, NumBuckets(&a))
+	sbtest.Eq(t, 0, len(a.allocator.(*interleaveAllocator).mappings))
+
+	var p *testStruct
+	sbtest.Nil(t, AllocInto(&a, &p))
+	sbtest.Eq(t, 1, NumBuckets(&a))
+}
+
+func TestOnlineNodemask(t *testing.T) {
+	mask, err := onlineNodemask()
+	sbtest.Nil(t, err)
+	sbtest.True(t, len(mask) > 0)
+	sbtest.True(t, mask[0] != 0)
+}
+
+// Sums the first word of every cache line in the arena from several
+// goroutines at once. On machines with multiple NUMA nodes the interleaved
+// arena spreads the memory traffic across all nodes.
+func benchmarkScan(b *testing.B, a *Arena) {
+	for range 64 {
+		var p *[1 << 20]byte
+		if err := AllocInto(a, &p); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(TotalMemBytes(a)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var sum byte
+		for pb.Next() {
+			for _, bucket := range a.buckets {
+				for i := 0; i < len(bucket); i += 64 {
+					sum += bucket[i]
+				}
+			}
+		}
+		_ = sum
+	})
+}
+
+func BenchmarkScanHeap(b *testing.B) {
+	a := NewArena(1 << 20)
+	benchmarkScan(b, &a)
+}
+
+func BenchmarkScanInterleaved(b *testing.B) {
+	skipWithoutMbind(b)
+	a, err := NewInterleavedArena(1 << 20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkScan(b, &a)
+}
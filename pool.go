@@ -0,0 +1,120 @@
+package sbarena
+
+import (
+	"slices"
+	"unsafe"
+	"weak"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// A pool of values of type T that are allocated from an [Arena]. Values
+	// that are returned to the pool with [Pool.Put] are handed out again by
+	// [Pool.Get] before any new memory is allocated from the arena, so a pool
+	// with a steady state number of live values stops consuming arena memory
+	// once it has reached that number.
+	//
+	// The memory of the values in the pool is returned to the arena with
+	// [Free], so the arena discards it when it is rewound, the same as any
+	// other free memory, and the values are then dropped from the pool rather
+	// than handed out a second time.
+	//
+	// A Pool is not safe for concurrent use.
+	Pool[T any] struct {
+		arena *Arena
+		free  []weak.Pointer[T]
+	}
+)
+
+// Creates a new [Pool] that allocates its values from the supplied arena.
+func NewPool[T any](a *Arena) *Pool[T] {
+	return &Pool[T]{arena: a}
+}
+
+// Returns a zeroed value from the pool. Values that were returned with
+// [Pool.Put] are reused first, a new value is only allocated from the arena if
+// there are none. Any error returned by [Alloc] is returned.
+func (p *Pool[T]) Get() (weak.Pointer[T], error) {
+	v, ok := p.reuse()
+	if !ok {
+		var err error
+		if v, err = Alloc[T](p.arena); err != nil {
+			return v, err
+		}
+	}
+	// Memory that is reused after the arena was reset still holds the old
+	// values, so freshly allocated values must be zeroed as well.
+	if ptr := v.Value(); ptr != nil {
+		var zero T
+		*ptr = zero
+	}
+	return v, nil
+}
+
+// Removes values from the pool until one is found whose memory is still free
+// in the arena, and takes that memory back from the arenas free lists. Values
+// whose memory was collected, discarded by the arena being rewound, or handed
+// out to another allocation are dropped.
+func (p *Pool[T]) reuse() (weak.Pointer[T], bool) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+
+	lock(p.arena)
+	defer unlock(p.arena)
+	for len(p.free) > 0 {
+		v := p.free[len(p.free)-1]
+		p.free = p.free[:len(p.free)-1]
+		ptr := unsafe.Pointer(v.Value())
+		if ptr != nil && (size == 0 || takeFree(p.arena, ptr, size)) {
+			publishStats(p.arena)
+			return v, true
+		}
+	}
+	return weak.Make[T](nil), false
+}
+
+// Returns a value to the pool so that it is handed out again by a later call
+// to [Pool.Get]. The value must not be used after it is returned. Values that
+// [Free] does not accept, such as values from another arena, are dropped.
+func (p *Pool[T]) Put(v weak.Pointer[T]) {
+	if v.Value() == nil || Free(p.arena, v) != nil {
+		return
+	}
+	p.free = append(p.free, v)
+}
+
+// Returns the number of values that are currently in the pool waiting to be
+// reused. Values whose memory is no longer free in the arena are counted until
+// [Pool.Get] drops them.
+func (p *Pool[T]) Len() int {
+	return len(p.free)
+}
+
+// Allocates `n` values from the pools arena and places them directly in the
+// pool, so that the first `n` calls to [Pool.Get] do not have to allocate. This
+// moves the cost of allocating to startup for applications with a known steady
+// state number of values. If an allocation fails the values that were already
+// allocated are kept in the pool and the error is returned.
+func Warm[T any](pool *Pool[T], n int) error {
+	if n < 0 {
+		return sberr.Wrap(InvalidLengthErr, "Length: %d", n)
+	}
+	// The values are only put in the pool once they are all allocated, as
+	// otherwise each allocation would reuse the memory of the value before it.
+	vals := make([]weak.Pointer[T], 0, n)
+	defer func() {
+		pool.free = slices.Grow(pool.free, len(vals))
+		for _, v := range vals {
+			pool.Put(v)
+		}
+	}()
+	for range n {
+		v, err := Alloc[T](pool.arena)
+		if err != nil {
+			return err
+		}
+		vals = append(vals, v)
+	}
+	return nil
+}
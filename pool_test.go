@@ -0,0 +1,136 @@
+package sbarena
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestPoolGetPut(t *testing.T) {
+	a := NewArena(0)
+	p := NewPool[testStruct](&a)
+
+	v, err := p.Get()
+	sbtest.Nil(t, err)
+	*v.Value() = testStruct{A: 1, B: 2, C: "3"}
+	p.Put(v)
+	sbtest.Eq(t, 1, p.Len())
+
+	v2, err := p.Get()
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, v.Value(), v2.Value())
+	sbtest.Eq(t, testStruct{}, *v2.Value())
+	sbtest.Eq(t, 0, p.Len())
+}
+
+func TestPoolGetZeroesReusedArenaMemory(t *testing.T) {
+	a := NewArena(0)
+	p, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	*p.Value() = testStruct{A: 42, C: "stale"}
+	Reset(&a)
+
+	pool := NewPool[testStruct](&a)
+	v, err := pool.Get()
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, p.Value(), v.Value())
+	sbtest.Eq(t, testStruct{}, *v.Value())
+}
+
+func TestPoolDropsCollectedValues(t *testing.T) {
+	a := NewArena(0)
+	p := NewPool[testStruct](&a)
+	sbtest.Nil(t, Warm(p, 3))
+
+	Clear(&a)
+	runtime.GC()
+	v, err := p.Get()
+	sbtest.Nil(t, err)
+	sbtest.NotNil(t, v.Value())
+	sbtest.Eq(t, 0, p.Len())
+}
+
+func TestPoolDropsValuesReusedAfterReset(t *testing.T) {
+	a := NewArena(0)
+	p := NewPool[testStruct](&a)
+	v, err := p.Get()
+	sbtest.Nil(t, err)
+	p.Put(v)
+
+	Reset(&a)
+	other, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, v.Value(), other.Value())
+	other.Value().C = "live"
+
+	v2, err := p.Get()
+	sbtest.Nil(t, err)
+	sbtest.Neq[*testStruct](t, other.Value(), v2.Value())
+	sbtest.Eq(t, "live", other.Value().C)
+	sbtest.Eq(t, 0, p.Len())
+}
+
+func TestPoolDropsValuesReusedAfterRestore(t *testing.T) {
+	a := NewArena(0)
+	p := NewPool[testStruct](&a)
+	m := Mark(&a)
+	sbtest.Nil(t, Warm(p, 2))
+
+	Restore(&a, m)
+	other, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	for range 2 {
+		v, err := p.Get()
+		sbtest.Nil(t, err)
+		sbtest.Neq[*testStruct](t, other.Value(), v.Value())
+	}
+}
+
+func TestPoolDropsValuesTakenByAlloc(t *testing.T) {
+	a := NewArena(0)
+	p := NewPool[testStruct](&a)
+	v, err := p.Get()
+	sbtest.Nil(t, err)
+	p.Put(v)
+
+	// The freed memory is reused by the next allocation of the same size.
+	other, err := Alloc[testStruct](&a)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, v.Value(), other.Value())
+	v2, err := p.Get()
+	sbtest.Nil(t, err)
+	sbtest.Neq[*testStruct](t, other.Value(), v2.Value())
+}
+
+func TestWarm(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size * 2)
+	p := NewPool[testStruct](&a)
+
+	sbtest.Nil(t, Warm(p, 4))
+	sbtest.Eq(t, 4, p.Len())
+	numBuckets := NumBuckets(&a)
+	bytesLeft := syncedBytesLeft(&a)
+
+	for range 4 {
+		v, err := p.Get()
+		sbtest.Nil(t, err)
+		sbtest.NotNil(t, v.Value())
+	}
+	sbtest.Eq(t, numBuckets, NumBuckets(&a))
+	sbtest.Eq(t, bytesLeft, syncedBytesLeft(&a))
+
+	_, err := p.Get()
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, numBuckets+1, NumBuckets(&a))
+}
+
+func TestWarmErrors(t *testing.T) {
+	a := NewArena(1)
+	p := NewPool[testStruct](&a)
+	sbtest.ContainsError(t, InvalidLengthErr, Warm(p, -1))
+	sbtest.ContainsError(t, ValueToLargeErr, Warm(p, 1))
+	sbtest.Eq(t, 0, p.Len())
+}
@@ -0,0 +1,98 @@
+package sbarena
+
+import "unsafe"
+
+type (
+	// A run of `n` consecutive allocations of the same size that start at
+	// `base`.
+	allocSpan struct {
+		base unsafe.Pointer
+		n    uintptr
+	}
+)
+
+// Returns the runs of allocations of `elemSize` bytes in each bucket that is
+// in use, in allocation order. Earlier buckets are assumed to have been filled
+// until the next value no longer fit. `elemSize` must not be 0.
+func allocSpans(a *Arena, elemSize uintptr) []allocSpan {
+	lock(a)
+	defer unlock(a)
+
+	rv := make([]allocSpan, 0, min(frontier(a)+1, len(a.buckets)))
+	for i := 0; i < len(a.buckets) && i <= frontier(a); i++ {
+		rv = append(rv, allocSpan{
+			base: unsafe.Pointer(unsafe.SliceData(a.buckets[i])),
+			n:    bucketUsed(a, i) / elemSize,
+		})
+	}
+	return rv
+}
+
+// Calls `fn` with a pointer to each allocation in the arena, starting with the
+// most recent allocation and ending with the first one. Iteration stops early
+// if `fn` returns false. This mirrors the order values should be torn down in
+// when later values may depend on earlier ones.
+//
+// The arena does not record where individual allocations start, so the
+// allocations are assumed to all be `elemSize` bytes large with no padding
+// between them, as is the case when only a single type is allocated. The
+// results are undefined if the arena holds values of other sizes. Nothing is
+// visited if `elemSize` is 0.
+//
+// The arenas lock is not held while `fn` is called, so `fn` may use the arena.
+// Allocations made by `fn` are not visited.
+func RangeReverse(
+	a *Arena,
+	elemSize uintptr,
+	fn func(ptr unsafe.Pointer) bool,
+) {
+	if elemSize == 0 {
+		return
+	}
+	spans := allocSpans(a, elemSize)
+	for i := len(spans) - 1; i >= 0; i-- {
+		for j := spans[i].n; j > 0; j-- {
+			if !fn(unsafe.Add(spans[i].base, (j-1)*elemSize)) {
+				return
+			}
+		}
+	}
+}
+
+// Partitions the allocations in the arena into `n` disjoint chunks so that
+// they can be processed by `n` workers in parallel. Every allocation is in
+// exactly one chunk, the chunks are in allocation order and their lengths
+// differ by at most one. Chunks are empty if there are fewer than `n`
+// allocations. Nil is returned if `n` is <=0.
+//
+// The same assumptions as [RangeReverse] apply, all allocations are assumed
+// to be `elemSize` bytes large with no padding between them. No chunks are
+// returned if `elemSize` is 0.
+func Chunks(a *Arena, elemSize uintptr, n int) [][]unsafe.Pointer {
+	if n <= 0 || elemSize == 0 {
+		return nil
+	}
+	spans := allocSpans(a, elemSize)
+	var total int
+	for _, s := range spans {
+		total += int(s.n)
+	}
+
+	rv := make([][]unsafe.Pointer, n)
+	ptrs := make([]unsafe.Pointer, 0, total)
+	for _, s := range spans {
+		for j := range s.n {
+			ptrs = append(ptrs, unsafe.Add(s.base, j*elemSize))
+		}
+	}
+	start := 0
+	for i := range rv {
+		end := start + total/n
+		if i < total%n {
+			end++
+		}
+		rv[i] = ptrs[start:end:end]
+		start = end
+	}
+	return rv
+}
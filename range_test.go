@@ -0,0 +1,76 @@
+package sbarena
+
+import (
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestRangeReverse(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size*3 + size/2)
+	for i := range 10 {
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		p.Value().A = i
+	}
+	sbtest.Eq(t, 4, NumBuckets(&a))
+
+	visited := []int{}
+	RangeReverse(&a, size, func(ptr unsafe.Pointer) bool {
+		visited = append(visited, (*testStruct)(ptr).A)
+		return true
+	})
+	sbtest.SlicesMatch(t, []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}, visited)
+
+	visited = visited[:0]
+	RangeReverse(&a, size, func(ptr unsafe.Pointer) bool {
+		visited = append(visited, (*testStruct)(ptr).A)
+		return len(visited) < 3
+	})
+	sbtest.SlicesMatch(t, []int{9, 8, 7}, visited)
+}
+
+func TestRangeReverseEmpty(t *testing.T) {
+	a := NewArena(0)
+	RangeReverse(&a, unsafe.Sizeof(testStruct{}), func(unsafe.Pointer) bool {
+		t.Fatal("No allocations should be visited")
+		return true
+	})
+	Clear(&a)
+	RangeReverse(&a, unsafe.Sizeof(testStruct{}), func(unsafe.Pointer) bool {
+		t.Fatal("No allocations should be visited")
+		return true
+	})
+	RangeReverse(&a, 0, func(unsafe.Pointer) bool {
+		t.Fatal("No allocations should be visited")
+		return true
+	})
+}
+
+func TestChunks(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	a := NewArena(size*3 + size/2)
+	for i := range 10 {
+		p, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+		p.Value().A = i
+	}
+
+	for _, n := range []int{1, 3, 4, 10, 12} {
+		chunks := Chunks(&a, size, n)
+		sbtest.Eq(t, n, len(chunks))
+		seen := []int{}
+		for _, c := range chunks {
+			sbtest.True(t, len(c) == 10/n || len(c) == 10/n+1)
+			for _, ptr := range c {
+				seen = append(seen, (*testStruct)(ptr).A)
+			}
+		}
+		sbtest.SlicesMatch(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, seen)
+	}
+
+	sbtest.Eq(t, 0, len(Chunks(&a, size, 0)))
+	sbtest.Eq(t, 0, len(Chunks(&a, 0, 4)))
+}
@@ -0,0 +1,59 @@
+package sbarena
+
+import (
+	"io"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+// Reads exactly `n` bytes from `r` directly into a contiguous region in a
+// single bucket of the arena and returns the filled slice, which has a capacity
+// of `n`. No intermediate buffer is used and the arenas lock is not held while
+// reading, so a slow reader does not block other allocations.
+//
+// Any error from reading is returned as is, including [io.ErrUnexpectedEOF] if
+// `r` ended before `n` bytes were read. The reserved region is given back to
+// the arena when reading fails, unless other values were allocated from the
+// arena in the meantime in which case the region is left unused.
+//
+// `n` must not be larger than the bucket size, otherwise a [ValueToLargeErr]
+// will be returned. A negative `n` will return an [InvalidLengthErr].
+func AllocFromReader(a *Arena, r io.Reader, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, sberr.Wrap(InvalidLengthErr, "Length: %d", n)
+	}
+	if uintptr(n) > maxAllocSize(a) {
+		return nil, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			n, maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	start := mark(a)
+	bucketIdx, off, err := reserve(a, uintptr(n), 1, plainKind)
+	if err != nil {
+		unlock(a)
+		return nil, err
+	}
+	end := mark(a)
+	gen := a.generation
+	rv := a.buckets[bucketIdx][off : off+uintptr(n) : off+uintptr(n)]
+	recordAlloc(a, uintptr(n))
+	publishStats(a)
+	unlock(a)
+
+	if _, err := io.ReadFull(r, rv); err != nil {
+		lock(a)
+		// Rolling back is only safe while the reserved region is still the
+		// last thing that was allocated.
+		if a.generation == gen && mark(a) == end {
+			restore(a, start)
+			publishStats(a)
+		}
+		unlock(a)
+		return nil, err
+	}
+	return rv, nil
+}
@@ -0,0 +1,54 @@
+package sbarena
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocFromReader(t *testing.T) {
+	a := NewArena(64)
+	r := strings.NewReader("hello world, this is arena memory")
+
+	one, err := AllocFromReader(&a, r, 11)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, "hello world", string(one))
+	sbtest.Eq(t, 11, cap(one))
+	two, err := AllocFromReader(&a, r, 22)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, ", this is arena memory", string(two))
+	sbtest.Eq(t, "hello world", string(one))
+	sbtest.Eq(t, uintptr(33), UsedBytes(&a))
+
+	_, err = AllocFromReader(&a, r, 65)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	_, err = AllocFromReader(&a, r, -1)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+}
+
+func TestAllocFromReaderShortRead(t *testing.T) {
+	a := NewArena(64)
+	_, err := Alloc[int64](&a)
+	sbtest.Nil(t, err)
+	used := UsedBytes(&a)
+
+	_, err = AllocFromReader(&a, strings.NewReader("short"), 16)
+	sbtest.ContainsError(t, io.ErrUnexpectedEOF, err)
+	sbtest.Eq(t, used, UsedBytes(&a))
+	_, err = AllocFromReader(&a, strings.NewReader(""), 16)
+	sbtest.ContainsError(t, io.EOF, err)
+	sbtest.Eq(t, used, UsedBytes(&a))
+
+	// Does not fit in the rest of the first bucket, so the failed read moved
+	// to a new bucket which must be rolled back as well.
+	_, err = AllocFromReader(&a, strings.NewReader("short"), 60)
+	sbtest.ContainsError(t, io.ErrUnexpectedEOF, err)
+	sbtest.Eq(t, used, UsedBytes(&a))
+
+	b, err := AllocFromReader(&a, strings.NewReader("full"), 4)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, "full", string(b))
+	sbtest.Eq(t, used+4, UsedBytes(&a))
+}
@@ -0,0 +1,29 @@
+package sbarena
+
+import "errors"
+
+var (
+	ReadOnlyAllocationErr = errors.New(
+		"The read only memory for an immutable string could not be allocated",
+	)
+)
+
+// Copies `s` into memory owned by the arena and returns a string that
+// references the copy. On linux and darwin the copy is placed in memory that is
+// marked read only with mprotect, so any attempt to mutate the string through
+// unsafe casts faults immediately instead of silently corrupting it. On other
+// platforms the copy is placed in the arenas buckets without any protection.
+//
+// On linux and darwin the read only memory lives outside of the arenas buckets
+// and outside of the go heap. Strings are packed together into pages, so every
+// arena that uses this function will consume at least one page of memory for
+// them. The memory is released when [Clear] is called or once the arena is
+// garbage collected, after which the returned strings must not be used.
+func AllocStringImmutable(a *Arena, s string) (string, error) {
+	if len(s) == 0 {
+		return "", nil
+	}
+	lock(a)
+	defer unlock(a)
+	return copyReadOnly(a, s)
+}
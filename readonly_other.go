@@ -0,0 +1,27 @@
+//go:build !linux && !darwin
+
+package sbarena
+
+import sberr "github.com/barbell-math/smoothbrain-errs"
+
+type (
+	// Read only memory is not supported on this platform.
+	readOnlyRegions struct{}
+)
+
+// Copies `s` into the arenas buckets. The caller must hold the arenas lock.
+func copyReadOnly(a *Arena, s string) (string, error) {
+	size := uintptr(len(s))
+	if size > a.bucketSize {
+		return "", sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, a.bucketSize,
+		)
+	}
+	return copyString(a, s)
+}
+
+// Read only memory is not supported on this platform, so there is nothing to
+// release.
+func releaseReadOnly(a *Arena) {}
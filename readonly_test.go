@@ -0,0 +1,31 @@
+package sbarena
+
+import (
+	"strings"
+	"testing"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocStringImmutable(t *testing.T) {
+	a := NewArena(0)
+	strs := []string{"one", "two", strings.Repeat("three", 2000), "four"}
+	rv := make([]string, len(strs))
+	for i, s := range strs {
+		var err error
+		rv[i], err = AllocStringImmutable(&a, s)
+		sbtest.Nil(t, err)
+	}
+	for i, s := range strs {
+		sbtest.Eq(t, s, rv[i])
+	}
+
+	s, err := AllocStringImmutable(&a, "")
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, "", s)
+
+	Clear(&a)
+	s, err = AllocStringImmutable(&a, "five")
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, "five", s)
+}
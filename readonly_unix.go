@@ -0,0 +1,79 @@
+//go:build linux || darwin
+
+package sbarena
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// Read only memory that immutable strings are copied into. Strings are
+	// packed into the current mapping until it is full.
+	readOnlyRegions struct {
+		mappings guardMappings
+		cur      []byte
+		used     uintptr
+	}
+)
+
+// Copies `s` into the arenas read only memory, mapping more memory if the
+// current mapping is full. The caller must hold the arenas lock.
+func copyReadOnly(a *Arena, s string) (string, error) {
+	if a.readOnly == nil {
+		a.readOnly = &readOnlyRegions{mappings: guardMappings{}}
+		runtime.AddCleanup(
+			a.readOnly, guardMappings.unmapAll, a.readOnly.mappings,
+		)
+	}
+	ro := a.readOnly
+	size := uintptr(len(s))
+
+	if ro.cur == nil || uintptr(len(ro.cur))-ro.used < size {
+		m, err := syscall.Mmap(
+			-1, 0, int(alignUp(size, uintptr(os.Getpagesize()))),
+			syscall.PROT_READ,
+			syscall.MAP_ANON|syscall.MAP_PRIVATE,
+		)
+		if err != nil {
+			return "", sberr.Wrap(
+				ReadOnlyAllocationErr, "Requested size: %d: %s", size, err,
+			)
+		}
+		ro.mappings[uintptr(unsafe.Pointer(unsafe.SliceData(m)))] = m
+		ro.cur = m
+		ro.used = 0
+	}
+
+	if err := syscall.Mprotect(
+		ro.cur, syscall.PROT_READ|syscall.PROT_WRITE,
+	); err != nil {
+		return "", sberr.Wrap(
+			ReadOnlyAllocationErr, "Requested size: %d: %s", size, err,
+		)
+	}
+	dst := ro.cur[ro.used : ro.used+size]
+	copy(dst, s)
+	ro.used += size
+	if err := syscall.Mprotect(ro.cur, syscall.PROT_READ); err != nil {
+		return "", sberr.Wrap(
+			ReadOnlyAllocationErr, "Requested size: %d: %s", size, err,
+		)
+	}
+	return unsafe.String(unsafe.SliceData(dst), len(dst)), nil
+}
+
+// Unmaps all of the arenas read only memory. The caller must hold the arenas
+// lock.
+func releaseReadOnly(a *Arena) {
+	if a.readOnly == nil {
+		return
+	}
+	a.readOnly.mappings.unmapAll()
+	a.readOnly.cur = nil
+	a.readOnly.used = 0
+}
@@ -0,0 +1,45 @@
+//go:build linux || darwin
+
+package sbarena
+
+import (
+	"runtime/debug"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocStringImmutableWriteFaults(t *testing.T) {
+	a := NewArena(0)
+	s, err := AllocStringImmutable(&a, "immutable")
+	sbtest.Nil(t, err)
+	s2, err := AllocStringImmutable(&a, "also immutable")
+	sbtest.Nil(t, err)
+
+	for _, str := range []string{s, s2} {
+		p := unsafe.StringData(str)
+		faultAddr := func() (addr uintptr) {
+			defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+			defer func() {
+				if r, ok := recover().(interface{ Addr() uintptr }); ok {
+					addr = r.Addr()
+				}
+			}()
+			*p = 'I'
+			return 0
+		}()
+		sbtest.Eq(t, uintptr(unsafe.Pointer(p)), faultAddr)
+	}
+	sbtest.Eq(t, "immutable", s)
+	sbtest.Eq(t, "also immutable", s2)
+}
+
+func TestAllocStringImmutableClearUnmaps(t *testing.T) {
+	a := NewArena(0)
+	_, err := AllocStringImmutable(&a, "one")
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 1, len(a.readOnly.mappings))
+	Clear(&a)
+	sbtest.Eq(t, 0, len(a.readOnly.mappings))
+}
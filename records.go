@@ -0,0 +1,81 @@
+package sbarena
+
+import (
+	"encoding/binary"
+	"errors"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+var (
+	InvalidRecordErr = errors.New(
+		"The supplied offset does not reference a valid record",
+	)
+)
+
+// Appends a length prefixed record to the arena, copying `data` into arena
+// memory. The length is written as a varint directly in front of the data.
+// The returned offset can be passed to [ReadRecord] to read the record back.
+//
+// The length prefix and the data must fit in a single bucket together,
+// otherwise a [ValueToLargeErr] will be returned.
+func AppendRecord(a *Arena, data []byte) (uint64, error) {
+	var header [binary.MaxVarintLen64]byte
+	headerLen := binary.PutUvarint(header[:], uint64(len(data)))
+	size := uintptr(headerLen) + uintptr(len(data))
+	if size > maxAllocSize(a) {
+		return 0, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	bucketIdx, off, err := reserve(a, size, 1, plainKind)
+	if err != nil {
+		unlock(a)
+		return 0, err
+	}
+	b := a.buckets[bucketIdx]
+	copy(b[off:], header[:headerLen])
+	copy(b[off+uintptr(headerLen):], data)
+	rv := uint64(bucketsBytes(a, bucketIdx)) + uint64(off)
+	recordAlloc(a, size)
+	publishStats(a)
+	unlock(a)
+
+	return rv, nil
+}
+
+// Reads the record that starts at the supplied offset. The offset must be one
+// that was returned by [AppendRecord]. The returned slice references the arenas
+// memory directly, it is not a copy.
+//
+// Records are not protected from being overwritten, so after calling [Reset] a
+// previously returned offset may reference data that belongs to newer
+// allocations. After calling [Clear] all previously returned offsets are
+// invalid and an [InvalidRecordErr] will be returned.
+func ReadRecord(a *Arena, off uint64) ([]byte, error) {
+	lock(a)
+	defer unlock(a)
+
+	bucketIdx, bucketOff := bucketAt(a, off)
+	if bucketIdx >= len(a.buckets) {
+		return nil, sberr.Wrap(
+			InvalidRecordErr,
+			"Offset: %d Num buckets: %d", off, len(a.buckets),
+		)
+	}
+
+	b := a.buckets[bucketIdx][bucketOff:]
+	l, headerLen := binary.Uvarint(b)
+	if headerLen <= 0 || l > uint64(len(b)-headerLen) {
+		return nil, sberr.Wrap(
+			InvalidRecordErr,
+			"Offset: %d Could not decode a record header", off,
+		)
+	}
+	start := uint64(headerLen)
+	return b[start : start+l : start+l], nil
+}
@@ -0,0 +1,97 @@
+package sbarena
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAppendReadRecord(t *testing.T) {
+	a := NewArena(256)
+
+	records := [][]byte{
+		{},
+		[]byte("one"),
+		bytes.Repeat([]byte{'a'}, 127),
+		bytes.Repeat([]byte{'b'}, 128),
+		[]byte("two"),
+		bytes.Repeat([]byte{'c'}, 200),
+		{0},
+	}
+	offsets := make([]uint64, len(records))
+	for i, r := range records {
+		off, err := AppendRecord(&a, r)
+		sbtest.Nil(t, err)
+		offsets[i] = off
+	}
+	sbtest.Eq(t, 3, NumBuckets(&a))
+
+	for i, r := range records {
+		got, err := ReadRecord(&a, offsets[i])
+		sbtest.Nil(t, err)
+		sbtest.SlicesMatch(t, r, got)
+	}
+}
+
+func TestAppendRecordValueToLarge(t *testing.T) {
+	a := NewArena(16)
+	_, err := AppendRecord(&a, bytes.Repeat([]byte{'a'}, 15))
+	sbtest.Nil(t, err)
+	_, err = AppendRecord(&a, bytes.Repeat([]byte{'a'}, 16))
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestReadRecordInvalidOffset(t *testing.T) {
+	a := NewArena(16)
+	off, err := AppendRecord(&a, []byte("one"))
+	sbtest.Nil(t, err)
+
+	_, err = ReadRecord(&a, 16)
+	sbtest.ContainsError(t, InvalidRecordErr, err)
+
+	Clear(&a)
+	_, err = ReadRecord(&a, off)
+	sbtest.ContainsError(t, InvalidRecordErr, err)
+}
+
+func TestAppendRecordExactlyFillsBucket(t *testing.T) {
+	a := NewArena(16)
+
+	first, err := AppendRecord(&a, bytes.Repeat([]byte{'a'}, 15))
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, uint64(0), first)
+	second, err := AppendRecord(&a, bytes.Repeat([]byte{'b'}, 15))
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, uint64(16), second)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+
+	rec, err := ReadRecord(&a, first)
+	sbtest.Nil(t, err)
+	sbtest.SlicesMatch(t, bytes.Repeat([]byte{'a'}, 15), rec)
+	rec, err = ReadRecord(&a, second)
+	sbtest.Nil(t, err)
+	sbtest.SlicesMatch(t, bytes.Repeat([]byte{'b'}, 15), rec)
+}
+
+func TestAppendReadRecordConcurrent(t *testing.T) {
+	a := NewArena(64)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := range 200 {
+				data := []byte(fmt.Sprintf("%d-%d", i, j))
+				off, err := AppendRecord(&a, data)
+				sbtest.Nil(t, err)
+				got, err := ReadRecord(&a, off)
+				sbtest.Nil(t, err)
+				sbtest.SlicesMatch(t, data, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
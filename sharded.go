@@ -0,0 +1,79 @@
+package sbarena
+
+import (
+	"runtime"
+	"sync/atomic"
+	"weak"
+)
+
+type (
+	// A set of independent arenas that allocations are spread across so that
+	// goroutines allocating at the same time rarely wait on the same lock. Each
+	// shard is a regular [Arena] with its own buckets, so values allocated
+	// through the same ShardedArena are not guaranteed to be near each other in
+	// memory.
+	//
+	// A ShardedArena must be created with [NewShardedArena] and must not be
+	// copied after first use.
+	ShardedArena struct {
+		_      noCopy
+		shards []Arena
+		next   atomic.Uint64
+	}
+)
+
+// Creates a new [ShardedArena] with `shards` arenas that each use
+// `bucketSizeBytes` bucket size. If `shards` is <=0 then one shard is created
+// per P, as reported by [runtime.GOMAXPROCS]. If `bucketSizeBytes` is <=0 then
+// [DefaultBlockSize] is used.
+func NewShardedArena(bucketSizeBytes uintptr, shards int) (rv ShardedArena) {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	rv.shards = make([]Arena, shards)
+	for i := range rv.shards {
+		rv.shards[i] = NewArena(bucketSizeBytes)
+	}
+	return
+}
+
+// Allocates a value of type T in one of the shards of `sa`. Shards are picked
+// round robin and a shard whose lock is held by another goroutine is skipped in
+// favor of the next one. Only if every shard is busy does the allocation wait
+// for a lock. See [Alloc] for the errors that can be returned.
+func AllocSharded[T any](sa *ShardedArena) (weak.Pointer[T], error) {
+	n := uint64(len(sa.shards))
+	start := sa.next.Add(1)
+	for i := range n {
+		p, ok, err := TryAlloc[T](&sa.shards[(start+i)%n])
+		if ok {
+			return p, err
+		}
+	}
+	return Alloc[T](&sa.shards[start%n])
+}
+
+// Returns the number of shards in `sa`.
+func NumShards(sa *ShardedArena) int {
+	return len(sa.shards)
+}
+
+// Returns the total number of buckets across all of the shards in `sa`, see
+// [NumBuckets].
+func ShardedNumBuckets(sa *ShardedArena) int {
+	rv := 0
+	for i := range sa.shards {
+		rv += NumBuckets(&sa.shards[i])
+	}
+	return rv
+}
+
+// Returns the total number of bytes allocated across all of the shards in
+// `sa`, see [TotalMemBytes].
+func ShardedTotalMemBytes(sa *ShardedArena) uintptr {
+	var rv uintptr
+	for i := range sa.shards {
+		rv += TotalMemBytes(&sa.shards[i])
+	}
+	return rv
+}
@@ -0,0 +1,104 @@
+package sbarena
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"unsafe"
+	"weak"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestShardedArena(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	sa := NewShardedArena(size*4, 3)
+	sbtest.Eq(t, 3, NumShards(&sa))
+	sbtest.Eq(t, 3, ShardedNumBuckets(&sa))
+	sbtest.Eq(t, 3*size*4, ShardedTotalMemBytes(&sa))
+
+	vals := make([]weak.Pointer[testStruct], 12)
+	for i := range vals {
+		var err error
+		vals[i], err = AllocSharded[testStruct](&sa)
+		sbtest.Nil(t, err)
+		vals[i].Value().A = i
+	}
+	for i := range vals {
+		sbtest.Eq(t, i, vals[i].Value().A)
+	}
+	// Round robin placement spreads the values evenly, filling every shards
+	// first bucket.
+	for i := range sa.shards {
+		sbtest.Eq(t, 4*size, UsedBytes(&sa.shards[i]))
+	}
+	sbtest.Eq(t, 3, ShardedNumBuckets(&sa))
+
+	_, err := AllocSharded[testStruct](&sa)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 4, ShardedNumBuckets(&sa))
+	sbtest.Eq(t, 4*size*4, ShardedTotalMemBytes(&sa))
+
+	sa = NewShardedArena(0, 0)
+	sbtest.Eq(t, runtime.GOMAXPROCS(0), NumShards(&sa))
+}
+
+func TestShardedArenaSkipsLockedShard(t *testing.T) {
+	sa := NewShardedArena(0, 2)
+	lock(&sa.shards[0])
+	for range 4 {
+		_, err := AllocSharded[testStruct](&sa)
+		sbtest.Nil(t, err)
+	}
+	unlock(&sa.shards[0])
+	sbtest.Eq(t, uintptr(0), UsedBytes(&sa.shards[0]))
+	sbtest.Eq(t, 4*unsafe.Sizeof(testStruct{}), UsedBytes(&sa.shards[1]))
+}
+
+func TestShardedArenaConcurrent(t *testing.T) {
+	sa := NewShardedArena(unsafe.Sizeof(testStruct{})*16, 4)
+	vals := make([][]weak.Pointer[testStruct], 8)
+	var wg sync.WaitGroup
+	for i := range vals {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vals[i] = make([]weak.Pointer[testStruct], 100)
+			for j := range vals[i] {
+				p, err := AllocSharded[testStruct](&sa)
+				sbtest.Nil(t, err)
+				p.Value().A = i*100 + j
+				vals[i][j] = p
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := range vals {
+		for j := range vals[i] {
+			sbtest.Eq(t, i*100+j, vals[i][j].Value().A)
+		}
+	}
+}
+
+func BenchmarkAllocSharded(b *testing.B) {
+	b.Run("Single", func(b *testing.B) {
+		a := NewArena(0)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := Alloc[testStruct](&a); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+	b.Run("Sharded", func(b *testing.B) {
+		sa := NewShardedArena(0, 0)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := AllocSharded[testStruct](&sa); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
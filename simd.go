@@ -0,0 +1,136 @@
+package sbarena
+
+import (
+	"math/bits"
+	"unsafe"
+	"weak"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+// Allocates a slice of at least `n` values of type T that is laid out for SIMD
+// processing with `lanes` values per vector. The first element is aligned to
+// `lanes*sizeof(T)` bytes and the length is rounded up to a multiple of
+// `lanes`, so loops can process the whole slice a vector at a time without any
+// scalar prologue or remainder handling. All elements, including the padding
+// elements past `n`, are zeroed.
+//
+// `lanes*sizeof(T)` must be a power of two, otherwise an [InvalidAlignmentErr]
+// will be returned. The elements must fit in a single bucket, otherwise a
+// [ValueToLargeErr] will be returned.
+//
+// The slice header that the returned weak pointer references is also allocated
+// in the arena.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocSliceSIMD[T any](
+	a *Arena,
+	n int,
+	lanes int,
+) (weak.Pointer[[]T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if n < 0 {
+		return weak.Make[[]T](nil), sberr.Wrap(InvalidLengthErr, "Length: %d", n)
+	}
+	if lanes <= 0 ||
+		(size > 0 && bits.OnesCount(uint(uintptr(lanes)*size)) != 1) {
+		return weak.Make[[]T](nil), sberr.Wrap(
+			InvalidAlignmentErr,
+			"Lanes: %d Element size: %d", lanes, size,
+		)
+	}
+	align := max(uintptr(lanes)*size, 1)
+	// Both values are non negative ints, so their sum cannot overflow.
+	padded := (uintptr(n) + uintptr(lanes) - 1) / uintptr(lanes) *
+		uintptr(lanes)
+	total, err := sliceBytes(a, padded, size)
+	if err != nil {
+		return weak.Make[[]T](nil), err
+	}
+
+	lock(a)
+	if err := checkOnHeap(a); err != nil {
+		unlock(a)
+		return weak.Make[[]T](nil), err
+	}
+	m := mark(a)
+	data := unsafe.Pointer(&zeroSizeBase)
+	if total > 0 {
+		bucketIdx, off, err := reserve(a, total, align, kindOf[T]())
+		if err != nil {
+			unlock(a)
+			return weak.Make[[]T](nil), err
+		}
+		data = unsafe.Pointer(unsafe.SliceData(a.buckets[bucketIdx][off:]))
+	}
+	headerIdx, headerOff, err := reserve(
+		a, unsafe.Sizeof([]T{}), unsafe.Alignof([]T{}), scanKind,
+	)
+	if err != nil {
+		// Give back the values so they are not lost to a failed call.
+		restore(a, m)
+		publishStats(a)
+		unlock(a)
+		return weak.Make[[]T](nil), err
+	}
+	header := (*[]T)(unsafe.Pointer(&a.buckets[headerIdx][headerOff]))
+	recordAlloc(a, total+unsafe.Sizeof([]T{}))
+	publishStats(a)
+	unlock(a)
+
+	*header = unsafe.Slice((*T)(data), padded)
+	clear(*header)
+	return weak.Make(header), nil
+}
+
+// Allocates enough space in the arena to hold a value of type T whose address
+// is a multiple of `align`, which is useful for values that are loaded with
+// vector instructions or that should start on their own cache line. If `align`
+// is smaller than the natural alignment of T the natural alignment is used
+// instead. The padding needed to reach the alignment is taken from the current
+// bucket and is counted by [WastedBytes].
+//
+// `align` must be a power of two, otherwise an [InvalidAlignmentErr] will be
+// returned. The value must still fit in a single bucket once it has been
+// aligned, otherwise a [ValueToLargeErr] will be returned. Zero sized values
+// take up a single byte so that they still receive an aligned address.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocAligned[T any](a *Arena, align uintptr) (weak.Pointer[T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if bits.OnesCount(uint(align)) != 1 {
+		return weak.Make[T](nil), sberr.Wrap(
+			InvalidAlignmentErr, "Alignment: %d", align,
+		)
+	}
+	align = max(align, unsafe.Alignof(tmp))
+	if size > maxAllocSize(a) {
+		return weak.Make[T](nil), sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Alignment: %d Got Size: %d",
+			size, align, maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	if err := checkOnHeap(a); err != nil {
+		unlock(a)
+		return weak.Make[T](nil), err
+	}
+	bucketIdx, off, err := reserve(a, max(size, 1), align, kindOf[T]())
+	if err != nil {
+		unlock(a)
+		return weak.Make[T](nil), err
+	}
+	rv := (*T)(unsafe.Pointer(&a.buckets[bucketIdx][off]))
+	a.allocs++
+	recordAlloc(a, size)
+	publishStats(a)
+	unlock(a)
+
+	return weak.Make(rv), nil
+}
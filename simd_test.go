@@ -0,0 +1,134 @@
+package sbarena
+
+import (
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocSliceSIMD(t *testing.T) {
+	a := NewArena(0)
+	// Misalign the arena so the slice has to be padded to be aligned.
+	_, err := Alloc[byte](&a)
+	sbtest.Nil(t, err)
+
+	p, err := AllocSliceSIMD[float32](&a, 13, 8)
+	sbtest.Nil(t, err)
+	s := *p.Value()
+	sbtest.Eq(t, 16, len(s))
+	sbtest.Eq(t, 16, cap(s))
+	sbtest.Eq(t, 0, uintptr(unsafe.Pointer(unsafe.SliceData(s)))%32)
+	for _, v := range s {
+		sbtest.Eq(t, float32(0), v)
+	}
+
+	p, err = AllocSliceSIMD[float32](&a, 16, 8)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 16, len(*p.Value()))
+
+	p, err = AllocSliceSIMD[float32](&a, 0, 8)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, len(*p.Value()))
+}
+
+func TestAllocSliceSIMDErrors(t *testing.T) {
+	a := NewArena(64)
+	_, err := AllocSliceSIMD[float32](&a, -1, 8)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+	_, err = AllocSliceSIMD[float32](&a, 8, 0)
+	sbtest.ContainsError(t, InvalidAlignmentErr, err)
+	_, err = AllocSliceSIMD[float32](&a, 8, 3)
+	sbtest.ContainsError(t, InvalidAlignmentErr, err)
+	_, err = AllocSliceSIMD[float32](&a, 17, 8)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestAllocSliceSIMDHeaderDoesNotFit(t *testing.T) {
+	a := NewFixedArena(32)
+	_, err := AllocSliceSIMD[float32](&a, 8, 4)
+	sbtest.ContainsError(t, OutOfSpaceErr, err)
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+
+	b := NewArena(0)
+	s, err := AllocSliceSIMD[float32](&b, 0, 4)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, len(*s.Value()))
+	sbtest.Eq(
+		t, unsafe.Pointer(&zeroSizeBase),
+		unsafe.Pointer(unsafe.SliceData(*s.Value())),
+	)
+	sbtest.Eq(t, unsafe.Sizeof([]float32{}), UsedBytes(&b))
+}
+
+func TestAllocAligned(t *testing.T) {
+	a := NewArena(256)
+	// Misalign the arena so the value has to be padded to be aligned.
+	_, err := Alloc[byte](&a)
+	sbtest.Nil(t, err)
+	wasted := WastedBytes(&a)
+
+	p, err := AllocAligned[[4]float64](&a, 64)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, uintptr(unsafe.Pointer(p.Value()))%64)
+	p.Value()[3] = 1
+	sbtest.Eq(t, float64(1), p.Value()[3])
+	pad := uintptr(unsafe.Pointer(p.Value())) -
+		uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[0]))) - 1
+	sbtest.Eq(t, wasted+pad, WastedBytes(&a))
+	sbtest.Eq(t, 256-1-pad-32, syncedBytesLeft(&a))
+
+	// Smaller than the natural alignment of the type.
+	p2, err := AllocAligned[int64](&a, 1)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, uintptr(unsafe.Pointer(p2.Value()))%unsafe.Alignof(int64(0)))
+
+	_, err = AllocAligned[int64](&a, 48)
+	sbtest.ContainsError(t, InvalidAlignmentErr, err)
+	_, err = AllocAligned[int64](&a, 0)
+	sbtest.ContainsError(t, InvalidAlignmentErr, err)
+	_, err = AllocAligned[[257]byte](&a, 64)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestAllocAlignedExactFit(t *testing.T) {
+	a := NewArena(64)
+	p, err := AllocAligned[[64]byte](&a, 64)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, uintptr(unsafe.Pointer(p.Value()))%64)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, uintptr(0), syncedBytesLeft(&a))
+
+	b := NewArena(128)
+	p2, err := AllocAligned[[100]byte](&b, 64)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, uintptr(unsafe.Pointer(p2.Value()))%64)
+	sbtest.Eq(t, 1, NumBuckets(&b))
+	sbtest.Eq(t, uintptr(28), syncedBytesLeft(&b))
+
+	// Once the bucket is misaligned the value moves to the next bucket.
+	c := NewArena(128)
+	_, err = AllocBytes(&c, 1)
+	sbtest.Nil(t, err)
+	p3, err := AllocAligned[[100]byte](&c, 64)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, uintptr(unsafe.Pointer(p3.Value()))%64)
+	sbtest.Eq(t, 2, NumBuckets(&c))
+}
+
+func TestAllocAlignedNeverFits(t *testing.T) {
+	a := NewArena(64)
+	_, err := a.AllocRaw(1, 1)
+	sbtest.Nil(t, err)
+	for range 5 {
+		_, err := AllocAligned[*int](&a, 4096)
+		sbtest.ContainsError(t, ValueToLargeErr, err)
+		// The arena itself must not move on for a value that never fits.
+		_, err = a.AllocRaw(8, 4096)
+		sbtest.ContainsError(t, ValueToLargeErr, err)
+	}
+	sbtest.Eq(t, 1, NumBuckets(&a))
+	sbtest.Eq(t, uintptr(64), TotalMemBytes(&a))
+	sbtest.Eq(t, uintptr(0), WastedBytes(&a))
+	sbtest.Eq(t, uintptr(63), syncedBytesLeft(&a))
+}
@@ -0,0 +1,75 @@
+package sbarena
+
+type (
+	// Allocates buckets by carving them out of larger slabs of memory that
+	// each hold several buckets. Buckets that are released are kept and
+	// handed out again before a new slab is allocated.
+	slabAllocator struct {
+		// The slabs and idle buckets of each kind, see [bucketKind].
+		slab       [numKinds][]byte
+		perSlab    int
+		bucketSize uintptr
+		idle       [numKinds][]bucket
+	}
+)
+
+// Creates a new [Arena] whose buckets are carved out of slabs of memory that
+// each hold `bucketsPerSlab` buckets, so that growing the arena only allocates
+// from the go heap once every `bucketsPerSlab` buckets. Every bucket starts on
+// its own cache line, which keeps the tail of one bucket from sharing a cache
+// line with the head of the next even though they are adjacent in memory.
+//
+// If `bucketSizeBytes` is <=0 then [DefaultBlockSize] is used. If
+// `bucketsPerSlab` is <=0 then a single bucket is placed in each slab.
+//
+// Buckets released by [Clear] are reused by later allocations rather than
+// being left for the garbage collector, so pointers into an arena created by
+// this function are not set to nil by [Clear], they must not be used after the
+// arena is cleared.
+func NewSlabArena(bucketSizeBytes uintptr, bucketsPerSlab int) (rv Arena) {
+	if bucketSizeBytes <= 0 {
+		bucketSizeBytes = DefaultBlockSize
+	}
+	g := &slabAllocator{
+		perSlab:    max(bucketsPerSlab, 1),
+		bucketSize: bucketSizeBytes,
+	}
+
+	rv.arenaState = arenaState{
+		curBucket:    0,
+		bytesLeft:    bucketSizeBytes,
+		bucketSize:   bucketSizeBytes,
+		allocator:    g,
+		freshBuckets: 1,
+		kind:         scanKind,
+		parked:       lanePos{bucket: -1},
+	}
+	appendBucket(&rv, g.alloc(bucketSizeBytes, scanKind), scanKind)
+	publishStats(&rv)
+	return
+}
+
+func (g *slabAllocator) alloc(size uintptr, kind bucketKind) bucket {
+	if idle := g.idle[kind]; len(idle) > 0 {
+		b := idle[len(idle)-1]
+		idle[len(idle)-1] = nil
+		g.idle[kind] = idle[:len(idle)-1]
+		return b
+	}
+
+	stride := alignUp(size, CacheLineSize)
+	if uintptr(len(g.slab[kind])) < size {
+		g.slab[kind] = newBucket(stride*uintptr(g.perSlab), kind)
+	}
+	b := bucket(g.slab[kind][:size:size])
+	g.slab[kind] = g.slab[kind][min(stride, uintptr(len(g.slab[kind]))):]
+	return b
+}
+
+func (g *slabAllocator) free(b bucket, kind bucketKind) {
+	g.idle[kind] = append(g.idle[kind], b)
+}
+
+func (g *slabAllocator) onHeap() bool {
+	return true
+}
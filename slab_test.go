@@ -0,0 +1,64 @@
+package sbarena
+
+import (
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestSlabArenaBucketsAligned(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{}) + 1
+	a := NewSlabArena(size, 3)
+	for range 10 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	sbtest.Eq(t, 10, NumBuckets(&a))
+	for i, b := range a.buckets {
+		sbtest.Eq(t, int(size), len(b))
+		sbtest.Eq(t, 0, uintptr(unsafe.Pointer(unsafe.SliceData(b)))%CacheLineSize)
+		if i%3 != 0 {
+			// Buckets in the same slab are directly after each other.
+			prev := uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[i-1])))
+			sbtest.Eq(
+				t,
+				prev+alignUp(size, CacheLineSize),
+				uintptr(unsafe.Pointer(unsafe.SliceData(b))),
+			)
+		}
+	}
+}
+
+func TestSlabArenaReusesBuckets(t *testing.T) {
+	a := NewSlabArena(unsafe.Sizeof(testStruct{}), 2)
+	for range 4 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	old := map[*byte]struct{}{}
+	for _, b := range a.buckets {
+		old[unsafe.SliceData(b)] = struct{}{}
+	}
+
+	Clear(&a)
+	for range 4 {
+		_, err := Alloc[testStruct](&a)
+		sbtest.Nil(t, err)
+	}
+	for _, b := range a.buckets {
+		_, ok := old[unsafe.SliceData(b)]
+		sbtest.True(t, ok)
+	}
+}
+
+func TestHeapBucketsAligned(t *testing.T) {
+	for _, size := range []uintptr{1, 24, 40, 100, 1000, DefaultBlockSize} {
+		for _, kind := range []bucketKind{plainKind, scanKind} {
+			b := newBucket(size, kind)
+			sbtest.Eq(t, int(size), len(b))
+			sbtest.Eq(t, int(size), cap(b))
+			sbtest.Eq(t, 0, uintptr(unsafe.Pointer(unsafe.SliceData(b)))%CacheLineSize)
+		}
+	}
+}
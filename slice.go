@@ -0,0 +1,222 @@
+package sbarena
+
+import (
+	"math/bits"
+	"unsafe"
+	"weak"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+// Allocates a slice of `n` zeroed values of type T whose backing array is laid
+// out contiguously in a single bucket of the arena. If the rest of the current
+// bucket is too small to hold all `n` values the remaining bytes are left
+// unused and the slice is placed at the start of the next bucket. The values
+// must fit in a single bucket, otherwise a [ValueToLargeErr] will be returned.
+// A negative `n` will return an [InvalidLengthErr].
+//
+// The slice header that the returned weak pointer references is also allocated
+// in the arena. A slice whose values take up no space, because `n` is zero or T
+// is zero sized, only takes up the space of its header.
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocSlice[T any](a *Arena, n int) (weak.Pointer[[]T], error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if n < 0 {
+		return weak.Make[[]T](nil), sberr.Wrap(InvalidLengthErr, "Length: %d", n)
+	}
+	total, err := sliceBytes(a, uintptr(n), size)
+	if err != nil {
+		return weak.Make[[]T](nil), err
+	}
+
+	lock(a)
+	if err := checkOnHeap(a); err != nil {
+		unlock(a)
+		return weak.Make[[]T](nil), err
+	}
+	m := mark(a)
+	data := unsafe.Pointer(&zeroSizeBase)
+	if total > 0 {
+		bucketIdx, off, err := reserve(
+			a, total, unsafe.Alignof(tmp), kindOf[T](),
+		)
+		if err != nil {
+			unlock(a)
+			return weak.Make[[]T](nil), err
+		}
+		data = unsafe.Pointer(unsafe.SliceData(a.buckets[bucketIdx][off:]))
+	}
+	headerIdx, headerOff, err := reserve(
+		a, unsafe.Sizeof([]T{}), unsafe.Alignof([]T{}), scanKind,
+	)
+	if err != nil {
+		// Give back the values so they are not lost to a failed call.
+		restore(a, m)
+		publishStats(a)
+		unlock(a)
+		return weak.Make[[]T](nil), err
+	}
+	header := (*[]T)(unsafe.Pointer(&a.buckets[headerIdx][headerOff]))
+	recordAlloc(a, total+unsafe.Sizeof([]T{}))
+	publishStats(a)
+	unlock(a)
+
+	*header = unsafe.Slice((*T)(data), n)
+	clear(*header)
+	return weak.Make(header), nil
+}
+
+// Returns a slice of `length` zeroed values of type T with a capacity of
+// `capacity` values, whose whole backing array is laid out contiguously in a
+// single bucket of the arena. Appending to the slice while it has spare
+// capacity writes into the arena, so values can be appended up to `capacity`
+// without the backing array being reallocated. Appending beyond `capacity`
+// falls back to the usual growth of go slices, which copies the values to a
+// new backing array on the go heap. The arena memory that backed the slice is
+// not reclaimed until the arena is rewound.
+//
+// The values must fit in a single bucket, otherwise a [ValueToLargeErr] will
+// be returned. A negative `length` will return an [InvalidLengthErr] and a
+// `capacity` that is less than `length` will return an [InvalidCapacityErr].
+//
+// Later allocations overwrite the backing array once the arena is rewound, so
+// the slice must not be used after [Reset] or [Clear].
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocSliceCap[T any](a *Arena, length int, capacity int) ([]T, error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if length < 0 {
+		return nil, sberr.Wrap(InvalidLengthErr, "Length: %d", length)
+	}
+	if capacity < length {
+		return nil, sberr.Wrap(
+			InvalidCapacityErr, "Length: %d Capacity: %d", length, capacity,
+		)
+	}
+	total, err := sliceBytes(a, uintptr(capacity), size)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		rv := unsafe.Slice((*T)(unsafe.Pointer(&zeroSizeBase)), capacity)
+		return rv[:length], nil
+	}
+
+	lock(a)
+	if err := checkOnHeap(a); err != nil {
+		unlock(a)
+		return nil, err
+	}
+	bucketIdx, off, err := reserve(a, total, unsafe.Alignof(tmp), kindOf[T]())
+	if err != nil {
+		unlock(a)
+		return nil, err
+	}
+	data := (*T)(unsafe.Pointer(&a.buckets[bucketIdx][off]))
+	recordAlloc(a, total)
+	publishStats(a)
+	unlock(a)
+
+	rv := unsafe.Slice(data, capacity)
+	clear(rv)
+	return rv[:length], nil
+}
+
+// Allocates `n` zeroed values of type T that are laid out contiguously in a
+// single bucket of the arena and returns a weak pointer to the first value
+// along with the number of values that were allocated. Unlike [AllocSlice] no
+// slice header is allocated, the remaining values are reached by advancing the
+// pointer to the first value by multiples of the size of T. If the rest of the
+// current bucket is too small to hold all `n` values the values are placed at
+// the start of the next bucket. The values must fit in a single bucket,
+// otherwise a [ValueToLargeErr] will be returned. A negative `n` will return an
+// [InvalidLengthErr].
+//
+// A [NonHeapMemoryErr] will be returned if the arenas memory does not live on
+// the go heap, as is the case for arenas created with [NewGuardedArena].
+func AllocN[T any](a *Arena, n int) (weak.Pointer[T], int, error) {
+	var tmp T
+	size := unsafe.Sizeof(tmp)
+	if n < 0 {
+		return weak.Make[T](nil), 0, sberr.Wrap(InvalidLengthErr, "Length: %d", n)
+	}
+	total, err := sliceBytes(a, uintptr(n), size)
+	if err != nil {
+		return weak.Make[T](nil), 0, err
+	}
+	if total == 0 {
+		return weak.Make((*T)(unsafe.Pointer(&zeroSizeBase))), n, nil
+	}
+
+	lock(a)
+	if err := checkOnHeap(a); err != nil {
+		unlock(a)
+		return weak.Make[T](nil), 0, err
+	}
+	bucketIdx, off, err := reserve(a, total, unsafe.Alignof(tmp), kindOf[T]())
+	if err != nil {
+		unlock(a)
+		return weak.Make[T](nil), 0, err
+	}
+	rv := (*T)(unsafe.Pointer(&a.buckets[bucketIdx][off]))
+	recordAlloc(a, total)
+	publishStats(a)
+	unlock(a)
+
+	clear(unsafe.Slice(rv, n))
+	return weak.Make(rv), n, nil
+}
+
+// Returns a slice of `n` bytes with a capacity of `n` whose backing memory is a
+// contiguous region in a single bucket of the arena. If the rest of the current
+// bucket is too small the slice is placed at the start of the next bucket. The
+// bytes are not zeroed, they hold whatever was last written to that memory.
+//
+// `n` must not be larger than the bucket size, otherwise a [ValueToLargeErr]
+// will be returned. A negative `n` will return an [InvalidLengthErr].
+//
+// The contents of the slice are preserved by [Reset], though later allocations
+// will then overwrite them. After [Clear] the slice no longer references arena
+// memory and must not be used.
+func AllocBytes(a *Arena, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, sberr.Wrap(InvalidLengthErr, "Length: %d", n)
+	}
+	if uintptr(n) > maxAllocSize(a) {
+		return nil, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			n, maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	defer unlock(a)
+	bucketIdx, off, err := reserve(a, uintptr(n), 1, plainKind)
+	if err != nil {
+		return nil, err
+	}
+	recordAlloc(a, uintptr(n))
+	publishStats(a)
+	return a.buckets[bucketIdx][off : off+uintptr(n) : off+uintptr(n)], nil
+}
+
+// Returns the number of bytes needed to hold `n` values that are `size` bytes
+// each. A [ValueToLargeErr] is returned if the values do not fit in a single
+// bucket, including when the number of bytes does not fit in a uintptr.
+func sliceBytes(a *Arena, n uintptr, size uintptr) (uintptr, error) {
+	hi, lo := bits.Mul(uint(n), uint(size))
+	if hi != 0 || uintptr(lo) > maxAllocSize(a) {
+		return 0, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d * %d Got Size: %d",
+			n, size, maxAllocSize(a),
+		)
+	}
+	return uintptr(lo), nil
+}
@@ -0,0 +1,226 @@
+package sbarena
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocSlice(t *testing.T) {
+	word := unsafe.Sizeof(int(0))
+	a := NewArena(10 * word)
+
+	// The values hold no pointers, so they are placed in a different bucket
+	// than the header.
+	p, err := AllocSlice[int](&a, 8)
+	sbtest.Nil(t, err)
+	s := *p.Value()
+	sbtest.Eq(t, 8, len(s))
+	sbtest.Eq(t, 8, cap(s))
+	for i := range s {
+		sbtest.Eq(t, 0, s[i])
+		s[i] = i
+	}
+	for i, v := range *p.Value() {
+		sbtest.Eq(t, i, v)
+	}
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(
+		t, uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[0]))),
+		uintptr(unsafe.Pointer(unsafe.SliceData(s))),
+	)
+
+	// Exactly fills the rest of the first bucket.
+	p, err = AllocSlice[int](&a, 2)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 2, len(*p.Value()))
+	sbtest.Eq(t, 2, NumBuckets(&a))
+
+	// Does not fit in what is left so the whole slice moves to a new bucket.
+	p, err = AllocSlice[int](&a, 9)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 9, len(*p.Value()))
+	sbtest.Eq(t, 3, NumBuckets(&a))
+
+	p, err = AllocSlice[int](&a, 0)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, len(*p.Value()))
+}
+
+func TestAllocSliceCap(t *testing.T) {
+	a := NewArena(128)
+	s, err := AllocSliceCap[int](&a, 2, 8)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 2, len(s))
+	sbtest.Eq(t, 8, cap(s))
+	sbtest.Eq(t, 8*unsafe.Sizeof(int(0)), UsedBytes(&a))
+	base := unsafe.SliceData(s)
+	sbtest.Eq(
+		t, uintptr(unsafe.Pointer(unsafe.SliceData(a.buckets[0]))),
+		uintptr(unsafe.Pointer(base)),
+	)
+
+	// Appending within the capacity stays in the arena.
+	for i := range 6 {
+		s = append(s, i+1)
+	}
+	sbtest.Eq(t, base, unsafe.SliceData(s))
+	sbtest.SlicesMatch(t, []int{0, 0, 1, 2, 3, 4, 5, 6}, s)
+
+	// Appending beyond it moves the values to the go heap.
+	grown := append(s, 7)
+	sbtest.Neq[*int](t, base, unsafe.SliceData(grown))
+	sbtest.SlicesMatch(t, []int{0, 0, 1, 2, 3, 4, 5, 6, 7}, grown)
+	sbtest.SlicesMatch(t, []int{0, 0, 1, 2, 3, 4, 5, 6}, s)
+	grown[0] = 100
+	sbtest.Eq(t, 0, s[0])
+	sbtest.Eq(t, 8*unsafe.Sizeof(int(0)), UsedBytes(&a))
+
+	s, err = AllocSliceCap[int](&a, 0, 0)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, cap(s))
+	_, err = AllocSliceCap[int](&a, -1, 2)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+	_, err = AllocSliceCap[int](&a, 3, 2)
+	sbtest.ContainsError(t, InvalidCapacityErr, err)
+	_, err = AllocSliceCap[int](&a, 1, int(128/unsafe.Sizeof(int(0)))+1)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestAllocSliceErrors(t *testing.T) {
+	a := NewArena(64)
+	_, err := AllocSlice[int](&a, -1)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+	_, err = AllocSlice[int](&a, int(64/unsafe.Sizeof(int(0)))+1)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	sbtest.Eq(t, 1, NumBuckets(&a))
+}
+
+func TestAllocSliceHeaderDoesNotFit(t *testing.T) {
+	word := unsafe.Sizeof(int(0))
+	header := unsafe.Sizeof([]int{})
+
+	// The values fit, the header does not. The values must be given back.
+	a := NewFixedArena(8 * word)
+	_, err := AllocSlice[int](&a, 8)
+	sbtest.ContainsError(t, OutOfSpaceErr, err)
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+	p, err := AllocSlice[int](&a, int((8*word-header)/word))
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, int((8*word-header)/word), len(*p.Value()))
+}
+
+func TestAllocSliceEmpty(t *testing.T) {
+	a := NewArena(0)
+	p, err := AllocSlice[int](&a, 0)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, len(*p.Value()))
+	sbtest.Eq(
+		t, unsafe.Pointer(&zeroSizeBase),
+		unsafe.Pointer(unsafe.SliceData(*p.Value())),
+	)
+	sbtest.Eq(t, unsafe.Sizeof([]int{}), UsedBytes(&a))
+}
+
+func TestAllocBytes(t *testing.T) {
+	a := NewArena(64)
+	one, err := AllocBytes(&a, 40)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 40, len(one))
+	sbtest.Eq(t, 40, cap(one))
+	copy(one, bytes.Repeat([]byte{1}, 40))
+	sbtest.Eq(t, unsafe.SliceData(a.buckets[0]), unsafe.SliceData(one))
+
+	// Does not fit in the rest of the first bucket.
+	two, err := AllocBytes(&a, 30)
+	sbtest.Nil(t, err)
+	copy(two, bytes.Repeat([]byte{2}, 30))
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(t, unsafe.SliceData(a.buckets[1]), unsafe.SliceData(two))
+	sbtest.SlicesMatch(t, bytes.Repeat([]byte{1}, 40), one)
+	sbtest.SlicesMatch(t, bytes.Repeat([]byte{2}, 30), two)
+
+	Reset(&a)
+	sbtest.SlicesMatch(t, bytes.Repeat([]byte{1}, 40), one)
+	three, err := AllocBytes(&a, 8)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, unsafe.SliceData(one), unsafe.SliceData(three))
+	sbtest.SlicesMatch(t, bytes.Repeat([]byte{1}, 8), three)
+
+	_, err = AllocBytes(&a, 65)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	_, err = AllocBytes(&a, -1)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+}
+
+func TestAllocN(t *testing.T) {
+	stride := unsafe.Sizeof(testStruct{})
+	a := NewArena(stride * 16)
+	// Leaves too little room for all 10 values in the first bucket.
+	_, _, err := AllocN[testStruct](&a, 8)
+	sbtest.Nil(t, err)
+
+	p, n, err := AllocN[testStruct](&a, 10)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 10, n)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	first := p.Value()
+	sbtest.Eq(t, unsafe.Pointer(unsafe.SliceData(a.buckets[1])), unsafe.Pointer(first))
+	for i := range n {
+		v := (*testStruct)(unsafe.Add(unsafe.Pointer(first), uintptr(i)*stride))
+		sbtest.Eq(t, testStruct{}, *v)
+		v.A = i
+	}
+	for i := range n {
+		v := (*testStruct)(unsafe.Add(unsafe.Pointer(first), uintptr(i)*stride))
+		sbtest.Eq(t, i, v.A)
+	}
+
+	_, n, err = AllocN[testStruct](&a, 0)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 0, n)
+	_, _, err = AllocN[testStruct](&a, -1)
+	sbtest.ContainsError(t, InvalidLengthErr, err)
+	_, _, err = AllocN[testStruct](&a, 17)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	sbtest.Eq(t, 2, NumBuckets(&a))
+}
+
+func TestAllocSliceOverflow(t *testing.T) {
+	a := NewArena(64)
+	// Multiplying by the element size wraps around to exactly zero.
+	wraps := math.MaxInt/2 + 1
+	for _, n := range []int{math.MaxInt, math.MaxInt - 1, wraps} {
+		_, err := AllocSlice[int32](&a, n)
+		sbtest.ContainsError(t, ValueToLargeErr, err)
+		_, _, err = AllocN[int32](&a, n)
+		sbtest.ContainsError(t, ValueToLargeErr, err)
+		_, err = AllocFreeableSlice[int32](&a, n)
+		sbtest.ContainsError(t, ValueToLargeErr, err)
+		_, err = AllocSliceSIMD[int32](&a, n, 4)
+		sbtest.ContainsError(t, ValueToLargeErr, err)
+	}
+	_, err := AllocSliceSIMD[int32](&a, 1, math.MaxInt/2+1)
+	sbtest.ContainsError(t, InvalidAlignmentErr, err)
+
+	sbtest.Eq(t, uintptr(0), UsedBytes(&a))
+	s, err := AllocSlice[int32](&a, 8)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, 8, len(*s.Value()))
+	sbtest.Eq(t, uintptr(32+unsafe.Sizeof([]int32{})), UsedBytes(&a))
+
+	// Sizes that would wrap around when the padding is added must not appear
+	// to fit in a bucket.
+	b := NewArena(64)
+	_, err = Alloc[byte](&b)
+	sbtest.Nil(t, err)
+	lock(&b)
+	_, _, err = reserve(&b, ^uintptr(0)-2, 8, plainKind)
+	unlock(&b)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	sbtest.Eq(t, uintptr(63), syncedBytesLeft(&b))
+	sbtest.Eq(t, 1, NumBuckets(&b))
+}
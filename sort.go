@@ -0,0 +1,27 @@
+package sbarena
+
+import (
+	"slices"
+	"weak"
+)
+
+// Sorts the arena backed slice referenced by `data` in place according to
+// `less`. The sort does not allocate, so sorting arena memory does not create
+// any work for the garbage collector. The sort is not guaranteed to be stable.
+// Nothing is done if the weak pointer is nil or the memory it referenced has
+// already been collected.
+func SortFunc[T any](data weak.Pointer[[]T], less func(a, b T) bool) {
+	s := data.Value()
+	if s == nil {
+		return
+	}
+	slices.SortFunc(*s, func(l, r T) int {
+		switch {
+		case less(l, r):
+			return -1
+		case less(r, l):
+			return 1
+		}
+		return 0
+	})
+}
@@ -0,0 +1,53 @@
+package sbarena
+
+import (
+	"slices"
+	"testing"
+	"weak"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestSortFunc(t *testing.T) {
+	a := NewArena(0)
+	p, err := AllocSlice[testStruct](&a, 6)
+	sbtest.Nil(t, err)
+	s := *p.Value()
+	input := []int{4, 1, 5, 0, 3, 2}
+	for i, v := range input {
+		s[i] = testStruct{A: v, B: float64(v)}
+	}
+
+	less := func(l, r testStruct) bool { return l.A < r.A }
+	allocs := testing.AllocsPerRun(1, func() { SortFunc(p, less) })
+	sbtest.Eq(t, float64(0), allocs)
+	for i, v := range s {
+		sbtest.Eq(t, i, v.A)
+		sbtest.Eq(t, float64(i), v.B)
+	}
+}
+
+func TestSortFuncReversedWithDuplicates(t *testing.T) {
+	a := NewArena(0)
+	input := []int{9, 9, 8, 7, 7, 7, 5, 4, 4, 3, 2, 2, 1, 0, 0}
+	for _, n := range []int{len(input), 64, 1000} {
+		p, err := AllocSlice[int](&a, n)
+		sbtest.Nil(t, err)
+		s := *p.Value()
+		for i := range s {
+			s[i] = input[i%len(input)]
+		}
+		expected := slices.Clone(s)
+		slices.Sort(expected)
+
+		SortFunc(p, func(l, r int) bool { return l < r })
+		sbtest.SlicesMatch(t, expected, s)
+	}
+}
+
+func TestSortFuncNil(t *testing.T) {
+	SortFunc(
+		weak.Make[[]testStruct](nil),
+		func(l, r testStruct) bool { return l.A < r.A },
+	)
+}
@@ -0,0 +1,66 @@
+package sbarena
+
+import (
+	"runtime"
+	"time"
+)
+
+type (
+	// Controls how a goroutine waits for an arenas lock while another
+	// goroutine holds it. See [SetSpinStrategy].
+	SpinStrategy int32
+)
+
+const (
+	// Yields the processor with [runtime.Gosched] after every failed attempt
+	// at acquiring the lock. This is the default and keeps a waiting goroutine
+	// from starving the goroutine that holds the lock when there are more
+	// goroutines than cores.
+	YieldSpin SpinStrategy = iota
+	// Retries immediately without ever yielding. This gives the lowest latency
+	// when the lock is only held briefly and there are idle cores, at the cost
+	// of keeping a core busy for as long as the goroutine waits.
+	BusySpin
+	// Retries immediately for a few attempts, then yields the processor for a
+	// few more and then sleeps between attempts, doubling the sleep each time
+	// up to a millisecond. This uses the least CPU when the lock is heavily
+	// contended or held for long periods, at the cost of latency.
+	BackoffSpin
+)
+
+const (
+	// The number of attempts [BackoffSpin] makes without yielding, and the
+	// number of attempts after that which yield before it starts sleeping.
+	backoffBusyAttempts  = 16
+	backoffYieldAttempts = 16
+	// The longest time [BackoffSpin] sleeps between two attempts.
+	backoffMaxSleep = time.Millisecond
+)
+
+// Sets how goroutines wait for the arenas lock while it is held by another
+// goroutine, trading latency for CPU usage. The strategy can be changed at any
+// time, goroutines that are already waiting pick it up on their next attempt.
+// The strategy belongs to the arena itself rather than its contents, so it is
+// not exchanged by [Swap]. Unknown strategies behave like [YieldSpin].
+func SetSpinStrategy(a *Arena, s SpinStrategy) {
+	a.spin.Store(int32(s))
+}
+
+// Waits after the failed attempt number `attempt`, counting from zero, at
+// acquiring the arenas lock according to the arenas [SpinStrategy].
+func spinWait(a *Arena, attempt int) {
+	switch SpinStrategy(a.spin.Load()) {
+	case BusySpin:
+	case BackoffSpin:
+		switch {
+		case attempt < backoffBusyAttempts:
+		case attempt < backoffBusyAttempts+backoffYieldAttempts:
+			runtime.Gosched()
+		default:
+			shift := min(attempt-backoffBusyAttempts-backoffYieldAttempts, 10)
+			time.Sleep(min(time.Microsecond<<shift, backoffMaxSleep))
+		}
+	default:
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,101 @@
+package sbarena
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+// Copies the bytes of `s` into the arena and returns a string that references
+// the copy. The returned string compares equal to `s` but shares no memory with
+// it, so the memory backing `s` can be garbage collected once it is no longer
+// referenced elsewhere. This is useful for interning string data parsed out of
+// a large buffer so that the buffer can be released.
+//
+// The bytes of `s` must fit in a single bucket, otherwise a [ValueToLargeErr]
+// will be returned.
+//
+// The returned string is only valid until the memory it references is reused.
+// Calling [Reset], [Truncate] or any of the other functions that rewind the
+// arena allows the memory to be handed out again, and [Clear] releases it
+// entirely. The returned string must not be used after any of these are called.
+func AllocString(a *Arena, s string) (string, error) {
+	if len(s) == 0 {
+		return "", nil
+	}
+	if uintptr(len(s)) > maxAllocSize(a) {
+		return "", sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			len(s), maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	defer unlock(a)
+	rv, err := copyString(a, s)
+	if err == nil {
+		recordAlloc(a, uintptr(len(s)))
+	}
+	return rv, err
+}
+
+// Scratch buffers that [AllocStringf] formats into before copying the result
+// into the arena.
+var formatBufs = sync.Pool{New: func() any { return new([]byte) }}
+
+// The largest scratch buffer that is kept for reuse by [AllocStringf], so that
+// one very long string does not pin a large buffer forever.
+const maxFormatBufSize = 64 << 10
+
+// Formats according to `format`, the same as [fmt.Sprintf], and places the
+// result in the arena, returning a string that references the arenas copy.
+// The result is formatted into a reusable scratch buffer rather than a new
+// string, so no intermediate string is allocated on the go heap.
+//
+// The same rules as for [AllocString] apply: the formatted result must fit in
+// a single bucket, otherwise a [ValueToLargeErr] will be returned, and the
+// returned string must not be used once the arena is rewound or cleared.
+func AllocStringf(a *Arena, format string, args ...any) (string, error) {
+	buf := formatBufs.Get().(*[]byte)
+	*buf = fmt.Appendf((*buf)[:0], format, args...)
+	defer func() {
+		if cap(*buf) <= maxFormatBufSize {
+			formatBufs.Put(buf)
+		}
+	}()
+	if len(*buf) == 0 {
+		return "", nil
+	}
+	if uintptr(len(*buf)) > maxAllocSize(a) {
+		return "", sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			len(*buf), maxAllocSize(a),
+		)
+	}
+
+	lock(a)
+	defer unlock(a)
+	rv, err := copyString(a, unsafe.String(unsafe.SliceData(*buf), len(*buf)))
+	if err == nil {
+		recordAlloc(a, uintptr(len(*buf)))
+	}
+	return rv, err
+}
+
+// Copies `s` into the arenas buckets. `s` must fit in a single bucket. The
+// caller must hold the arenas lock.
+func copyString(a *Arena, s string) (string, error) {
+	size := uintptr(len(s))
+	bucketIdx, off, err := reserve(a, size, 1, plainKind)
+	if err != nil {
+		return "", err
+	}
+	dst := a.buckets[bucketIdx][off : off+size]
+	copy(dst, s)
+	publishStats(a)
+	return unsafe.String(unsafe.SliceData(dst), len(dst)), nil
+}
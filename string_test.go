@@ -0,0 +1,78 @@
+package sbarena
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestAllocString(t *testing.T) {
+	a := NewArena(0)
+	rv := make([]string, 6)
+	func() {
+		buf := []byte(strings.Repeat("one two three four five six ", 1000))
+		for i := range rv {
+			var err error
+			rv[i], err = AllocString(&a, string(buf[i*4:i*4+4])+strconv.Itoa(i))
+			sbtest.Nil(t, err)
+		}
+	}()
+	runtime.GC()
+	runtime.GC()
+
+	exp := []string{"one 0", "two 1", "thre2", "e fo3", "ur f4", "ive 5"}
+	for i := range rv {
+		sbtest.Eq(t, exp[i], rv[i])
+	}
+
+	s, err := AllocString(&a, "")
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, "", s)
+}
+
+func TestAllocStringValueToLarge(t *testing.T) {
+	a := NewArena(4)
+	s, err := AllocString(&a, "four")
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, "four", s)
+	_, err = AllocString(&a, "five!")
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
+
+func TestAllocStringf(t *testing.T) {
+	a := NewArena(0)
+	rv := make([]string, 100)
+	exp := make([]string, 100)
+	func() {
+		for i := range rv {
+			name := strings.Repeat("x", i%7)
+			args := []any{name, i, float64(i) / 3, []int{i, i + 1}}
+			var err error
+			rv[i], err = AllocStringf(&a, "%s-%d-%.2f-%v", args...)
+			sbtest.Nil(t, err)
+			exp[i] = fmt.Sprintf("%s-%d-%.2f-%v", args...)
+		}
+	}()
+	// The format inputs and scratch buffers may be collected, the arena
+	// copies must not change.
+	runtime.GC()
+	runtime.GC()
+	for i := range rv {
+		sbtest.Eq(t, exp[i], rv[i])
+	}
+
+	s, err := AllocStringf(&a, "")
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, "", s)
+
+	small := NewArena(4)
+	s, err = AllocStringf(&small, "%d", 1234)
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, "1234", s)
+	_, err = AllocStringf(&small, "%d", 12345)
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+}
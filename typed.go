@@ -0,0 +1,65 @@
+package sbarena
+
+import (
+	"unsafe"
+	"weak"
+)
+
+type (
+	// An arena that only holds values of type T. The size and alignment of T
+	// are computed once when the arena is created and the bucket size is a
+	// multiple of the size of T, so values are packed back to back without
+	// any padding or unused space at the end of a bucket.
+	//
+	// The underlying [Arena] is available through [TypedArena.Arena] for use
+	// with all of the other functions in this package. A TypedArena must be
+	// created with [NewTypedArena] and must not be copied after first use.
+	TypedArena[T any] struct {
+		arena Arena
+		size  uintptr
+		align uintptr
+		kind  bucketKind
+	}
+)
+
+// Creates a new [TypedArena] whose buckets are the smallest multiple of the
+// size of T that is at least `minBucketBytes` bytes, see [NewArenaNoWaste]. If
+// `minBucketBytes` is <=0 then [DefaultBlockSize] is used as the minimum.
+func NewTypedArena[T any](minBucketBytes uintptr) (rv TypedArena[T]) {
+	var tmp T
+	rv.arena = NewArenaNoWaste[T](minBucketBytes)
+	rv.size = unsafe.Sizeof(tmp)
+	rv.align = unsafe.Alignof(tmp)
+	rv.kind = kindOf[T]()
+	return
+}
+
+// Returns the underlying arena.
+func (t *TypedArena[T]) Arena() *Arena {
+	return &t.arena
+}
+
+// Allocates a zeroed value of type T in the arena. This behaves the same as
+// [Alloc], including the errors that can be returned, but uses the size,
+// alignment and bucket kind that were computed when the arena was created.
+func (t *TypedArena[T]) New() (weak.Pointer[T], error) {
+	ptr, err := allocRaw(&t.arena, t.size, t.align, t.kind)
+	if err != nil {
+		return weak.Make[T](nil), err
+	}
+	rv := (*T)(ptr)
+	var zero T
+	*rv = zero
+	return weak.Make(rv), nil
+}
+
+// Allocates a value of type T in the arena and copies `v` into it. Any error
+// returned by [TypedArena.New] is returned.
+func (t *TypedArena[T]) NewCopy(v T) (weak.Pointer[T], error) {
+	rv, err := t.New()
+	if err != nil {
+		return rv, err
+	}
+	*rv.Value() = v
+	return rv, nil
+}
@@ -0,0 +1,55 @@
+package sbarena
+
+import (
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestTypedArena(t *testing.T) {
+	size := unsafe.Sizeof(testStruct{})
+	ta := NewTypedArena[testStruct](size*3 + 1)
+	sbtest.Eq(t, size*4, initialBucketSize(ta.Arena()))
+
+	var prev *testStruct
+	for i := range 100 {
+		var p *testStruct
+		if i%2 == 0 {
+			v, err := ta.New()
+			sbtest.Nil(t, err)
+			p = v.Value()
+			sbtest.Eq(t, testStruct{}, *p)
+			p.A = i
+		} else {
+			v, err := ta.NewCopy(testStruct{A: i, C: "odd"})
+			sbtest.Nil(t, err)
+			p = v.Value()
+			sbtest.Eq(t, testStruct{A: i, C: "odd"}, *p)
+		}
+		// Values within a bucket are packed back to back.
+		if i%4 != 0 {
+			sbtest.Eq(
+				t,
+				uintptr(unsafe.Pointer(prev))+size,
+				uintptr(unsafe.Pointer(p)),
+			)
+		}
+		prev = p
+	}
+	sbtest.Eq(t, 25, NumBuckets(ta.Arena()))
+	sbtest.Eq(t, uintptr(0), WastedBytes(ta.Arena()))
+	sbtest.Eq(t, size*100, UsedBytes(ta.Arena()))
+	sbtest.Eq(t, uintptr(0), FreeBytes(ta.Arena()))
+	sbtest.Eq(t, uint64(100), NumAllocations(ta.Arena()))
+}
+
+func TestTypedArenaZeroSize(t *testing.T) {
+	ta := NewTypedArena[struct{}](0)
+	for range 10 {
+		p, err := ta.New()
+		sbtest.Nil(t, err)
+		sbtest.NotNil(t, p.Value())
+	}
+	sbtest.Eq(t, uintptr(0), UsedBytes(ta.Arena()))
+}
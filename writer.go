@@ -0,0 +1,91 @@
+package sbarena
+
+import (
+	"unsafe"
+
+	sberr "github.com/barbell-math/smoothbrain-errs"
+)
+
+type (
+	// An [io.Writer] that copies everything written to it into a single
+	// contiguous region of arena memory. See [NewWriter].
+	ArenaWriter struct {
+		arena *Arena
+		buf   []byte
+	}
+)
+
+// Creates a new [ArenaWriter] that copies everything written to it into `a`.
+// The written bytes are kept in a single contiguous region of one bucket so
+// that they can be accessed as one slice with [ArenaWriter.Bytes].
+func NewWriter(a *Arena) *ArenaWriter {
+	return &ArenaWriter{arena: a}
+}
+
+// Copies `p` into the arena, appending it to the bytes that were already
+// written. Writes are appended in place as long as nothing else was allocated
+// from the arena since the last write and the current bucket has enough space
+// left. Otherwise all of the bytes that were written so far are moved to a new
+// region along with `p`, starting a new bucket if needed. The region that was
+// moved away from is not reused until the arena is reset.
+//
+// All of the written bytes must fit in a single bucket. If they do not a
+// [ValueToLargeErr] is returned and nothing from `p` is written.
+func (w *ArenaWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	size := uintptr(len(w.buf) + len(p))
+	if size > maxAllocSize(w.arena) {
+		return 0, sberr.Wrap(
+			ValueToLargeErr,
+			"Requested size: %d Got Size: %d",
+			size, maxAllocSize(w.arena),
+		)
+	}
+
+	a := w.arena
+	lock(a)
+	defer unlock(a)
+	useKind(a, plainKind)
+	if len(w.buf) > 0 && writerAtEnd(a, w.buf, uintptr(len(p))) {
+		if _, _, err := reserve(a, uintptr(len(p)), 1, plainKind); err != nil {
+			return 0, err
+		}
+		w.buf = unsafe.Slice(unsafe.SliceData(w.buf), size)
+	} else {
+		bucketIdx, off, err := reserve(a, size, 1, plainKind)
+		if err != nil {
+			return 0, err
+		}
+		dst := a.buckets[bucketIdx][off : off+size : off+size]
+		copy(dst, w.buf)
+		w.buf = dst
+	}
+	copy(w.buf[size-uintptr(len(p)):], p)
+	recordAlloc(a, uintptr(len(p)))
+	publishStats(a)
+	return len(p), nil
+}
+
+// Returns true if `buf` ends exactly where the next allocation from the current
+// bucket will start and at least `n` more bytes fit in the current bucket. The
+// caller must hold the arenas lock.
+func writerAtEnd(a *Arena, buf []byte, n uintptr) bool {
+	if len(a.buckets) == 0 || a.curBucket < 0 || a.bytesLeft < n {
+		return false
+	}
+	next := unsafe.Add(
+		unsafe.Pointer(unsafe.SliceData(a.buckets[a.curBucket])),
+		a.bucketSize-a.bytesLeft,
+	)
+	return unsafe.Add(unsafe.Pointer(unsafe.SliceData(buf)), len(buf)) == next
+}
+
+// Returns all of the bytes that were written so far. The returned slice
+// references arena memory directly, it is not a copy. It is only valid until
+// the next call to [ArenaWriter.Write], which may move the bytes, and must not
+// be used after the arena is reset or cleared.
+func (w *ArenaWriter) Bytes() []byte {
+	return w.buf
+}
@@ -0,0 +1,64 @@
+package sbarena
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"unsafe"
+
+	sbtest "github.com/barbell-math/smoothbrain-test"
+)
+
+func TestArenaWriterCopy(t *testing.T) {
+	a := NewArena(1024)
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	w := NewWriter(&a)
+	n, err := io.Copy(w, bytes.NewReader(data))
+	sbtest.Nil(t, err)
+	sbtest.Eq(t, int64(1000), n)
+	sbtest.SlicesMatch(t, data, w.Bytes())
+	sbtest.Eq(t, unsafe.SliceData(a.buckets[0]), unsafe.SliceData(w.Bytes()))
+	sbtest.Eq(t, 1, NumBuckets(&a))
+}
+
+func TestArenaWriterAppendsInPlace(t *testing.T) {
+	a := NewArena(64)
+	w := NewWriter(&a)
+	for _, s := range []string{"one", "two", "three"} {
+		_, err := w.Write([]byte(s))
+		sbtest.Nil(t, err)
+	}
+	sbtest.SlicesMatch(t, []byte("onetwothree"), w.Bytes())
+	sbtest.Eq(t, unsafe.SliceData(a.buckets[0]), unsafe.SliceData(w.Bytes()))
+	sbtest.Eq(t, uintptr(11), UsedBytes(&a))
+}
+
+func TestArenaWriterSpansBuckets(t *testing.T) {
+	a := NewArena(16)
+	w := NewWriter(&a)
+	_, err := w.Write([]byte("0123456789"))
+	sbtest.Nil(t, err)
+
+	// Another allocation between writes forces the bytes to be moved.
+	_, err = AllocBytes(&a, 2)
+	sbtest.Nil(t, err)
+	_, err = w.Write([]byte("abc"))
+	sbtest.Nil(t, err)
+	sbtest.SlicesMatch(t, []byte("0123456789abc"), w.Bytes())
+	sbtest.Eq(t, 2, NumBuckets(&a))
+	sbtest.Eq(t, unsafe.SliceData(a.buckets[1]), unsafe.SliceData(w.Bytes()))
+
+	_, err = w.Write([]byte("def"))
+	sbtest.Nil(t, err)
+	sbtest.SlicesMatch(t, []byte("0123456789abcdef"), w.Bytes())
+	sbtest.Eq(t, 2, NumBuckets(&a))
+
+	n, err := w.Write([]byte("g"))
+	sbtest.ContainsError(t, ValueToLargeErr, err)
+	sbtest.Eq(t, 0, n)
+	sbtest.SlicesMatch(t, []byte("0123456789abcdef"), w.Bytes())
+}